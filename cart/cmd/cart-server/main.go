@@ -10,6 +10,7 @@ import (
 	"route256.ozon.ru/project/cart/config"
 	"route256.ozon.ru/project/cart/internals/app"
 	"route256.ozon.ru/project/cart/internals/infra/errgrp"
+	"route256.ozon.ru/project/cart/migrations"
 	"syscall"
 	"time"
 )
@@ -18,6 +19,9 @@ func main() {
 	parentCtx := context.Background()
 
 	appConfig := config.NewConfig()
+
+	runMigrations(appConfig)
+
 	server := app.NewCartServer(parentCtx, appConfig)
 
 	ctx, stop := signal.NotifyContext(parentCtx, syscall.SIGINT, syscall.SIGTERM)
@@ -25,6 +29,10 @@ func main() {
 
 	g, cancelCtx := errgrp.WithContext(ctx)
 
+	// events outlive the server to send the events of the last requests
+	eventsCtx, stopEvents := context.WithCancel(parentCtx)
+	defer stopEvents()
+
 	log.Printf("Starting server")
 
 	g.Go(func() error {
@@ -37,6 +45,10 @@ func main() {
 		return nil
 	})
 
+	g.Go(func() error {
+		return server.RunEvents(eventsCtx)
+	})
+
 	g.Go(func() error {
 		<-cancelCtx.Done()
 
@@ -44,6 +56,7 @@ func main() {
 
 		ctx, cancel := context.WithTimeout(parentCtx, 5*time.Second)
 		defer cancel()
+		defer stopEvents()
 
 		if err := server.Shutdown(ctx); err != nil {
 			return errors.Join(errors.New("Server shutdown returned an err: %v\n"), err)
@@ -58,3 +71,9 @@ func main() {
 
 	log.Println("Server successfully closed")
 }
+
+func runMigrations(appConfig config.Config) {
+	if appConfig.Storage == config.StoragePostgres {
+		migrations.ApplyMigrations(appConfig.PostgresUrl, "common")
+	}
+}
@@ -5,16 +5,102 @@ import (
 	"log"
 	"os"
 	"regexp"
+	"route256.ozon.ru/project/cart/internals/infra/kafka"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type (
 	Config struct {
-		HttpPort  int
-		LomsApi   string
-		RedisAddr string
-		RedisTTL  int
+		HttpPort      int
+		LomsApi       string
+		RedisAddr     string
+		RedisTTL      int
+		Storage       StorageType
+		PostgresUrl   string
+		CartTTL       int
+		CacheMode     CacheMode
+		CacheCapacity int
+		CacheShards   int
+		// CacheStaleGrace is how long expired products are kept to be served when the product service fails
+		CacheStaleGrace int
+		ProductService  ProductServiceConfig
+		Breaker         BreakerConfig
+		// AdminToken is the bearer token of the promo codes API, the API rejects every request if it's empty
+		AdminToken string
+		// RateLimits are limits of the cart API by route name
+		RateLimits map[string]RateLimitConfig
+		// Kafka has no brokers when cart events are not published
+		Kafka  kafka.Config
+		Events EventsConfig
 	}
+	// EventsConfig sets up the cart event stream: events are buffered in memory
+	// and sent to Topic in batches of BatchSize at least every FlushInterval
+	EventsConfig struct {
+		Topic         string
+		BufferSize    int
+		BatchSize     int
+		FlushInterval time.Duration
+	}
+	// RateLimitConfig limits requests per second of every user and of all users together, 0 rps means no limit
+	RateLimitConfig struct {
+		UserRps     int
+		UserBurst   int
+		GlobalRps   int
+		GlobalBurst int
+	}
+	ProductServiceConfig struct {
+		BaseUrl string
+		Token   string
+		// Timeout limits every request to the service
+		Timeout time.Duration
+		// Retries is how many times a request is sent while the service is rate limiting it or failing
+		Retries int
+		// Rps and Burst limit requests of the client to the service, the burst lets a batch fetch its misses at once
+		Rps   int
+		Burst int
+	}
+	// BreakerConfig sets up circuit breakers of the product service and LOMS clients
+	BreakerConfig struct {
+		FailureThreshold int
+		OpenTimeout      time.Duration
+		HalfOpenRequests int
+	}
+	StorageType string
+	CacheMode   string
+)
+
+const (
+	StorageMemory   StorageType = "memory"
+	StoragePostgres StorageType = "postgres"
+	StorageRedis    StorageType = "redis"
+)
+
+const (
+	RouteAddItem        = "add_item"
+	RouteSetItem        = "set_item"
+	RouteChangeItem     = "change_item"
+	RouteDeleteItem     = "delete_item"
+	RouteDeleteCart     = "delete_cart"
+	RouteGetCart        = "get_cart"
+	RouteValidateCart   = "validate_cart"
+	RouteCheckout       = "checkout"
+	RouteApplyPromo     = "apply_promo"
+	RouteRemovePromo    = "remove_promo"
+	RoutePromos         = "promos"
+	RouteMergeCart      = "merge_cart"
+	RouteGetList        = "get_list"
+	RouteMoveItem       = "move_item"
+	RouteDeleteListItem = "delete_list_item"
+)
+
+var RateLimitedRoutes = []string{RouteAddItem, RouteSetItem, RouteChangeItem, RouteDeleteItem, RouteDeleteCart, RouteGetCart, RouteValidateCart, RouteCheckout, RouteApplyPromo, RouteRemovePromo, RoutePromos, RouteMergeCart, RouteGetList, RouteMoveItem, RouteDeleteListItem}
+
+const (
+	CacheRedis  CacheMode = "redis"
+	CacheMemory CacheMode = "memory"
+	CacheTiered CacheMode = "tiered"
 )
 
 func NewConfig() Config {
@@ -27,10 +113,41 @@ func NewConfig() Config {
 	}
 
 	return Config{
-		HttpPort:  parsePort("CART_APP_HTTP_PORT"),
-		LomsApi:   os.Getenv("CART_APP_LOMS_API"),
-		RedisAddr: os.Getenv("CART_REDIS_ADDR"),
-		RedisTTL:  ttl,
+		HttpPort:        parsePort("CART_APP_HTTP_PORT"),
+		LomsApi:         os.Getenv("CART_APP_LOMS_API"),
+		RedisAddr:       os.Getenv("CART_REDIS_ADDR"),
+		RedisTTL:        ttl,
+		Storage:         parseStorageType("CART_STORAGE"),
+		PostgresUrl:     os.Getenv("CART_POSTGRES_URL"),
+		CartTTL:         parsePositiveInt("CART_REDIS_CART_TTL_SEC"),
+		CacheMode:       parseCacheMode("CART_CACHE_MODE"),
+		CacheCapacity:   parseInt("CART_CACHE_CAPACITY"),
+		CacheShards:     parseInt("CART_CACHE_SHARDS"),
+		CacheStaleGrace: parseInt("CART_CACHE_STALE_GRACE_SEC"),
+		ProductService: ProductServiceConfig{
+			BaseUrl: os.Getenv("CART_PRODUCT_SERVICE_URL"),
+			Token:   os.Getenv("CART_PRODUCT_SERVICE_TOKEN"),
+			Timeout: time.Duration(parseInt("CART_PRODUCT_SERVICE_TIMEOUT_SEC")) * time.Second,
+			Retries: parseInt("CART_PRODUCT_SERVICE_RETRIES"),
+			Rps:     parseInt("CART_PRODUCT_SERVICE_RPS"),
+			Burst:   parseInt("CART_PRODUCT_SERVICE_BURST"),
+		},
+		Breaker: BreakerConfig{
+			FailureThreshold: parseInt("CART_BREAKER_FAILURE_THRESHOLD"),
+			OpenTimeout:      time.Duration(parseInt("CART_BREAKER_OPEN_TIMEOUT_SEC")) * time.Second,
+			HalfOpenRequests: parseInt("CART_BREAKER_HALF_OPEN_REQUESTS"),
+		},
+		AdminToken: os.Getenv("CART_ADMIN_TOKEN"),
+		RateLimits: parseRateLimits(),
+		Kafka: kafka.Config{
+			Brokers: parseBrokers("CART_KAFKA_BOOTSTRAP_SERVER"),
+		},
+		Events: EventsConfig{
+			Topic:         os.Getenv("CART_EVENTS_TOPIC"),
+			BufferSize:    parseInt("CART_EVENTS_BUFFER_SIZE"),
+			BatchSize:     parseInt("CART_EVENTS_BATCH_SIZE"),
+			FlushInterval: time.Duration(parseInt("CART_EVENTS_FLUSH_INTERVAL_MS")) * time.Millisecond,
+		},
 	}
 }
 
@@ -62,3 +179,81 @@ func parsePort(flagName string) int {
 
 	return port
 }
+
+func parseInt(flagName string) int {
+	value, err := strconv.Atoi(os.Getenv(flagName))
+
+	if err != nil {
+		log.Fatal("Failed to parse " + flagName)
+	}
+
+	return value
+}
+
+// parsePositiveInt is for values that make no sense as 0, like ttl: EXPIRE with 0 deletes the key.
+func parsePositiveInt(flagName string) int {
+	value := parseInt(flagName)
+
+	if value <= 0 {
+		log.Fatal("Failed to parse " + flagName + ": must be positive")
+	}
+
+	return value
+}
+
+// parseBrokers reads comma separated broker addresses, none if the variable is empty.
+func parseBrokers(flagName string) []string {
+	value := os.Getenv(flagName)
+
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+func parseStorageType(flagName string) StorageType {
+	storageType := StorageType(os.Getenv(flagName))
+
+	switch storageType {
+	case "":
+		return StorageMemory
+	case StorageMemory, StoragePostgres, StorageRedis:
+		return storageType
+	}
+
+	log.Fatal("Failed to parse " + flagName)
+	return ""
+}
+
+func parseCacheMode(flagName string) CacheMode {
+	cacheMode := CacheMode(os.Getenv(flagName))
+
+	switch cacheMode {
+	case "":
+		return CacheRedis
+	case CacheRedis, CacheMemory, CacheTiered:
+		return cacheMode
+	}
+
+	log.Fatal("Failed to parse " + flagName)
+	return ""
+}
+
+// parseRateLimits reads CART_RATE_LIMIT_<ROUTE>_USER_RPS, _USER_BURST, _GLOBAL_RPS and _GLOBAL_BURST of every route.
+func parseRateLimits() map[string]RateLimitConfig {
+	limits := make(map[string]RateLimitConfig, len(RateLimitedRoutes))
+
+	for _, route := range RateLimitedRoutes {
+		prefix := "CART_RATE_LIMIT_" + strings.ToUpper(route)
+
+		limits[route] = RateLimitConfig{
+			UserRps:     parseInt(prefix + "_USER_RPS"),
+			UserBurst:   parseInt(prefix + "_USER_BURST"),
+			GlobalRps:   parseInt(prefix + "_GLOBAL_RPS"),
+			GlobalBurst: parseInt(prefix + "_GLOBAL_BURST"),
+		}
+	}
+
+	return limits
+}
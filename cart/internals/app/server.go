@@ -3,11 +3,16 @@ package app
 import (
 	"context"
 	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"log"
 	"net/http"
 	"route256.ozon.ru/project/cart/config"
 	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/internals/infra/breaker"
 	"route256.ozon.ru/project/cart/internals/infra/cacher"
+	"route256.ozon.ru/project/cart/internals/infra/kafka"
 	"route256.ozon.ru/project/cart/internals/service"
 	"route256.ozon.ru/project/cart/internals/storage"
 	"route256.ozon.ru/project/cart/internals/transport"
@@ -16,6 +21,7 @@ import (
 
 type CartServer struct {
 	server  *http.Server
+	events  *clients.EventProducer
 	Handler http.Handler
 	Config  config.Config
 }
@@ -23,31 +29,145 @@ type CartServer struct {
 func NewCartServer(ctx context.Context, config config.Config) *CartServer {
 	var server CartServer
 
-	lomsClient, err := clients.NewLomsClient(config.LomsApi)
+	lomsClient, err := clients.NewLomsClient(
+		config.LomsApi,
+		newBreaker("loms", config.Breaker, clients.IsLomsFailure),
+	)
 
 	if err != nil {
 		log.Fatalf("failed to create LomsClient: %v", err)
 		return nil
 	}
 
+	cartStorage, promoStorage, checkoutStorage, err := newStorages(ctx, config)
+
+	if err != nil {
+		log.Fatalf("failed to create cart storage: %v", err)
+		return nil
+	}
+
+	productClient := clients.NewProductClient(
+		config.ProductService,
+		newCacher(ctx, config),
+		newBreaker("product-service", config.Breaker, clients.IsProductServiceFailure),
+	)
+
+	var events service.EventPublisher
+
+	if len(config.Kafka.Brokers) != 0 {
+		server.events, err = newEventProducer(config)
+
+		if err != nil {
+			log.Fatalf("failed to create cart event producer: %v", err)
+			return nil
+		}
+
+		events = server.events
+	}
+
 	cartService := service.NewCartService(
-		storage.NewInMemoryCartStorage(),
-		clients.NewProductClient(
-			cacher.New(
-				ctx,
-				config.RedisAddr,
-				time.Duration(config.RedisTTL)*time.Second,
-			),
-		),
+		cartStorage,
+		productClient,
 		lomsClient,
+		promoStorage,
+		events,
+		checkoutStorage,
 	)
 
-	server.Handler = transport.NewHandler(cartService)
+	server.Handler = transport.NewHandler(cartService, service.NewPromoService(promoStorage), config.RateLimits, config.AdminToken)
 	server.Config = config
 
 	return &server
 }
 
+func newEventProducer(conf config.Config) (*clients.EventProducer, error) {
+	syncProducer, err := kafka.NewSyncProducer(conf.Kafka,
+		kafka.WithProducerPartitioner(sarama.NewHashPartitioner),
+		kafka.WithIdempotent(),
+		kafka.WithRequiredAcks(sarama.WaitForAll),
+		kafka.WithMaxOpenRequests(1),
+		kafka.WithMaxRetries(5),
+		kafka.WithRetryBackoff(10*time.Millisecond),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return clients.NewEventProducer(
+		syncProducer,
+		conf.Events.Topic,
+		conf.Events.BufferSize,
+		conf.Events.BatchSize,
+		conf.Events.FlushInterval,
+	), nil
+}
+
+func newBreaker(name string, conf config.BreakerConfig, isFailure func(error) bool) *breaker.Breaker {
+	return breaker.New(
+		name,
+		breaker.WithFailureThreshold(conf.FailureThreshold),
+		breaker.WithOpenTimeout(conf.OpenTimeout),
+		breaker.WithHalfOpenRequests(conf.HalfOpenRequests),
+		breaker.WithIsFailure(isFailure),
+	)
+}
+
+func newCacher(ctx context.Context, conf config.Config) clients.Cacher {
+	ttl := time.Duration(conf.RedisTTL) * time.Second
+	grace := time.Duration(conf.CacheStaleGrace) * time.Second
+
+	newLRU := func() *cacher.LRU {
+		return cacher.NewLRU(
+			cacher.WithCapacity(conf.CacheCapacity),
+			cacher.WithShards(conf.CacheShards),
+			cacher.WithTTL(ttl),
+			cacher.WithStaleGrace(grace),
+		)
+	}
+
+	switch conf.CacheMode {
+	case config.CacheMemory:
+		return newLRU()
+	case config.CacheTiered:
+		return cacher.NewTiered(newLRU(), cacher.New(ctx, conf.RedisAddr, ttl, grace))
+	default:
+		return cacher.New(ctx, conf.RedisAddr, ttl, grace)
+	}
+}
+
+// newStorages returns the cart storage, the promo code storage and the checkout storage, all kept in the storage of conf.Storage.
+// With the in-memory storage the service must run as a single instance.
+func newStorages(ctx context.Context, conf config.Config) (service.CartStorage, service.PromoStorage, service.CheckoutStorage, error) {
+	switch conf.Storage {
+	case config.StoragePostgres:
+		pool, err := pgxpool.New(ctx, conf.PostgresUrl)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if err = pool.Ping(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+
+		return storage.NewPostgresCartStorage(pool), storage.NewPostgresPromoStorage(pool), storage.NewPostgresCheckoutStorage(pool), nil
+	case config.StorageRedis:
+		client := redis.NewClient(&redis.Options{Addr: conf.RedisAddr})
+
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, nil, nil, err
+		}
+
+		return storage.NewRedisCartStorage(client, time.Duration(conf.CartTTL)*time.Second),
+			storage.NewRedisPromoStorage(client),
+			storage.NewRedisCheckoutStorage(client),
+			nil
+	default:
+		return storage.NewInMemoryCartStorage(), storage.NewInMemoryPromoStorage(), storage.NewInMemoryCheckoutStorage(), nil
+	}
+}
+
 func (c *CartServer) ListenAndServe() error {
 	c.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", c.Config.HttpPort),
@@ -57,6 +177,16 @@ func (c *CartServer) ListenAndServe() error {
 	return c.server.ListenAndServe()
 }
 
+// RunEvents sends cart events to Kafka until ctx is done, it returns at once if events are not published.
+// Cancel ctx after Shutdown, so events of the last requests are sent too.
+func (c *CartServer) RunEvents(ctx context.Context) error {
+	if c.events == nil {
+		return nil
+	}
+
+	return c.events.Run(ctx)
+}
+
 func (c *CartServer) Shutdown(ctx context.Context) error {
 	return c.server.Shutdown(ctx)
 }
@@ -0,0 +1,196 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"log"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+const (
+	eventSent    = "sent"
+	eventDropped = "dropped"
+	eventFailed  = "failed"
+)
+
+var cartEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "cart",
+	Subsystem: "events",
+	Name:      "total",
+	Help:      "Number of cart events by result: sent to Kafka, dropped on a full buffer or failed to be encoded (and dropped) or sent (and kept to be sent again).",
+}, []string{"result"})
+
+type EventSender interface {
+	SendMessages(msgs []*sarama.ProducerMessage) error
+	Close() error
+}
+
+// EventProducer sends cart events to Kafka in the background, so requests never wait for Kafka.
+// Published events are buffered in memory and sent in batches by Run. Events Kafka fails to take
+// are kept and sent again on the next flush, while the buffer is full new events are dropped.
+// Events of a cart are keyed by its owner: the user id, or "guest:<session>" for guests.
+type EventProducer struct {
+	sender        EventSender
+	topic         string
+	events        chan models.CartEvent
+	bufferSize    int
+	batchSize     int
+	flushInterval time.Duration
+}
+
+func NewEventProducer(sender EventSender, topic string, bufferSize int, batchSize int, flushInterval time.Duration) *EventProducer {
+	return &EventProducer{
+		sender:        sender,
+		topic:         topic,
+		events:        make(chan models.CartEvent, bufferSize),
+		bufferSize:    bufferSize,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+	}
+}
+
+// Publish buffers the event without blocking, the event is dropped if the buffer is full.
+func (producer *EventProducer) Publish(ctx context.Context, event models.CartEvent) {
+	select {
+	case producer.events <- event:
+	default:
+		cartEvents.WithLabelValues(eventDropped).Inc()
+		log.Printf("[events] buffer is full, %s of cart %s is dropped", event.Type, event.Key())
+	}
+}
+
+// Run sends the buffered events until ctx is done, then sends what is left and closes the sender.
+func (producer *EventProducer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(producer.flushInterval)
+	defer ticker.Stop()
+
+	pending := make([]models.CartEvent, 0, producer.batchSize)
+	failed := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			pending = append(pending, producer.drain()...)
+			pending, _ = producer.send(pending)
+
+			if len(pending) != 0 {
+				cartEvents.WithLabelValues(eventDropped).Add(float64(len(pending)))
+				log.Printf("[events] %d events are not sent on shutdown", len(pending))
+			}
+
+			return producer.sender.Close()
+		case event := <-producer.events:
+			pending = append(pending, event)
+
+			// the oldest events go first while Kafka is failing
+			if len(pending) > producer.bufferSize {
+				cartEvents.WithLabelValues(eventDropped).Inc()
+				pending = pending[1:]
+			}
+
+			// after a failure the batch waits for the ticker instead of hammering Kafka
+			if len(pending) >= producer.batchSize && !failed {
+				pending, failed = producer.send(pending)
+			}
+		case <-ticker.C:
+			pending, failed = producer.send(pending)
+		}
+	}
+}
+
+// drain returns the events left in the buffer.
+func (producer *EventProducer) drain() []models.CartEvent {
+	var events []models.CartEvent
+
+	for {
+		select {
+		case event := <-producer.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// send sends the events and returns the events Kafka failed to take and whether it failed.
+func (producer *EventProducer) send(events []models.CartEvent) ([]models.CartEvent, bool) {
+	if len(events) == 0 {
+		return events, false
+	}
+
+	messages := make([]*sarama.ProducerMessage, 0, len(events))
+	encoded := events[:0]
+
+	for _, event := range events {
+		message, err := producer.message(event)
+
+		// the event is not sent again as it can't be encoded anyway
+		if err != nil {
+			cartEvents.WithLabelValues(eventFailed).Inc()
+			log.Printf("[events] %s of cart %s is dropped: %v", event.Type, event.Key(), err)
+			continue
+		}
+
+		messages = append(messages, message)
+		encoded = append(encoded, event)
+	}
+
+	events = encoded
+
+	err := producer.sender.SendMessages(messages)
+
+	if err == nil {
+		cartEvents.WithLabelValues(eventSent).Add(float64(len(messages)))
+		return events[:0], false
+	}
+
+	log.Printf("[events] send events: %v", err)
+
+	var producerErrs sarama.ProducerErrors
+
+	// the messages that are not in the errors are already sent
+	if !errors.As(err, &producerErrs) {
+		cartEvents.WithLabelValues(eventFailed).Add(float64(len(events)))
+		return events, true
+	}
+
+	failed := make([]models.CartEvent, 0, len(producerErrs))
+
+	for _, producerErr := range producerErrs {
+		if event, ok := producerErr.Msg.Metadata.(models.CartEvent); ok {
+			failed = append(failed, event)
+		}
+	}
+
+	cartEvents.WithLabelValues(eventSent).Add(float64(len(messages) - len(failed)))
+	cartEvents.WithLabelValues(eventFailed).Add(float64(len(failed)))
+
+	return failed, true
+}
+
+func (producer *EventProducer) message(event models.CartEvent) (*sarama.ProducerMessage, error) {
+	value, err := json.Marshal(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: producer.topic,
+		Key:   sarama.StringEncoder(event.Key()),
+		Value: sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{
+			{
+				Key:   []byte("event_type"),
+				Value: []byte(event.Type),
+			},
+		},
+		Metadata:  event,
+		Timestamp: event.Time,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"route256.ozon.ru/project/cart/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySender keeps sent messages, failing tells which messages of the next call fail.
+type memorySender struct {
+	mx      sync.Mutex
+	sent    []*sarama.ProducerMessage
+	failing func(msg *sarama.ProducerMessage) bool
+	closed  bool
+}
+
+func (s *memorySender) SendMessages(msgs []*sarama.ProducerMessage) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var errs sarama.ProducerErrors
+
+	for _, msg := range msgs {
+		if s.failing != nil && s.failing(msg) {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: errors.New("broker is not available")})
+			continue
+		}
+
+		s.sent = append(s.sent, msg)
+	}
+
+	s.failing = nil
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (s *memorySender) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+func (s *memorySender) sentEvents(t *testing.T) []models.CartEvent {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	events := make([]models.CartEvent, len(s.sent))
+
+	for i, msg := range s.sent {
+		value, err := msg.Value.Encode()
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(value, &events[i]))
+
+		key, err := msg.Key.Encode()
+		require.NoError(t, err)
+		require.Equal(t, events[i].Key(), string(key))
+		require.Equal(t, []sarama.RecordHeader{{Key: []byte("event_type"), Value: []byte(events[i].Type)}}, msg.Headers)
+	}
+
+	return events
+}
+
+func runEventProducer(producer *EventProducer) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_ = producer.Run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestEventProducer_SendsOnShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	sender := &memorySender{}
+	producer := NewEventProducer(sender, "cart.events", 10, 100, time.Hour)
+	stop := runEventProducer(producer)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	events := []models.CartEvent{
+		{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 2, Time: now},
+		{Type: models.EventCleared, Session: "0123456789abcdef", Time: now},
+	}
+
+	for _, event := range events {
+		producer.Publish(context.Background(), event)
+	}
+
+	stop()
+
+	require.Equal(t, events, sender.sentEvents(t))
+	require.True(t, sender.closed)
+}
+
+func TestEventProducer_ResendsFailedEvents(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	sender := &memorySender{
+		failing: func(msg *sarama.ProducerMessage) bool {
+			return msg.Metadata.(models.CartEvent).SkuId == 2
+		},
+	}
+	producer := NewEventProducer(sender, "cart.events", 10, 2, 10*time.Millisecond)
+	stop := runEventProducer(producer)
+	defer stop()
+
+	producer.Publish(context.Background(), models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 1})
+	producer.Publish(context.Background(), models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 2, Count: 1})
+
+	require.Eventually(t, func() bool {
+		return len(sender.sentEvents(t)) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	sent := sender.sentEvents(t)
+	require.Equal(t, int64(1), sent[0].SkuId)
+	require.Equal(t, int64(2), sent[1].SkuId)
+}
+
+func TestEventProducer_DropsOnFullBuffer(t *testing.T) {
+	t.Parallel()
+
+	producer := NewEventProducer(&memorySender{}, "cart.events", 1, 1, time.Hour)
+
+	producer.Publish(context.Background(), models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 1})
+	producer.Publish(context.Background(), models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 2})
+
+	require.Len(t, producer.events, 1)
+	require.Equal(t, int64(1), (<-producer.events).SkuId)
+}
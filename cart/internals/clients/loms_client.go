@@ -2,18 +2,31 @@ package clients
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"route256.ozon.ru/project/cart/internals/infra/breaker"
 	"route256.ozon.ru/project/cart/models"
 	desc "route256.ozon.ru/project/cart/pkg/api/order/v1"
 	"time"
 )
 
+// IdempotencyKeyHeader is the gRPC metadata key LOMS deduplicates OrderCreate by.
+const IdempotencyKeyHeader = "idempotency-key"
+
+// ErrOutOfStock is returned when LOMS refuses to create an order because stocks can't be reserved.
+var ErrOutOfStock = errors.New("loms: products are out of stock")
+
 type LomsClient struct {
-	client desc.OrderClient
+	client  desc.OrderClient
+	breaker *breaker.Breaker
 }
 
-func NewLomsClient(address string) (*LomsClient, error) {
+func NewLomsClient(address string, circuitBreaker *breaker.Breaker) (*LomsClient, error) {
 	connection, err := grpc.Dial(
 		address,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -24,17 +37,30 @@ func NewLomsClient(address string) (*LomsClient, error) {
 	}
 
 	return &LomsClient{
-		client: desc.NewOrderClient(connection),
+		client:  desc.NewOrderClient(connection),
+		breaker: circuitBreaker,
 	}, nil
 }
 
-func (lomsClient *LomsClient) CreateOrder(ctx context.Context, userId int64, items []models.Product) (int64, error) {
+// IsLomsFailure tells the failures of LOMS from its business errors like "out of stock",
+// so only the former open the circuit breaker.
+func IsLomsFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+
+	return false
+}
+
+func (lomsClient *LomsClient) CreateOrder(ctx context.Context, userId int64, items []models.Product, idempotencyKey string) (int64, error) {
 	orderItems := make([]*desc.OrderItem, len(items))
 
 	for i, item := range items {
 		orderItems[i] = &desc.OrderItem{
 			Sku:   uint32(item.SkuId),
 			Count: uint32(item.Count),
+			Price: item.Price,
 		}
 	}
 
@@ -43,10 +69,23 @@ func (lomsClient *LomsClient) CreateOrder(ctx context.Context, userId int64, ite
 		Items: orderItems,
 	}
 
+	if idempotencyKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, IdempotencyKeyHeader, idempotencyKey)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	response, err := lomsClient.client.OrderCreate(ctx, request)
+	var response *desc.OrderCreateResponse
+
+	err := lomsClient.execute(func() (err error) {
+		response, err = lomsClient.client.OrderCreate(ctx, request)
+		return err
+	})
+
+	if status.Code(err) == codes.FailedPrecondition {
+		return 0, fmt.Errorf("%w: %w", ErrOutOfStock, err)
+	}
 
 	if err != nil {
 		return 0, err
@@ -61,7 +100,12 @@ func (lomsClient *LomsClient) GetStockInfo(ctx context.Context, skuId int64) (ui
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	response, err := lomsClient.client.StocksInfo(ctx, request)
+	var response *desc.StocksInfoResponse
+
+	err := lomsClient.execute(func() (err error) {
+		response, err = lomsClient.client.StocksInfo(ctx, request)
+		return err
+	})
 
 	if err != nil {
 		return 0, err
@@ -69,3 +113,64 @@ func (lomsClient *LomsClient) GetStockInfo(ctx context.Context, skuId int64) (ui
 
 	return response.Count, err
 }
+
+// GetStocksInfo returns available stocks by sku ids in one request, unknown skus have no stocks.
+func (lomsClient *LomsClient) GetStocksInfo(ctx context.Context, skuIds []int64) (map[int64]uint64, error) {
+	if len(skuIds) == 0 {
+		return map[int64]uint64{}, nil
+	}
+
+	request := &desc.StocksInfoBatchRequest{Skus: make([]uint32, len(skuIds))}
+
+	for i, skuId := range skuIds {
+		request.Skus[i] = uint32(skuId)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var response *desc.StocksInfoBatchResponse
+
+	err := lomsClient.execute(func() (err error) {
+		response, err = lomsClient.client.StocksInfoBatch(ctx, request)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	stocks := make(map[int64]uint64, len(skuIds))
+
+	for _, skuId := range skuIds {
+		stocks[skuId] = 0
+	}
+
+	for _, stock := range response.Stocks {
+		stocks[int64(stock.Sku)] = stock.Count
+	}
+
+	return stocks, nil
+}
+
+func (lomsClient *LomsClient) CancelOrder(ctx context.Context, orderId int64) error {
+	request := &desc.OrderCancelRequest{OrderID: orderId}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return lomsClient.execute(func() error {
+		_, err := lomsClient.client.OrderCancel(ctx, request)
+		return err
+	})
+}
+
+func (lomsClient *LomsClient) execute(call func() error) error {
+	err := lomsClient.breaker.Execute(call)
+
+	if errors.Is(err, breaker.ErrOpen) {
+		return fmt.Errorf("%w: loms: %w", ErrDependencyUnavailable, err)
+	}
+
+	return err
+}
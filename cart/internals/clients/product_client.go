@@ -5,28 +5,44 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"route256.ozon.ru/project/cart/config"
+	"route256.ozon.ru/project/cart/internals/infra/breaker"
+	"route256.ozon.ru/project/cart/internals/infra/errgrp"
+	"route256.ozon.ru/project/cart/internals/infra/limiter"
+	"route256.ozon.ru/project/cart/internals/infra/retry"
+	"route256.ozon.ru/project/cart/internals/infra/singleflight"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type ProductClient struct {
-	client *http.Client
-	cacher Cacher
+	client        *http.Client
+	cacher        Cacher
+	limiter       *limiter.Limiter
+	flights       singleflight.Group[int64, ProductInfo]
+	getProductUrl string
+	token         string
+	timeout       time.Duration
+	breaker       *breaker.Breaker
 }
 
 type Cacher interface {
 	Add(ctx context.Context, key string, value []byte) error
 	Get(ctx context.Context, key string) ([]byte, error)
-	Lock()
-	Unlock()
+	GetMany(ctx context.Context, keys []string) ([][]byte, error)
+	GetStale(ctx context.Context, key string) ([]byte, error)
 }
 
 type ProductInfo struct {
 	Name  string `json:"name" redis:"name"`
 	Price uint32 `json:"price" redis:"price"`
+	// Stale is set when the product service has failed and the product is taken from the expired cache
+	Stale bool `json:"-" redis:"-"`
 }
 
 type productRequest struct {
@@ -35,82 +51,192 @@ type productRequest struct {
 }
 
 const (
-	token         = "testtoken"
-	baseUrl       = "http://route256.pavl.uk:8080"
-	getProductUrl = baseUrl + "/get_product"
+	getProductPath = "/get_product"
+
+	// the product service allows 10 requests per second, the burst lets a batch send its concurrent fetches at once
+	defaultRequestsPerSecond = 10
+	defaultRequestsBurst     = maxConcurrentFetches
+	maxConcurrentFetches     = 10
 )
 
 var (
-	ErrProductNotFound = errors.New("product is not found")
+	ErrProductNotFound       = errors.New("product is not found")
+	ErrDependencyUnavailable = errors.New("dependency is unavailable")
 )
 
-func NewProductClient(cacher Cacher) *ProductClient {
+// NewProductClient limits requests to the service by conf.Rps and conf.Burst, unset ones default to the service limit.
+func NewProductClient(conf config.ProductServiceConfig, cacher Cacher, circuitBreaker *breaker.Breaker) *ProductClient {
+	rps, burst := conf.Rps, conf.Burst
+
+	if rps <= 0 {
+		rps = defaultRequestsPerSecond
+	}
+
+	if burst <= 0 {
+		burst = defaultRequestsBurst
+	}
+
 	return &ProductClient{
 		client: &http.Client{
-			Transport: &retryRoundTripper{proxy: http.DefaultTransport},
+			Transport: retry.NewTransport(http.DefaultTransport, retry.WithAttempts(conf.Retries)),
 		},
-		cacher: cacher,
+		cacher:        cacher,
+		limiter:       limiter.NewLimiter(float64(rps), burst),
+		getProductUrl: conf.BaseUrl + getProductPath,
+		token:         conf.Token,
+		timeout:       conf.Timeout,
+		breaker:       circuitBreaker,
 	}
 }
 
-type retryRoundTripper struct {
-	proxy http.RoundTripper
+// IsProductServiceFailure tells the product service failures from the answers that it works fine,
+// so only the former open the circuit breaker.
+func IsProductServiceFailure(err error) bool {
+	return !errors.Is(err, ErrProductNotFound) && !errors.Is(err, context.Canceled)
 }
 
 func (p *ProductClient) GetProduct(ctx context.Context, skuId int64) (ProductInfo, error) {
-	var product ProductInfo
-	var buf bytes.Buffer
-
-	p.cacher.Lock()
-	defer p.cacher.Unlock()
+	start := time.Now()
 
 	if cachedResult := p.getCachedResult(ctx, skuId); cachedResult != nil {
+		observeGetProduct(cacheHit, start)
 		return *cachedResult, nil
 	}
 
-	err := json.NewEncoder(&buf).Encode(productRequest{token, uint32(skuId)})
+	defer observeGetProduct(cacheMiss, start)
+
+	product, err := p.loadProduct(ctx, skuId)
 
 	if err != nil {
-		return product, err
+		return p.fallbackToStale(ctx, skuId, err)
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	return product, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, getProductUrl, &buf)
+// GetProducts returns products by sku ids. Cached products are read in one request to the cache,
+// the rest are fetched from the product service concurrently within its rate limit.
+// The call is timed as a hit only if every product is cached.
+func (p *ProductClient) GetProducts(ctx context.Context, skuIds []int64) (map[int64]ProductInfo, error) {
+	products := make(map[int64]ProductInfo, len(skuIds))
 
-	if err != nil {
-		return product, err
+	if len(skuIds) == 0 {
+		return products, nil
 	}
 
-	resp, err := p.client.Do(req)
+	start := time.Now()
+	misses := p.getCachedResults(ctx, skuIds, products)
 
-	if err != nil {
-		return product, err
+	if len(misses) == 0 {
+		observeGetProduct(cacheHit, start)
+		return products, nil
 	}
 
-	defer resp.Body.Close()
+	defer observeGetProduct(cacheMiss, start)
 
-	if resp.StatusCode == http.StatusNotFound {
-		return product, ErrProductNotFound
+	var mx sync.Mutex
+
+	g, ctxWithCancel := errgrp.WithContext(ctx)
+	g.SetLimit(maxConcurrentFetches)
+
+	for _, skuId := range misses {
+		g.Go(func() error {
+			product, err := p.loadProduct(ctxWithCancel, skuId)
+
+			if err != nil {
+				product, err = p.fallbackToStale(ctxWithCancel, skuId, err)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			mx.Lock()
+			products[skuId] = product
+			mx.Unlock()
+
+			return nil
+		})
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return product, errors.New("failed to get product info: status code is not ok")
+	if err := g.Wait(); err != nil {
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return products, nil
+}
 
-	if err != nil {
+// loadProduct fetches a product missing in the cache. Concurrent loads of the same sku
+// share one request to the product service and one cache write.
+func (p *ProductClient) loadProduct(ctx context.Context, skuId int64) (ProductInfo, error) {
+	return p.flights.Do(ctx, skuId, func(ctx context.Context) (ProductInfo, error) {
+		return p.fetchProduct(ctx, skuId)
+	})
+}
+
+// fallbackToStale returns the expired cached product instead of the product service failure
+// and refreshes the product in the background. Other errors are returned as is.
+func (p *ProductClient) fallbackToStale(ctx context.Context, skuId int64, err error) (ProductInfo, error) {
+	var product ProductInfo
+
+	if !IsProductServiceFailure(err) {
 		return product, err
 	}
 
-	var productInfo ProductInfo
+	cachedResult, cacheErr := p.cacher.GetStale(ctx, strconv.Itoa(int(skuId)))
 
-	err = json.Unmarshal(body, &productInfo)
+	if cacheErr != nil || cachedResult == nil {
+		return product, err
+	}
+
+	if json.Unmarshal(cachedResult, &product) != nil {
+		return ProductInfo{}, err
+	}
+
+	productCacheRequests.WithLabelValues(cacheStale).Inc()
+	log.Printf("[cache] serve stale product %d: %v", skuId, err)
+
+	p.refreshProduct(ctx, skuId)
+
+	product.Stale = true
+
+	return product, nil
+}
+
+// refreshProduct fetches the product in the background within the request timeout of the service.
+// Nothing is started while the product is being loaded already, so a stale product is refreshed once at a time.
+func (p *ProductClient) refreshProduct(ctx context.Context, skuId int64) {
+	p.flights.Start(ctx, skuId, func(ctx context.Context) (ProductInfo, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		product, err := p.fetchProduct(ctx, skuId)
+
+		if err != nil {
+			log.Printf("[cache] refresh stale product %d: %v", skuId, err)
+		}
 
-	if err != nil {
 		return product, err
+	})
+}
+
+func (p *ProductClient) fetchProduct(ctx context.Context, skuId int64) (ProductInfo, error) {
+	var product ProductInfo
+	var body []byte
+
+	err := p.breaker.Execute(func() error {
+		productInfo, rawProduct, err := p.requestProduct(ctx, skuId)
+		product, body = productInfo, rawProduct
+
+		return err
+	})
+
+	if errors.Is(err, breaker.ErrOpen) {
+		return ProductInfo{}, fmt.Errorf("%w: product service: %w", ErrDependencyUnavailable, err)
+	}
+
+	if err != nil {
+		return ProductInfo{}, err
 	}
 
 	err = p.cacher.Add(ctx, strconv.Itoa(int(skuId)), body)
@@ -119,58 +245,126 @@ func (p *ProductClient) GetProduct(ctx context.Context, skuId int64) (ProductInf
 		return ProductInfo{}, err
 	}
 
-	return productInfo, err
+	return product, nil
 }
 
-func (p *ProductClient) getCachedResult(ctx context.Context, skuId int64) *ProductInfo {
+func (p *ProductClient) requestProduct(ctx context.Context, skuId int64) (ProductInfo, []byte, error) {
 	var product ProductInfo
-	cachedResult, err := p.cacher.Get(ctx, strconv.Itoa(int(skuId)))
+	var buf bytes.Buffer
 
-	if err == nil && cachedResult != nil {
-		err := json.Unmarshal(cachedResult, &product)
+	if err := p.limiter.Wait(ctx); err != nil {
+		return product, nil, err
+	}
 
-		if err != nil {
-			log.Println("[cache] get error while parsing", err)
-		}
+	err := json.NewEncoder(&buf).Encode(productRequest{p.token, uint32(skuId)})
 
-		return &product
+	if err != nil {
+		return product, nil, err
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.getProductUrl, &buf)
+
 	if err != nil {
-		log.Println("[cache] get error", err)
+		return product, nil, err
 	}
 
-	return nil
-}
+	resp, err := p.client.Do(req)
+
+	if err != nil {
+		return product, nil, err
+	}
+
+	defer resp.Body.Close()
 
-func (roundTripper *retryRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
-	buf, err := io.ReadAll(r.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return product, nil, ErrProductNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return product, nil, errors.New("failed to get product info: status code is not ok")
+	}
+
+	body, err := io.ReadAll(resp.Body)
 
 	if err != nil {
-		return nil, err
+		return product, nil, err
 	}
 
-	return retry(roundTripper, r, buf, 0)
+	err = json.Unmarshal(body, &product)
+
+	if err != nil {
+		return ProductInfo{}, nil, err
+	}
+
+	return product, body, nil
 }
 
-func retry(roundTripper *retryRoundTripper, request *http.Request, rawBody []byte, count int) (*http.Response, error) {
-	if count == 3 {
-		return nil, errors.New("product service is unavailable")
+func (p *ProductClient) getCachedResult(ctx context.Context, skuId int64) *ProductInfo {
+	var product ProductInfo
+	cachedResult, err := p.cacher.Get(ctx, strconv.Itoa(int(skuId)))
+
+	if err != nil {
+		productCacheRequests.WithLabelValues(cacheError).Inc()
+		log.Println("[cache] get error", err)
+		return nil
+	}
+
+	if cachedResult == nil {
+		productCacheRequests.WithLabelValues(cacheMiss).Inc()
+		return nil
+	}
+
+	if err = json.Unmarshal(cachedResult, &product); err != nil {
+		productCacheRequests.WithLabelValues(cacheError).Inc()
+		log.Println("[cache] get error while parsing", err)
+		return nil
 	}
 
-	request.Body = io.NopCloser(bytes.NewReader(rawBody))
-	request.ContentLength = int64(len(rawBody))
+	productCacheRequests.WithLabelValues(cacheHit).Inc()
+
+	return &product
+}
 
-	response, err := roundTripper.proxy.RoundTrip(request)
+// getCachedResults puts cached products into products and returns sku ids missing in the cache.
+func (p *ProductClient) getCachedResults(ctx context.Context, skuIds []int64, products map[int64]ProductInfo) []int64 {
+	keys := make([]string, len(skuIds))
+
+	for i, skuId := range skuIds {
+		keys[i] = strconv.Itoa(int(skuId))
+	}
+
+	cachedResults, err := p.cacher.GetMany(ctx, keys)
 
 	if err != nil {
-		return nil, err
+		productCacheRequests.WithLabelValues(cacheError).Add(float64(len(skuIds)))
+		log.Println("[cache] get many error", err)
+		return skuIds
 	}
 
-	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == 420 {
-		response.Body.Close()
-		return retry(roundTripper, request, rawBody, count+1)
+	var misses []int64
+
+	for i, skuId := range skuIds {
+		var product ProductInfo
+
+		if cachedResults[i] == nil {
+			productCacheRequests.WithLabelValues(cacheMiss).Inc()
+			misses = append(misses, skuId)
+			continue
+		}
+
+		if err := json.Unmarshal(cachedResults[i], &product); err != nil {
+			productCacheRequests.WithLabelValues(cacheError).Inc()
+			log.Println("[cache] get error while parsing", err)
+			misses = append(misses, skuId)
+			continue
+		}
+
+		productCacheRequests.WithLabelValues(cacheHit).Inc()
+		products[skuId] = product
 	}
 
-	return response, nil
+	return misses
 }
@@ -0,0 +1,546 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"route256.ozon.ru/project/cart/config"
+	"route256.ozon.ru/project/cart/internals/infra/breaker"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryCacher struct {
+	mx     sync.Mutex
+	values map[string][]byte
+	stale  map[string][]byte
+}
+
+func newMemoryCacher() *memoryCacher {
+	return &memoryCacher{
+		values: make(map[string][]byte),
+		stale:  make(map[string][]byte),
+	}
+}
+
+func (c *memoryCacher) Add(_ context.Context, key string, value []byte) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.values[key] = value
+	delete(c.stale, key)
+
+	return nil
+}
+
+func (c *memoryCacher) Get(_ context.Context, key string) ([]byte, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.values[key], nil
+}
+
+func (c *memoryCacher) GetMany(_ context.Context, keys []string) ([][]byte, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	values := make([][]byte, len(keys))
+
+	for i, key := range keys {
+		values[i] = c.values[key]
+	}
+
+	return values, nil
+}
+
+func (c *memoryCacher) GetStale(_ context.Context, key string) ([]byte, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if value, ok := c.values[key]; ok {
+		return value, nil
+	}
+
+	return c.stale[key], nil
+}
+
+// addStale puts the value that is expired but within the grace window.
+func (c *memoryCacher) addStale(key string, value []byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.stale[key] = value
+}
+
+type productServer struct {
+	calls    map[uint32]*atomic.Int64
+	inFlight atomic.Int64
+	release  chan struct{}
+}
+
+// newProductServer answers every sku after release is closed and counts upstream calls per sku.
+func newProductServer(t *testing.T, skuIds ...uint32) (*productServer, *httptest.Server) {
+	ps := &productServer{
+		calls:   make(map[uint32]*atomic.Int64, len(skuIds)),
+		release: make(chan struct{}),
+	}
+
+	for _, skuId := range skuIds {
+		ps.calls[skuId] = &atomic.Int64{}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request productRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path != getProductPath || request.Token != "testtoken" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		calls, ok := ps.calls[request.SkuId]
+
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		calls.Add(1)
+		ps.inFlight.Add(1)
+		<-ps.release
+		ps.inFlight.Add(-1)
+
+		_ = json.NewEncoder(w).Encode(ProductInfo{
+			Name:  fmt.Sprintf("Product %d", request.SkuId),
+			Price: request.SkuId * 10,
+		})
+	}))
+
+	t.Cleanup(server.Close)
+
+	return ps, server
+}
+
+func newTestProductClient(t *testing.T, url string) *ProductClient {
+	client := NewProductClient(config.ProductServiceConfig{
+		BaseUrl: url,
+		Token:   "testtoken",
+		Timeout: time.Second,
+		Retries: 3,
+	}, newMemoryCacher(), breaker.New("product-service", breaker.WithIsFailure(IsProductServiceFailure)))
+
+	return client
+}
+
+func TestProductClient_GetProduct(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should share one upstream call between concurrent callers of the same sku", func(t *testing.T) {
+		t.Parallel()
+
+		ps, server := newProductServer(t, 1)
+		client := newTestProductClient(t, server.URL)
+
+		var wg sync.WaitGroup
+
+		for range 50 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				product, err := client.GetProduct(context.Background(), 1)
+
+				require.NoError(t, err)
+				require.Equal(t, ProductInfo{Name: "Product 1", Price: 10}, product)
+			}()
+		}
+
+		require.Eventually(t, func() bool { return ps.inFlight.Load() == 1 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		close(ps.release)
+		wg.Wait()
+
+		require.Equal(t, int64(1), ps.calls[1].Load())
+	})
+
+	t.Run("should fetch different skus in parallel", func(t *testing.T) {
+		t.Parallel()
+
+		ps, server := newProductServer(t, 1, 2, 3, 4, 5)
+		client := newTestProductClient(t, server.URL)
+
+		var wg sync.WaitGroup
+
+		for skuId := range 5 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := client.GetProduct(context.Background(), int64(skuId+1))
+				require.NoError(t, err)
+			}()
+		}
+
+		require.Eventually(t, func() bool { return ps.inFlight.Load() == 5 }, time.Second, 10*time.Millisecond)
+		close(ps.release)
+		wg.Wait()
+	})
+
+	t.Run("should serve cached product without upstream call", func(t *testing.T) {
+		t.Parallel()
+
+		ps, server := newProductServer(t, 1)
+		client := newTestProductClient(t, server.URL)
+		close(ps.release)
+
+		for range 3 {
+			_, err := client.GetProduct(context.Background(), 1)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int64(1), ps.calls[1].Load())
+	})
+
+	t.Run("should be error if product is not found", func(t *testing.T) {
+		t.Parallel()
+
+		_, server := newProductServer(t)
+		client := newTestProductClient(t, server.URL)
+
+		_, err := client.GetProduct(context.Background(), 1)
+		require.ErrorIs(t, err, ErrProductNotFound)
+	})
+}
+
+func TestProductClient_GetProducts(t *testing.T) {
+	t.Parallel()
+
+	ps, server := newProductServer(t, 1, 2, 3)
+	client := newTestProductClient(t, server.URL)
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			products, err := client.GetProducts(context.Background(), []int64{1, 2, 3})
+
+			require.NoError(t, err)
+			require.Equal(t, map[int64]ProductInfo{
+				1: {Name: "Product 1", Price: 10},
+				2: {Name: "Product 2", Price: 20},
+				3: {Name: "Product 3", Price: 30},
+			}, products)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return ps.inFlight.Load() == 3 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(ps.release)
+	wg.Wait()
+
+	for skuId, calls := range ps.calls {
+		require.Equal(t, int64(1), calls.Load(), "sku %d", skuId)
+	}
+}
+
+func TestProductClient_Metrics(t *testing.T) {
+	ps, server := newProductServer(t, 1, 2)
+	client := newTestProductClient(t, server.URL)
+	close(ps.release)
+
+	hits := testutil.ToFloat64(productCacheRequests.WithLabelValues(cacheHit))
+	misses := testutil.ToFloat64(productCacheRequests.WithLabelValues(cacheMiss))
+	hitLatencies := sampleCount(t, getProductDuration.WithLabelValues(cacheHit))
+	missLatencies := sampleCount(t, getProductDuration.WithLabelValues(cacheMiss))
+
+	_, err := client.GetProduct(context.Background(), 1)
+	require.NoError(t, err)
+
+	_, err = client.GetProduct(context.Background(), 1)
+	require.NoError(t, err)
+
+	_, err = client.GetProducts(context.Background(), []int64{1})
+	require.NoError(t, err)
+
+	_, err = client.GetProducts(context.Background(), []int64{1, 2})
+	require.NoError(t, err)
+
+	require.Equal(t, hits+3, testutil.ToFloat64(productCacheRequests.WithLabelValues(cacheHit)))
+	require.Equal(t, misses+2, testutil.ToFloat64(productCacheRequests.WithLabelValues(cacheMiss)))
+	require.Equal(t, hitLatencies+2, sampleCount(t, getProductDuration.WithLabelValues(cacheHit)))
+	require.Equal(t, missLatencies+2, sampleCount(t, getProductDuration.WithLabelValues(cacheMiss)))
+}
+
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestProductClient_Config(t *testing.T) {
+	t.Parallel()
+
+	newClient := func(t *testing.T, handler http.HandlerFunc, conf config.ProductServiceConfig) *ProductClient {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		conf.BaseUrl = server.URL
+		client := NewProductClient(conf, newMemoryCacher(), breaker.New("product-service"))
+
+		return client
+	}
+
+	rateLimitedTwice := func() http.HandlerFunc {
+		var calls atomic.Int64
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= 2 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(ProductInfo{Name: "Product 1", Price: 10})
+		}
+	}
+
+	t.Run("should retry rate limited requests", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, rateLimitedTwice(), config.ProductServiceConfig{Timeout: time.Second, Retries: 3})
+
+		product, err := client.GetProduct(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, ProductInfo{Name: "Product 1", Price: 10}, product)
+	})
+
+	t.Run("should be error if retries are exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, rateLimitedTwice(), config.ProductServiceConfig{Timeout: time.Second, Retries: 2})
+
+		_, err := client.GetProduct(context.Background(), 1)
+		require.Error(t, err)
+	})
+
+	t.Run("should fetch misses of the batch within the rate limit", func(t *testing.T) {
+		t.Parallel()
+
+		skuIds := make([]int64, 50)
+		serverSkuIds := make([]uint32, 50)
+
+		for i := range skuIds {
+			skuIds[i] = int64(i + 1)
+			serverSkuIds[i] = uint32(i + 1)
+		}
+
+		ps, server := newProductServer(t, serverSkuIds...)
+		close(ps.release)
+
+		client := NewProductClient(config.ProductServiceConfig{
+			BaseUrl: server.URL,
+			Token:   "testtoken",
+			Timeout: time.Second,
+			Retries: 1,
+			Rps:     100,
+			Burst:   10,
+		}, newMemoryCacher(), breaker.New("product-service"))
+
+		start := time.Now()
+		products, err := client.GetProducts(context.Background(), skuIds)
+		elapsed := time.Since(start)
+
+		require.NoError(t, err)
+		require.Len(t, products, 50)
+		// the burst goes at once, the other 40 requests wait for 100 rps
+		require.GreaterOrEqual(t, elapsed, 350*time.Millisecond)
+		require.Less(t, elapsed, time.Second)
+	})
+
+	t.Run("should be error if request exceeds timeout", func(t *testing.T) {
+		t.Parallel()
+
+		client := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}, config.ProductServiceConfig{Timeout: 50 * time.Millisecond, Retries: 3})
+
+		_, err := client.GetProduct(context.Background(), 1)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestProductClient_Breaker(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewProductClient(
+		config.ProductServiceConfig{BaseUrl: server.URL, Timeout: time.Second, Retries: 1},
+		newMemoryCacher(),
+		breaker.New("product-service", breaker.WithFailureThreshold(2), breaker.WithIsFailure(IsProductServiceFailure)),
+	)
+
+	_, err := client.GetProduct(context.Background(), 1)
+	require.ErrorIs(t, err, ErrProductNotFound)
+
+	for range 2 {
+		_, err = client.GetProduct(context.Background(), 1)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrDependencyUnavailable)
+	}
+
+	_, err = client.GetProducts(context.Background(), []int64{1, 2})
+	require.ErrorIs(t, err, ErrDependencyUnavailable)
+	require.Equal(t, int64(3), calls.Load())
+}
+
+func TestProductClient_Stale(t *testing.T) {
+	t.Parallel()
+
+	// newFailingClient fails the first request with status and answers the next ones after release is closed
+	newFailingClient := func(t *testing.T, status int) (*ProductClient, *memoryCacher, chan struct{}) {
+		var calls atomic.Int64
+		release := make(chan struct{})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(status)
+				return
+			}
+
+			<-release
+			_ = json.NewEncoder(w).Encode(ProductInfo{Name: "Product 1", Price: 20})
+		}))
+		t.Cleanup(server.Close)
+
+		cacher := newMemoryCacher()
+		cacher.addStale("1", []byte(`{"name":"Product 1","price":10}`))
+
+		client := NewProductClient(
+			config.ProductServiceConfig{BaseUrl: server.URL, Timeout: time.Second, Retries: 1},
+			cacher,
+			breaker.New("product-service", breaker.WithIsFailure(IsProductServiceFailure)),
+		)
+
+		return client, cacher, release
+	}
+
+	t.Run("should serve stale product and refresh it in the background", func(t *testing.T) {
+		t.Parallel()
+
+		client, cacher, release := newFailingClient(t, http.StatusInternalServerError)
+
+		product, err := client.GetProduct(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, ProductInfo{Name: "Product 1", Price: 10, Stale: true}, product)
+
+		close(release)
+
+		require.Eventually(t, func() bool {
+			value, _ := cacher.Get(context.Background(), "1")
+			return value != nil
+		}, time.Second, 10*time.Millisecond)
+
+		product, err = client.GetProduct(context.Background(), 1)
+		require.NoError(t, err)
+		require.Equal(t, ProductInfo{Name: "Product 1", Price: 20}, product)
+	})
+
+	t.Run("should serve stale products in the batch", func(t *testing.T) {
+		t.Parallel()
+
+		client, _, release := newFailingClient(t, http.StatusInternalServerError)
+		t.Cleanup(func() { close(release) })
+
+		products, err := client.GetProducts(context.Background(), []int64{1})
+		require.NoError(t, err)
+		require.Equal(t, map[int64]ProductInfo{1: {Name: "Product 1", Price: 10, Stale: true}}, products)
+	})
+
+	t.Run("should refresh stale product once at a time within the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int64
+
+		// the first request fails, the refreshes hang until the client gives up
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// the server sees the client giving up only after the body is read
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+		}))
+		t.Cleanup(server.Close)
+
+		cacher := newMemoryCacher()
+		cacher.addStale("1", []byte(`{"name":"Product 1","price":10}`))
+
+		client := NewProductClient(
+			config.ProductServiceConfig{BaseUrl: server.URL, Timeout: 100 * time.Millisecond, Retries: 1},
+			cacher,
+			breaker.New("product-service", breaker.WithIsFailure(IsProductServiceFailure)),
+		)
+
+		product, err := client.GetProduct(context.Background(), 1)
+		require.NoError(t, err)
+		require.True(t, product.Stale)
+
+		require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+		for range 10 {
+			_, err = client.fallbackToStale(context.Background(), 1, ErrDependencyUnavailable)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, int64(2), calls.Load())
+
+		// the refresh is given up after the timeout, so the next stale product is refreshed again
+		require.Eventually(t, func() bool {
+			_, err = client.fallbackToStale(context.Background(), 1, ErrDependencyUnavailable)
+			return calls.Load() == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should not hide that product is not found", func(t *testing.T) {
+		t.Parallel()
+
+		client, _, release := newFailingClient(t, http.StatusNotFound)
+		t.Cleanup(func() { close(release) })
+
+		_, err := client.GetProduct(context.Background(), 1)
+		require.ErrorIs(t, err, ErrProductNotFound)
+	})
+}
@@ -0,0 +1,36 @@
+package clients
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const (
+	cacheHit   = "hit"
+	cacheMiss  = "miss"
+	cacheError = "error"
+	cacheStale = "stale"
+)
+
+var (
+	// hit ratio is rate(cart_product_cache_requests_total{result="hit"}) / rate(cart_product_cache_requests_total)
+	productCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cart",
+		Subsystem: "product_cache",
+		Name:      "requests_total",
+		Help:      "Number of product cache lookups by result: hit, miss, error or stale (served after the product service failure).",
+	}, []string{"result"})
+
+	getProductDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cart",
+		Subsystem: "product_client",
+		Name:      "get_product_duration_seconds",
+		Help:      "Latency of ProductClient.GetProduct and GetProducts by cache result: hit or miss (of any product in the batch).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"cache"})
+)
+
+func observeGetProduct(cache string, start time.Time) {
+	getProductDuration.WithLabelValues(cache).Observe(time.Since(start).Seconds())
+}
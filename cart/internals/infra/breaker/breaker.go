@@ -0,0 +1,238 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 10 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+var (
+	ErrOpen = errors.New("circuit breaker is open")
+)
+
+// Breaker stops calls to a failing dependency. After failureThreshold consecutive failures
+// it opens and rejects calls with ErrOpen without running them. When openTimeout has passed,
+// it lets halfOpenRequests trial calls through: if all of them succeed the breaker closes,
+// the first failure opens it again.
+// Usage example:
+//
+//	b := New("product-service", WithFailureThreshold(3), WithOpenTimeout(5*time.Second))
+//	err := b.Execute(func() error {
+//		return callProductService()
+//	})
+type Breaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	isFailure        func(error) bool
+	now              func() time.Time
+
+	mx        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+	// generation changes with the state, so results of calls started in a previous state are ignored
+	generation uint64
+}
+
+type options struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	isFailure        func(error) bool
+}
+
+type Option func(*options)
+
+// WithFailureThreshold sets how many consecutive failures open the breaker, 5 by default.
+func WithFailureThreshold(failures int) Option {
+	return func(o *options) {
+		o.failureThreshold = failures
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before trial calls, 10s by default.
+func WithOpenTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenRequests sets how many trial calls must succeed to close the breaker, 1 by default.
+func WithHalfOpenRequests(requests int) Option {
+	return func(o *options) {
+		o.halfOpenRequests = requests
+	}
+}
+
+// WithIsFailure sets which errors are failures of the dependency, so errors like "not found"
+// don't open the breaker. By default, every error except context cancellation is a failure.
+func WithIsFailure(isFailure func(error) bool) Option {
+	return func(o *options) {
+		o.isFailure = isFailure
+	}
+}
+
+func New(name string, opts ...Option) *Breaker {
+	o := options{
+		failureThreshold: defaultFailureThreshold,
+		openTimeout:      defaultOpenTimeout,
+		halfOpenRequests: defaultHalfOpenRequests,
+		isFailure: func(err error) bool {
+			return !errors.Is(err, context.Canceled)
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b := &Breaker{
+		name:             name,
+		failureThreshold: max(o.failureThreshold, 1),
+		openTimeout:      o.openTimeout,
+		halfOpenRequests: max(o.halfOpenRequests, 1),
+		isFailure:        o.isFailure,
+		now:              time.Now,
+	}
+
+	stateGauge.WithLabelValues(name).Set(float64(StateClosed))
+
+	return b
+}
+
+// Execute runs fn if the breaker allows it and records the result.
+// It returns ErrOpen without running fn if the breaker is open.
+func (b *Breaker) Execute(fn func() error) error {
+	generation, err := b.allow()
+
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	b.record(generation, err == nil || !b.isFailure(err))
+
+	return err
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refresh()
+
+	return b.state
+}
+
+func (b *Breaker) allow() (uint64, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case StateOpen:
+		return 0, ErrOpen
+	case StateHalfOpen:
+		if b.inFlight >= b.halfOpenRequests {
+			return 0, ErrOpen
+		}
+	}
+
+	b.inFlight++
+
+	return b.generation, nil
+}
+
+func (b *Breaker) record(generation uint64, success bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	b.inFlight--
+
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+
+		b.failures++
+
+		if b.failures >= b.failureThreshold {
+			b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen)
+			return
+		}
+
+		b.successes++
+
+		if b.successes >= b.halfOpenRequests {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// refresh moves the open breaker to half-open when openTimeout has passed.
+func (b *Breaker) refresh() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) setState(state State) {
+	log.Printf("[breaker] %s: %s -> %s", b.name, b.state, state)
+
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.inFlight = 0
+	b.generation++
+
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+
+	stateGauge.WithLabelValues(b.name).Set(float64(state))
+}
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
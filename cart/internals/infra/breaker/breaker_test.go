@@ -0,0 +1,151 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var errFailure = errors.New("dependency is down")
+
+func newTestBreaker(opts ...Option) (*Breaker, *time.Time) {
+	now := time.Now()
+	b := New("test", opts...)
+	b.now = func() time.Time { return now }
+
+	return b, &now
+}
+
+func fail() error {
+	return errFailure
+}
+
+func succeed() error {
+	return nil
+}
+
+func TestBreaker_Execute(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should open after consecutive failures and reject calls", func(t *testing.T) {
+		t.Parallel()
+
+		b, _ := newTestBreaker(WithFailureThreshold(3))
+
+		for range 3 {
+			require.ErrorIs(t, b.Execute(fail), errFailure)
+		}
+
+		require.Equal(t, StateOpen, b.State())
+
+		called := false
+		err := b.Execute(func() error {
+			called = true
+			return nil
+		})
+
+		require.ErrorIs(t, err, ErrOpen)
+		require.False(t, called)
+	})
+
+	t.Run("should reset failures after success", func(t *testing.T) {
+		t.Parallel()
+
+		b, _ := newTestBreaker(WithFailureThreshold(3))
+
+		require.Error(t, b.Execute(fail))
+		require.Error(t, b.Execute(fail))
+		require.NoError(t, b.Execute(succeed))
+		require.Error(t, b.Execute(fail))
+		require.Error(t, b.Execute(fail))
+
+		require.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("should close after successful trial calls", func(t *testing.T) {
+		t.Parallel()
+
+		b, now := newTestBreaker(WithFailureThreshold(1), WithOpenTimeout(time.Second), WithHalfOpenRequests(2))
+
+		require.Error(t, b.Execute(fail))
+		require.Equal(t, StateOpen, b.State())
+
+		*now = now.Add(time.Second)
+		require.Equal(t, StateHalfOpen, b.State())
+
+		require.NoError(t, b.Execute(succeed))
+		require.Equal(t, StateHalfOpen, b.State())
+		require.NoError(t, b.Execute(succeed))
+		require.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("should open again after failed trial call", func(t *testing.T) {
+		t.Parallel()
+
+		b, now := newTestBreaker(WithFailureThreshold(1), WithOpenTimeout(time.Second))
+
+		require.Error(t, b.Execute(fail))
+
+		*now = now.Add(time.Second)
+		require.ErrorIs(t, b.Execute(fail), errFailure)
+		require.Equal(t, StateOpen, b.State())
+		require.ErrorIs(t, b.Execute(succeed), ErrOpen)
+	})
+
+	t.Run("should limit concurrent trial calls", func(t *testing.T) {
+		t.Parallel()
+
+		b, now := newTestBreaker(WithFailureThreshold(1), WithOpenTimeout(time.Second))
+
+		require.Error(t, b.Execute(fail))
+		*now = now.Add(time.Second)
+
+		err := b.Execute(func() error {
+			require.ErrorIs(t, b.Execute(succeed), ErrOpen)
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, StateClosed, b.State())
+	})
+
+	t.Run("should ignore results of calls started before the state changed", func(t *testing.T) {
+		t.Parallel()
+
+		b, now := newTestBreaker(WithFailureThreshold(1), WithOpenTimeout(time.Second))
+
+		err := b.Execute(func() error {
+			require.Error(t, b.Execute(fail))
+			*now = now.Add(time.Second)
+			require.Equal(t, StateHalfOpen, b.State())
+			return errFailure
+		})
+
+		require.ErrorIs(t, err, errFailure)
+		require.Equal(t, StateHalfOpen, b.State())
+	})
+
+	t.Run("should not count errors that are not failures", func(t *testing.T) {
+		t.Parallel()
+
+		errNotFound := errors.New("not found")
+		b, _ := newTestBreaker(WithFailureThreshold(1), WithIsFailure(func(err error) bool {
+			return !errors.Is(err, errNotFound)
+		}))
+
+		require.ErrorIs(t, b.Execute(func() error { return errNotFound }), errNotFound)
+		require.ErrorIs(t, b.Execute(func() error { return context.Canceled }), context.Canceled)
+		require.Equal(t, StateOpen, b.State())
+	})
+
+	t.Run("should not count context cancellation by default", func(t *testing.T) {
+		t.Parallel()
+
+		b, _ := newTestBreaker(WithFailureThreshold(1))
+
+		require.ErrorIs(t, b.Execute(func() error { return context.Canceled }), context.Canceled)
+		require.Equal(t, StateClosed, b.State())
+	})
+}
@@ -0,0 +1,15 @@
+package breaker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	stateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cart",
+		Subsystem: "circuit_breaker",
+		Name:      "state",
+		Help:      "State of the circuit breaker by dependency: 0 is closed, 1 is open, 2 is half-open.",
+	}, []string{"name"})
+)
@@ -7,49 +7,54 @@ import (
 	"time"
 )
 
+// Cacher keeps values in Redis for ttl. With a non-zero grace, values are kept for ttl + grace:
+// Get and GetMany return them only while they're fresh, GetStale returns them until they're removed.
 type Cacher struct {
 	client *redis.Client
 	ttl    time.Duration
-	waitCh chan struct{}
+	grace  time.Duration
 }
 
-func New(ctx context.Context, addr string, ttl time.Duration) *Cacher {
+func New(ctx context.Context, addr string, ttl time.Duration, grace time.Duration) *Cacher {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: "",
 		DB:       0,
 	})
 
-	waitCh := make(chan struct{}, 1)
-	waitCh <- struct{}{}
-
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				close(waitCh)
-				log.Println("[WARNING] cacher is shutting down")
-
-				if err := client.Close(); err != nil {
-					log.Println("[ERROR] close redis client:", err)
-				}
-			default:
-			}
+		<-ctx.Done()
+		log.Println("[WARNING] cacher is shutting down")
+
+		if err := client.Close(); err != nil {
+			log.Println("[ERROR] close redis client:", err)
 		}
 	}()
 
 	return &Cacher{
 		client: client,
 		ttl:    ttl,
-		waitCh: waitCh,
+		grace:  grace,
 	}
 }
 
+// Add overwrites the value, so a refresh replaces the stale one.
 func (c *Cacher) Add(ctx context.Context, key string, value []byte) error {
-	return c.client.SetNX(ctx, key, value, c.ttl).Err()
+	return c.client.Set(ctx, key, value, c.ttl+c.grace).Err()
 }
 
 func (c *Cacher) Get(ctx context.Context, key string) ([]byte, error) {
+	values, err := c.GetMany(ctx, []string{key})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values[0], nil
+}
+
+// GetStale returns the value even if it's expired but still within the grace window.
+func (c *Cacher) GetStale(ctx context.Context, key string) ([]byte, error) {
 	v := c.client.Get(ctx, key)
 	err := v.Err()
 
@@ -66,10 +71,57 @@ func (c *Cacher) Get(ctx context.Context, key string) ([]byte, error) {
 	return b, err
 }
 
-func (c *Cacher) Lock() {
-	<-c.waitCh
+// GetMany returns fresh values of the keys in the same order, nil for missing and stale keys.
+func (c *Cacher) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	values, _, err := c.getManyFresh(ctx, keys)
+	return values, err
 }
 
-func (c *Cacher) Unlock() {
-	c.waitCh <- struct{}{}
+// getManyFresh is GetMany that also returns how long every value stays fresh, 0 for missing values
+// and values without expiration.
+func (c *Cacher) getManyFresh(ctx context.Context, keys []string) ([][]byte, []time.Duration, error) {
+	var values *redis.SliceCmd
+
+	ttls := make([]*redis.DurationCmd, len(keys))
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.MGet(ctx, keys...)
+
+		// the remaining ttl tells whether the value is older than c.ttl
+		for i, key := range keys {
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := make([][]byte, len(keys))
+	freshFor := make([]time.Duration, len(keys))
+
+	for i, value := range values.Val() {
+		str, ok := value.(string)
+
+		if !ok {
+			continue
+		}
+
+		// PTTL is negative for a key without expiration
+		ttl := ttls[i].Val()
+
+		if c.grace > 0 && ttl >= 0 && ttl <= c.grace {
+			continue
+		}
+
+		result[i] = []byte(str)
+
+		if ttl > 0 {
+			freshFor[i] = ttl - c.grace
+		}
+	}
+
+	return result, freshFor, nil
 }
@@ -0,0 +1,47 @@
+package cacher
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCacher_StaleGrace(t *testing.T) {
+	t.Parallel()
+
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c := New(ctx, server.Addr(), time.Minute, time.Hour)
+
+	require.NoError(t, c.Add(ctx, "1", []byte("one")))
+
+	got, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+
+	server.FastForward(2 * time.Minute)
+
+	values, err := c.GetMany(ctx, []string{"1", "2"})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{nil, nil}, values)
+
+	got, err = c.GetStale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+
+	require.NoError(t, c.Add(ctx, "1", []byte("new one")))
+
+	got, err = c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("new one"), got)
+
+	server.FastForward(2 * time.Hour)
+
+	got, err = c.GetStale(ctx, "1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
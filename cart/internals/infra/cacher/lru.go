@@ -0,0 +1,239 @@
+package cacher
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCapacity = 1024
+	defaultShards   = 16
+)
+
+// LRU is an in-memory cache that evicts the least recently used values. Keys are spread over
+// shards, each one is a map of keys to the elements of its own doubly linked list, so
+// concurrent requests for different keys rarely wait for each other.
+// Usage example:
+//
+//	c := NewLRU(WithCapacity(1000), WithShards(8), WithTTL(time.Minute))
+type LRU struct {
+	shards []*lruShard
+	ttl    time.Duration
+	grace  time.Duration
+	now    func() time.Time
+}
+
+type lruShard struct {
+	mx       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+	// removeAt is expiresAt plus the grace window
+	removeAt time.Time
+}
+
+type lruOptions struct {
+	capacity int
+	shards   int
+	ttl      time.Duration
+	grace    time.Duration
+}
+
+type Option func(*lruOptions)
+
+// WithCapacity sets the maximum number of values in the cache, 1024 by default.
+func WithCapacity(capacity int) Option {
+	return func(o *lruOptions) {
+		o.capacity = capacity
+	}
+}
+
+// WithShards sets the number of shards, 16 by default.
+func WithShards(shards int) Option {
+	return func(o *lruOptions) {
+		o.shards = shards
+	}
+}
+
+// WithTTL sets the lifetime of values, they don't expire by default.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *lruOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithStaleGrace keeps expired values for grace more, so GetStale can return them. Only makes sense with WithTTL.
+func WithStaleGrace(grace time.Duration) Option {
+	return func(o *lruOptions) {
+		o.grace = grace
+	}
+}
+
+func NewLRU(opts ...Option) *LRU {
+	options := lruOptions{
+		capacity: defaultCapacity,
+		shards:   defaultShards,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	options.capacity = max(options.capacity, 1)
+	options.shards = min(max(options.shards, 1), options.capacity)
+
+	shards := make([]*lruShard, options.shards)
+
+	for i := range shards {
+		// spread the remainder over the first shards, so the cache never holds more than capacity values
+		capacity := options.capacity / options.shards
+
+		if i < options.capacity%options.shards {
+			capacity++
+		}
+
+		shards[i] = &lruShard{
+			capacity: capacity,
+			items:    make(map[string]*list.Element, capacity),
+			order:    list.New(),
+		}
+	}
+
+	return &LRU{
+		shards: shards,
+		ttl:    options.ttl,
+		grace:  options.grace,
+		now:    time.Now,
+	}
+}
+
+func (c *LRU) Add(_ context.Context, key string, value []byte) error {
+	c.addFor(key, value, 0)
+	return nil
+}
+
+// addFor keeps the value fresh no longer than ttl and the ttl of the cache, a zero ttl sets no extra limit.
+func (c *LRU) addFor(key string, value []byte, ttl time.Duration) {
+	if c.ttl > 0 && (ttl <= 0 || ttl > c.ttl) {
+		ttl = c.ttl
+	}
+
+	var expiresAt time.Time
+
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	c.shard(key).add(key, value, expiresAt, c.grace)
+}
+
+func (c *LRU) Get(_ context.Context, key string) ([]byte, error) {
+	return c.shard(key).get(key, c.now(), 0), nil
+}
+
+// GetStale returns the value even if it's expired but still within the grace window.
+func (c *LRU) GetStale(_ context.Context, key string) ([]byte, error) {
+	return c.shard(key).get(key, c.now(), c.grace), nil
+}
+
+// GetMany returns fresh values of the keys in the same order, nil for missing and stale keys.
+func (c *LRU) GetMany(_ context.Context, keys []string) ([][]byte, error) {
+	now := c.now()
+	values := make([][]byte, len(keys))
+
+	for i, key := range keys {
+		values[i] = c.shard(key).get(key, now, 0)
+	}
+
+	return values, nil
+}
+
+// Len returns the number of values in the cache, including expired ones that are not evicted yet.
+func (c *LRU) Len() int {
+	total := 0
+
+	for _, shard := range c.shards {
+		shard.mx.Lock()
+		total += shard.order.Len()
+		shard.mx.Unlock()
+	}
+
+	return total
+}
+
+func (c *LRU) shard(key string) *lruShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+func (s *lruShard) add(key string, value []byte, expiresAt time.Time, grace time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var removeAt time.Time
+
+	if !expiresAt.IsZero() {
+		removeAt = expiresAt.Add(grace)
+	}
+
+	if element, ok := s.items[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		entry.removeAt = removeAt
+		s.order.MoveToFront(element)
+		return
+	}
+
+	if s.order.Len() >= s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruEntry).key)
+	}
+
+	s.items[key] = s.order.PushFront(&lruEntry{
+		key:       key,
+		value:     value,
+		expiresAt: expiresAt,
+		removeAt:  removeAt,
+	})
+}
+
+// get returns the value if it expires no earlier than grace ago.
+func (s *lruShard) get(key string, now time.Time, grace time.Duration) []byte {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	element, ok := s.items[key]
+
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*lruEntry)
+
+	if !entry.removeAt.IsZero() && now.After(entry.removeAt) {
+		s.order.Remove(element)
+		delete(s.items, key)
+		return nil
+	}
+
+	if !entry.expiresAt.IsZero() && now.After(entry.expiresAt.Add(grace)) {
+		return nil
+	}
+
+	s.order.MoveToFront(element)
+
+	return entry.value
+}
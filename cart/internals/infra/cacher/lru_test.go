@@ -0,0 +1,177 @@
+package cacher
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRU_Eviction(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should evict the least recently added value", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := NewLRU(WithCapacity(2), WithShards(1))
+
+		require.NoError(t, c.Add(ctx, "1", []byte("one")))
+		require.NoError(t, c.Add(ctx, "2", []byte("two")))
+		require.NoError(t, c.Add(ctx, "3", []byte("three")))
+
+		got, err := c.GetMany(ctx, []string{"1", "2", "3"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{nil, []byte("two"), []byte("three")}, got)
+	})
+
+	t.Run("should move the read value to the front", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := NewLRU(WithCapacity(2), WithShards(1))
+
+		require.NoError(t, c.Add(ctx, "1", []byte("one")))
+		require.NoError(t, c.Add(ctx, "2", []byte("two")))
+
+		got, err := c.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), got)
+
+		require.NoError(t, c.Add(ctx, "3", []byte("three")))
+
+		values, err := c.GetMany(ctx, []string{"1", "2", "3"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("one"), nil, []byte("three")}, values)
+	})
+
+	t.Run("should replace the value of the existing key without eviction", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := NewLRU(WithCapacity(2), WithShards(1))
+
+		require.NoError(t, c.Add(ctx, "1", []byte("one")))
+		require.NoError(t, c.Add(ctx, "2", []byte("two")))
+		require.NoError(t, c.Add(ctx, "1", []byte("new one")))
+
+		got, err := c.GetMany(ctx, []string{"1", "2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("new one"), []byte("two")}, got)
+	})
+
+	t.Run("should never hold more values than capacity", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := NewLRU(WithCapacity(100), WithShards(7))
+
+		for i := range 1000 {
+			require.NoError(t, c.Add(ctx, strconv.Itoa(i), []byte("value")))
+		}
+
+		require.LessOrEqual(t, c.Len(), 100)
+	})
+}
+
+func TestLRU_TTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(WithTTL(time.Minute))
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Add(ctx, "1", []byte("one")))
+
+	now = now.Add(59 * time.Second)
+	got, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+
+	now = now.Add(2 * time.Second)
+	got, err = c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.Equal(t, 0, c.Len())
+}
+
+func TestLRU_StaleGrace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(WithTTL(time.Minute), WithStaleGrace(time.Hour))
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Add(ctx, "1", []byte("one")))
+
+	now = now.Add(2 * time.Minute)
+
+	got, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	got, err = c.GetStale(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+
+	require.NoError(t, c.Add(ctx, "1", []byte("new one")))
+
+	got, err = c.Get(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("new one"), got)
+
+	now = now.Add(time.Hour + 2*time.Minute)
+
+	got, err = c.GetStale(ctx, "1")
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.Equal(t, 0, c.Len())
+}
+
+func TestLRU_Defaults(t *testing.T) {
+	t.Parallel()
+
+	c := NewLRU()
+	require.Len(t, c.shards, defaultShards)
+
+	c = NewLRU(WithCapacity(3), WithShards(8))
+	require.Len(t, c.shards, 3)
+}
+
+func TestLRU_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := NewLRU(WithCapacity(64), WithShards(4))
+
+	var wg sync.WaitGroup
+
+	for worker := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range 1000 {
+				key := strconv.Itoa((worker*1000 + i) % 128)
+
+				require.NoError(t, c.Add(ctx, key, []byte(key)))
+
+				got, err := c.Get(ctx, key)
+				require.NoError(t, err)
+
+				if got != nil {
+					require.Equal(t, []byte(key), got)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	require.LessOrEqual(t, c.Len(), 64)
+}
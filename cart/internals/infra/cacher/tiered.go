@@ -0,0 +1,89 @@
+package cacher
+
+import (
+	"context"
+	"log"
+)
+
+// Tiered fronts the shared Redis cache with the local LRU: reads are served from the LRU when
+// possible, and values found only in Redis are copied into it for as long as they stay fresh in Redis,
+// so a copy never outlives the original. Writes go to both tiers.
+type Tiered struct {
+	local  *LRU
+	remote *Cacher
+}
+
+func NewTiered(local *LRU, remote *Cacher) *Tiered {
+	return &Tiered{
+		local:  local,
+		remote: remote,
+	}
+}
+
+func (c *Tiered) Add(ctx context.Context, key string, value []byte) error {
+	_ = c.local.Add(ctx, key, value)
+	return c.remote.Add(ctx, key, value)
+}
+
+func (c *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, _ := c.local.Get(ctx, key); value != nil {
+		return value, nil
+	}
+
+	values, freshFor, err := c.remote.getManyFresh(ctx, []string{key})
+
+	if err != nil || values[0] == nil {
+		return nil, err
+	}
+
+	c.local.addFor(key, values[0], freshFor[0])
+
+	return values[0], nil
+}
+
+// GetStale returns the value even if it's expired but still within the grace window of one of the tiers.
+func (c *Tiered) GetStale(ctx context.Context, key string) ([]byte, error) {
+	if value, _ := c.local.GetStale(ctx, key); value != nil {
+		return value, nil
+	}
+
+	return c.remote.GetStale(ctx, key)
+}
+
+// GetMany reads the keys missing in the LRU from Redis in one request.
+func (c *Tiered) GetMany(ctx context.Context, keys []string) ([][]byte, error) {
+	values, _ := c.local.GetMany(ctx, keys)
+
+	var missingKeys []string
+	var missingIndexes []int
+
+	for i, value := range values {
+		if value == nil {
+			missingKeys = append(missingKeys, keys[i])
+			missingIndexes = append(missingIndexes, i)
+		}
+	}
+
+	if len(missingKeys) == 0 {
+		return values, nil
+	}
+
+	remoteValues, freshFor, err := c.remote.getManyFresh(ctx, missingKeys)
+
+	if err != nil {
+		// the local values are still good, the rest is fetched by the caller
+		log.Println("[cache] remote get many error", err)
+		return values, nil
+	}
+
+	for i, value := range remoteValues {
+		if value == nil {
+			continue
+		}
+
+		values[missingIndexes[i]] = value
+		c.local.addFor(missingKeys[i], value, freshFor[i])
+	}
+
+	return values, nil
+}
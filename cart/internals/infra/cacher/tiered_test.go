@@ -0,0 +1,144 @@
+package cacher
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestTiered(t *testing.T) (*Tiered, *LRU, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	local := NewLRU(WithCapacity(10))
+
+	return NewTiered(local, New(ctx, server.Addr(), time.Minute, 0)), local, server
+}
+
+func TestTiered(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should write to both tiers", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c, local, server := newTestTiered(t)
+
+		require.NoError(t, c.Add(ctx, "1", []byte("one")))
+
+		got, err := local.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), got)
+
+		remote, err := server.Get("1")
+		require.NoError(t, err)
+		require.Equal(t, "one", remote)
+	})
+
+	t.Run("should copy values found only in redis into the local cache", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c, local, server := newTestTiered(t)
+
+		require.NoError(t, server.Set("1", "one"))
+		require.NoError(t, server.Set("2", "two"))
+		require.NoError(t, local.Add(ctx, "3", []byte("three")))
+
+		got, err := c.GetMany(ctx, []string{"1", "2", "3", "4"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("one"), []byte("two"), []byte("three"), nil}, got)
+
+		server.FlushAll()
+
+		got, err = c.GetMany(ctx, []string{"1", "2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("one"), []byte("two")}, got)
+
+		value, err := c.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), value)
+	})
+
+	t.Run("should keep copies of redis values no longer than they stay fresh in redis", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c, local, server := newTestTiered(t)
+		now := time.Now()
+		local.now = func() time.Time { return now }
+
+		// both values were added to redis by another replica 50 seconds ago
+		require.NoError(t, server.Set("1", "one"))
+		server.SetTTL("1", 10*time.Second)
+		require.NoError(t, server.Set("2", "two"))
+		server.SetTTL("2", 10*time.Second)
+
+		value, err := c.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), value)
+
+		got, err := c.GetMany(ctx, []string{"2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("two")}, got)
+
+		now = now.Add(9 * time.Second)
+
+		got, err = local.GetMany(ctx, []string{"1", "2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("one"), []byte("two")}, got)
+
+		now = now.Add(2 * time.Second)
+
+		got, err = local.GetMany(ctx, []string{"1", "2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{nil, nil}, got)
+	})
+
+	t.Run("should keep copies of redis values without expiration for the local ttl", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		server := miniredis.RunT(t)
+		remoteCtx, cancel := context.WithCancel(ctx)
+		t.Cleanup(cancel)
+
+		now := time.Now()
+		local := NewLRU(WithTTL(time.Minute))
+		local.now = func() time.Time { return now }
+		c := NewTiered(local, New(remoteCtx, server.Addr(), time.Minute, 0))
+
+		require.NoError(t, server.Set("1", "one"))
+
+		value, err := c.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), value)
+
+		now = now.Add(59 * time.Second)
+		value, err = local.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), value)
+
+		now = now.Add(2 * time.Second)
+		value, err = local.Get(ctx, "1")
+		require.NoError(t, err)
+		require.Nil(t, value)
+	})
+
+	t.Run("should serve local values when redis is unavailable", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c, local, server := newTestTiered(t)
+
+		require.NoError(t, local.Add(ctx, "1", []byte("one")))
+		server.Close()
+
+		got, err := c.GetMany(ctx, []string{"1", "2"})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("one"), nil}, got)
+	})
+}
@@ -2,18 +2,46 @@ package errgrp
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
 	"sync"
-	"sync/atomic"
 )
 
 // ErrGr is a type that represents an error group. It allows you to run multiple
 // asynchronous tasks concurrently, and wait for all tasks to complete or for an
 // error to occur. If any task returns an error, the Wait() function will return that error.
+// A panic in a task doesn't crash the process, it is returned from Wait() as a *PanicError.
+// Usage example:
+//
+//	g, ctx := WithContext(ctx)
+//	g.SetLimit(10) // at most 10 tasks at once, Go blocks until one of them is done
+//	for _, task := range tasks {
+//		g.Go(func() error { return task(ctx) })
+//	}
+//	err := g.Wait()
 type ErrGr struct {
-	errc   chan error
-	count  atomic.Int64
-	cancel func(error)
-	sync.Mutex
+	wg      sync.WaitGroup
+	sem     chan struct{}
+	errOnce sync.Once
+	err     error
+	cancel  func(error)
+}
+
+// PanicError is a panic recovered in a task of the group.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("errgrp: task panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns the panic value if it is an error, so errors.Is sees through the panic.
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+
+	return err
 }
 
 // WithContext takes a context and returns a new ErrGr and a modified context.
@@ -24,40 +52,92 @@ func WithContext(ctx context.Context) (*ErrGr, context.Context) {
 	return gr, ctx
 }
 
+// SetLimit limits the number of tasks running at once to n, a negative n removes the limit.
+// It must not be called while tasks are running.
+func (errGr *ErrGr) SetLimit(n int) {
+	if n < 0 {
+		errGr.sem = nil
+		return
+	}
+
+	if len(errGr.sem) != 0 {
+		panic(fmt.Errorf("errgrp: modify limit while %v tasks are running", len(errGr.sem)))
+	}
+
+	errGr.sem = make(chan struct{}, n)
+}
+
 // Go runs the specified callback function in a separate goroutine within the ErrGr object.
-// it launches a new goroutine to execute the callback function and sends the result to the error channel.
+// If the limit is reached, it blocks until one of the running tasks is done.
 func (errGr *ErrGr) Go(clb func() error) {
-	errGr.count.Add(1)
+	if errGr.sem != nil {
+		errGr.sem <- struct{}{}
+	}
+
+	errGr.run(clb)
+}
 
-	// there is no constructor, we need to initialize on the first run of the Go method
-	if errGr.errc == nil {
-		errGr.errc = make(chan error, 1)
+// TryGo runs the callback like Go if the limit allows it right now and reports whether it did.
+func (errGr *ErrGr) TryGo(clb func() error) bool {
+	if errGr.sem != nil {
+		select {
+		case errGr.sem <- struct{}{}:
+		default:
+			return false
+		}
 	}
 
+	errGr.run(clb)
+
+	return true
+}
+
+func (errGr *ErrGr) run(clb func() error) {
+	errGr.wg.Add(1)
+
 	go func() {
-		errGr.errc <- clb()
-		errGr.count.Add(-1)
-		if errGr.count.Load() == 0 {
-			close(errGr.errc)
+		defer errGr.done()
+
+		if err := call(clb); err != nil {
+			errGr.errOnce.Do(func() {
+				errGr.err = err
+
+				if errGr.cancel != nil {
+					// cancel ctx to finish all other goroutines
+					errGr.cancel(err)
+				}
+			})
 		}
 	}()
 }
 
+// call turns a panic of the callback into a *PanicError with the stack of the panicking goroutine.
+func call(clb func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+
+	return clb()
+}
+
+func (errGr *ErrGr) done() {
+	if errGr.sem != nil {
+		<-errGr.sem
+	}
+
+	errGr.wg.Done()
+}
+
 // Wait waits for all the goroutines launched with the Go method to finish and returns the first non-nil error encountered.
-// It closes the error channel to signal that no more errors will be received.
 func (errGr *ErrGr) Wait() error {
-	var firstErr error
+	errGr.wg.Wait()
 
-	for curErr := range errGr.errc {
-		if curErr != nil && firstErr == nil {
-			firstErr = curErr
-
-			if errGr.cancel != nil {
-				// cancel ctx to finish all other goroutines
-				errGr.cancel(curErr)
-			}
-		}
+	if errGr.cancel != nil {
+		// release the context, the first error is already its cause
+		errGr.cancel(errGr.err)
 	}
 
-	return firstErr
+	return errGr.err
 }
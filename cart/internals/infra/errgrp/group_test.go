@@ -1,10 +1,12 @@
 package errgrp
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 	"math/rand"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -67,3 +69,152 @@ func TestGr_HaveErrors(t *testing.T) {
 
 	require.Fail(t, "No errors")
 }
+
+func TestGr_NoTasks(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var g ErrGr
+
+	require.NoError(t, g.Wait())
+}
+
+func TestGr_CancelOnFirstError(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wantErr := errors.New("error")
+	g, ctx := WithContext(context.Background())
+
+	g.Go(func() error {
+		return wantErr
+	})
+
+	g.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.ErrorIs(t, g.Wait(), wantErr)
+	require.ErrorIs(t, context.Cause(ctx), wantErr)
+}
+
+func TestGr_SetLimit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	tests := []struct {
+		name  string
+		limit int
+		tasks int
+	}{
+		{"should run one task at a time", 1, 10},
+		{"should run up to limit tasks at once", 3, 30},
+		{"should run all tasks when limit is bigger", 50, 20},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			var running, maxRunning, finished atomic.Int64
+			var g ErrGr
+
+			g.SetLimit(test.limit)
+
+			for range test.tasks {
+				g.Go(func() error {
+					current := running.Add(1)
+
+					for {
+						seen := maxRunning.Load()
+
+						if current <= seen || maxRunning.CompareAndSwap(seen, current) {
+							break
+						}
+					}
+
+					time.Sleep(time.Millisecond)
+					running.Add(-1)
+					finished.Add(1)
+
+					return nil
+				})
+			}
+
+			require.NoError(t, g.Wait())
+			require.Equal(t, int64(test.tasks), finished.Load())
+			require.LessOrEqual(t, maxRunning.Load(), int64(test.limit))
+		})
+	}
+}
+
+func TestGr_TryGo(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var g ErrGr
+
+	release := make(chan struct{})
+	g.SetLimit(2)
+
+	for range 2 {
+		require.True(t, g.TryGo(func() error {
+			<-release
+			return nil
+		}))
+	}
+
+	require.False(t, g.TryGo(func() error {
+		return nil
+	}), "the limit is reached")
+
+	close(release)
+	require.NoError(t, g.Wait())
+
+	require.True(t, g.TryGo(func() error {
+		return nil
+	}), "the limit is released")
+	require.NoError(t, g.Wait())
+}
+
+func TestGr_Panic(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	wantErr := errors.New("panic error")
+
+	tests := []struct {
+		name      string
+		value     any
+		wantError error
+	}{
+		{"should recover panic with value", "boom", nil},
+		{"should recover panic with error", wantErr, wantErr},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			g, ctx := WithContext(context.Background())
+
+			g.Go(func() error {
+				panicTask(test.value)
+				return nil
+			})
+
+			err := g.Wait()
+
+			var panicErr *PanicError
+
+			require.ErrorAs(t, err, &panicErr)
+			require.Equal(t, test.value, panicErr.Value)
+			require.Contains(t, string(panicErr.Stack), "panicTask")
+			require.ErrorIs(t, context.Cause(ctx), err)
+
+			if test.wantError != nil {
+				require.ErrorIs(t, err, test.wantError)
+			}
+		})
+	}
+}
+
+func panicTask(value any) {
+	panic(value)
+}
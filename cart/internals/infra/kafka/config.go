@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+type Config struct {
+	Brokers []string
+}
+
+func PrepareConfig(opts ...Option) *sarama.Config {
+	c := sarama.NewConfig()
+
+	// events of a key go to one partition to keep their order
+	{
+		c.Producer.Partitioner = sarama.NewHashPartitioner
+	}
+
+	{
+		c.Producer.RequiredAcks = sarama.WaitForAll
+	}
+
+	// exactly once semantics
+	{
+		c.Producer.Idempotent = true
+	}
+
+	{
+		c.Producer.Retry.Max = 2
+		c.Producer.Retry.Backoff = 100 * time.Millisecond
+	}
+
+	{
+		c.Net.MaxOpenRequests = 1
+	}
+
+	{
+		c.Producer.CompressionLevel = sarama.CompressionLevelDefault
+		c.Producer.Compression = sarama.CompressionGZIP
+	}
+
+	// a SyncProducer requires both and reads the channels itself
+	{
+		c.Producer.Return.Successes = true
+		c.Producer.Return.Errors = true
+	}
+
+	for _, opt := range opts {
+		_ = opt.Apply(c)
+	}
+
+	return c
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Keyed keeps a Limiter per key, e.g. per user. Buckets that have refilled completely
+// are dropped from time to time, they are recreated on the next request with the same key.
+type Keyed struct {
+	mx        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*Limiter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return newKeyed(rate, burst, time.Now)
+}
+
+func newKeyed(rate float64, burst int, now func() time.Time) *Keyed {
+	return &Keyed{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Limiter),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+// Allow takes a token from the bucket of the key if there is one.
+// Otherwise, it returns how long to wait for the next token.
+func (k *Keyed) Allow(key string) (bool, time.Duration) {
+	return k.bucket(key, k.now()).AllowOrDelay()
+}
+
+func (k *Keyed) bucket(key string, now time.Time) *Limiter {
+	k.mx.Lock()
+	defer k.mx.Unlock()
+
+	k.sweep(now)
+
+	bucket, ok := k.buckets[key]
+
+	if !ok {
+		bucket = newLimiter(k.rate, k.burst, k.now)
+		k.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// sweep drops full buckets not more often than it takes to refill an empty one.
+func (k *Keyed) sweep(now time.Time) {
+	if k.rate <= 0 {
+		return
+	}
+
+	refillTime := time.Duration(float64(k.burst) / k.rate * float64(time.Second))
+
+	if now.Sub(k.lastSweep) < refillTime {
+		return
+	}
+
+	for key, bucket := range k.buckets {
+		if bucket.full(now) {
+			delete(k.buckets, key)
+		}
+	}
+
+	k.lastSweep = now
+}
+
+// Len returns the number of buckets in use.
+func (k *Keyed) Len() int {
+	k.mx.Lock()
+	defer k.mx.Unlock()
+
+	return len(k.buckets)
+}
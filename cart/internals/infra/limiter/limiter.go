@@ -2,55 +2,191 @@ package limiter
 
 import (
 	"context"
+	"errors"
+	"math"
+	"sync"
 	"time"
 )
 
-// Limiter represents a rate limiter that allows a maximum number of requests to be executed within a given time period.
+// Limiter is a token bucket: it allows rate requests per second on average and bursts of up to burst requests.
+// Tokens are refilled smoothly as time passes, so there is no background goroutine and nothing to stop.
 // Usage example:
 //
-//	l := NewLimiter(1*time.Second, 5) // Creates a limiter that allows 5 requests per second
-//	l.Wait()                          // Blocks until a request can be executed
+//	l := NewLimiter(5, 1)           // 5 requests per second, one at a time
+//	if err := l.Wait(ctx); err != nil {
+//		return err              // ctx is done before a token is available
+//	}
 type Limiter struct {
-	maxReq   uint
-	throttle chan struct{}
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
 }
 
-func NewLimiter(t time.Duration, maxReq uint) (*Limiter, func()) {
-	l := &Limiter{
-		maxReq:   maxReq,
-		throttle: make(chan struct{}, maxReq),
+// Reservation holds tokens taken in advance, they can be used after Delay.
+type Reservation struct {
+	limiter   *Limiter
+	tokens    float64
+	timeToAct time.Time
+	ok        bool
+	canceled  bool
+}
+
+// ErrUnreachable is returned by Wait when the limiter allows no requests at all.
+var ErrUnreachable = errors.New("limiter: rate is zero, tokens are never available")
+
+const infiniteDelay = time.Duration(math.MaxInt64)
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return newLimiter(rate, burst, time.Now)
+}
+
+func newLimiter(rate float64, burst int, now func() time.Time) *Limiter {
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// Allow takes a token if there is one right now.
+func (l *Limiter) Allow() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.refill(l.now())
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true
+	}
+
+	return false
+}
+
+// AllowOrDelay takes a token if there is one. Otherwise, it returns how long to wait for the next token.
+func (l *Limiter) AllowOrDelay() (bool, time.Duration) {
+	r := l.Reserve(1)
+	delay := r.Delay()
+
+	if delay == 0 {
+		return true, 0
+	}
+
+	r.Cancel()
+
+	return false, delay
+}
+
+// Reserve takes n tokens in advance, even if the bucket goes into debt.
+// The caller must wait for Delay before acting or Cancel the reservation.
+func (l *Limiter) Reserve(n int) *Reservation {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+	l.refill(now)
+
+	if l.rate <= 0 && l.tokens < float64(n) {
+		return &Reservation{limiter: l}
+	}
+
+	l.tokens -= float64(n)
+
+	return &Reservation{
+		limiter:   l,
+		tokens:    float64(n),
+		timeToAct: now.Add(l.durationFor(-l.tokens)),
+		ok:        true,
 	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r := l.Reserve(1)
+
+	if !r.OK() {
+		return ErrUnreachable
+	}
+
+	delay := r.Delay()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
+func (l *Limiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+}
 
-	go func() {
-		// don't wait for t to run first requests on initialization
-		l.runBatch()
-		timer := time.NewTicker(t)
+// durationFor returns how long it takes to refill the tokens.
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
 
-		for range timer.C {
-			select {
-			case <-ctx.Done():
-				timer.Stop()
-				close(l.throttle)
-				return // stop making requests if limiter was stopped using cancel()
-			default:
-				l.runBatch()
-			}
-		}
-	}()
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
 
-	return l, cancel
+// full reports whether the limiter has refilled completely, so it behaves like a new one.
+func (l *Limiter) full(now time.Time) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	l.refill(now)
+
+	return l.tokens >= l.burst
 }
 
-// Wait blocks until a request can be executed within the rate limit.
-func (l *Limiter) Wait() {
-	<-l.throttle
+// OK is false when the tokens can never be available.
+func (r *Reservation) OK() bool {
+	return r.ok
 }
 
-// runBatch refills the throttle channel to represent the maximum number of allowed requests.
-func (l *Limiter) runBatch() {
-	for range l.maxReq {
-		l.throttle <- struct{}{}
+// Delay returns how long to wait before acting on the reservation.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return infiniteDelay
 	}
+
+	return max(r.timeToAct.Sub(r.limiter.now()), 0)
+}
+
+// Cancel gives the tokens back if the reservation has not come due yet.
+func (r *Reservation) Cancel() {
+	l := r.limiter
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if !r.ok || r.canceled || !l.now().Before(r.timeToAct) {
+		return
+	}
+
+	r.canceled = true
+	l.refill(l.now())
+	l.tokens = min(l.burst, l.tokens+r.tokens)
 }
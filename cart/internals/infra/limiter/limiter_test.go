@@ -1,81 +1,209 @@
 package limiter
 
 import (
+	"context"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
-	"sync/atomic"
 	"testing"
 	"time"
 )
 
-type inputData struct {
-	maxRequests       int
-	totalRequests     int
-	interval          time.Duration
-	wantExecutedTasks int
-	after             time.Duration
+type fakeClock struct {
+	now time.Time
 }
 
-func TestLimiter_NumberOfRequests(t *testing.T) {
-	defer goleak.VerifyNone(t)
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := newLimiter(2, 3, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		require.True(t, l.Allow(), "burst request %d", i)
+	}
+
+	require.False(t, l.Allow())
+
+	// tokens are refilled smoothly, not in batches
+	clock.Advance(250 * time.Millisecond)
+	require.False(t, l.Allow())
+
+	clock.Advance(250 * time.Millisecond)
+	require.True(t, l.Allow())
+
+	// a long pause refills no more than the burst
+	clock.Advance(time.Hour)
+
+	for i := 0; i < 3; i++ {
+		require.True(t, l.Allow(), "burst request %d after pause", i)
+	}
+
+	require.False(t, l.Allow())
+}
+
+func TestLimiter_AllowOrDelay(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := newLimiter(2, 1, clock.Now)
+
+	ok, delay := l.AllowOrDelay()
+	require.True(t, ok)
+	require.Zero(t, delay)
+
+	ok, delay = l.AllowOrDelay()
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, delay)
+
+	// the rejected request doesn't push the next token further
+	ok, delay = l.AllowOrDelay()
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, delay)
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	t.Parallel()
 
 	tests := []struct {
 		name      string
-		inputData inputData
+		rate      float64
+		burst     int
+		reserve   []int
+		wantDelay time.Duration
+		wantOk    bool
 	}{
 		{
-			"should run first tasks immediately",
-			inputData{
-				maxRequests:       2,
-				totalRequests:     10,
-				interval:          1 * time.Second,
-				after:             10 * time.Millisecond,
-				wantExecutedTasks: 2,
-			},
+			name:      "should reserve within burst without delay",
+			rate:      10,
+			burst:     5,
+			reserve:   []int{5},
+			wantDelay: 0,
+			wantOk:    true,
+		},
+		{
+			name:      "should delay reservation over burst",
+			rate:      10,
+			burst:     5,
+			reserve:   []int{5, 2},
+			wantDelay: 200 * time.Millisecond,
+			wantOk:    true,
 		},
 		{
-			"should run 6 tasks after 1sec",
-			inputData{
-				maxRequests:       2,
-				totalRequests:     10,
-				interval:          500 * time.Millisecond,
-				after:             1050 * time.Millisecond,
-				wantExecutedTasks: 6,
-			},
+			name:      "should queue reservations after each other",
+			rate:      10,
+			burst:     1,
+			reserve:   []int{1, 1, 1},
+			wantDelay: 200 * time.Millisecond,
+			wantOk:    true,
 		},
 		{
-			"should run all tasks at once",
-			inputData{
-				maxRequests:       10,
-				totalRequests:     6,
-				interval:          500 * time.Millisecond,
-				after:             10 * time.Millisecond,
-				wantExecutedTasks: 6,
-			},
+			name:      "should not reserve with zero rate",
+			rate:      0,
+			burst:     1,
+			reserve:   []int{1, 1},
+			wantDelay: infiniteDelay,
+			wantOk:    false,
 		},
 	}
 
 	for _, test := range tests {
 		test := test
-		var gotSuccessfulRequests atomic.Int64
 
-		limiter, cancel := NewLimiter(test.inputData.interval, uint(test.inputData.maxRequests))
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
 
-		go func() {
-			_ = time.AfterFunc(test.inputData.after, func() {
-				require.Equal(t, int64(test.inputData.wantExecutedTasks), gotSuccessfulRequests.Load())
-			})
-		}()
+			clock := &fakeClock{now: time.Unix(0, 0)}
+			l := newLimiter(test.rate, test.burst, clock.Now)
 
-		for range test.inputData.totalRequests {
-			limiter.Wait()
+			var r *Reservation
 
-			go func() {
-				gotSuccessfulRequests.Add(1)
-			}()
-		}
+			for _, n := range test.reserve {
+				r = l.Reserve(n)
+			}
 
-		cancel()
-		time.Sleep(100 * time.Millisecond)
+			require.Equal(t, test.wantOk, r.OK())
+			require.Equal(t, test.wantDelay, r.Delay())
+		})
 	}
 }
+
+func TestLimiter_ReserveCancel(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	l := newLimiter(1, 1, clock.Now)
+
+	require.True(t, l.Allow())
+
+	r := l.Reserve(1)
+	require.Equal(t, time.Second, r.Delay())
+
+	r.Cancel()
+	r.Cancel()
+
+	require.Equal(t, time.Second, l.Reserve(1).Delay(), "canceled tokens are given back once")
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	l := NewLimiter(20, 1)
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+
+	// the first token is at hand, the next two take 50ms each
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestLimiter_WaitContext(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	l := NewLimiter(1, 1)
+	require.True(t, l.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(t, l.Wait(canceled), context.Canceled)
+	require.ErrorIs(t, NewLimiter(0, 0).Wait(context.Background()), ErrUnreachable)
+}
+
+func TestKeyed_Allow(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	k := newKeyed(1, 1, clock.Now)
+
+	ok, _ := k.Allow("1")
+	require.True(t, ok)
+
+	ok, retryAfter := k.Allow("1")
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+
+	ok, _ = k.Allow("2")
+	require.True(t, ok, "users are limited separately")
+	require.Equal(t, 2, k.Len())
+
+	clock.Advance(2 * time.Second)
+
+	ok, _ = k.Allow("1")
+	require.True(t, ok)
+	require.Equal(t, 1, k.Len(), "the full bucket of user 2 is dropped")
+}
@@ -0,0 +1,220 @@
+package retry
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAttempts  = 3
+	defaultBaseDelay = 100 * time.Millisecond
+	defaultMaxDelay  = 2 * time.Second
+
+	defaultMaxRetryAfter = 10 * time.Second
+)
+
+// defaultStatuses are rate limiting (420 is sent by the product service) and temporary server errors.
+var defaultStatuses = []int{
+	420,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Transport is an http.RoundTripper that resends a request after transport errors and retryable
+// status codes. It waits between attempts with exponential backoff and jitter, or as long as
+// the Retry-After header asks but no longer than the max Retry-After wait and the request deadline,
+// and gives up as soon as the request context is done.
+// Usage example:
+//
+//	client := &http.Client{
+//		Transport: retry.NewTransport(http.DefaultTransport, retry.WithAttempts(5)),
+//	}
+type Transport struct {
+	next          http.RoundTripper
+	attempts      int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxRetryAfter time.Duration
+	statuses      map[int]struct{}
+}
+
+type options struct {
+	attempts      int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxRetryAfter time.Duration
+	statuses      []int
+}
+
+type Option func(*options)
+
+// WithAttempts sets how many times a request is sent at most, 3 by default.
+func WithAttempts(attempts int) Option {
+	return func(o *options) {
+		o.attempts = attempts
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the maximum delay, 100ms and 2s by default.
+func WithBackoff(baseDelay, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.baseDelay = baseDelay
+		o.maxDelay = maxDelay
+	}
+}
+
+// WithMaxRetryAfter sets the longest wait the Retry-After header may ask for, 10s by default.
+func WithMaxRetryAfter(maxRetryAfter time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryAfter = maxRetryAfter
+	}
+}
+
+// WithStatuses replaces the status codes that are retried, 420, 429, 500, 502, 503 and 504 by default.
+func WithStatuses(statuses ...int) Option {
+	return func(o *options) {
+		o.statuses = statuses
+	}
+}
+
+func NewTransport(next http.RoundTripper, opts ...Option) *Transport {
+	o := options{
+		attempts:      defaultAttempts,
+		baseDelay:     defaultBaseDelay,
+		maxDelay:      defaultMaxDelay,
+		maxRetryAfter: defaultMaxRetryAfter,
+		statuses:      defaultStatuses,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	statuses := make(map[int]struct{}, len(o.statuses))
+
+	for _, status := range o.statuses {
+		statuses[status] = struct{}{}
+	}
+
+	return &Transport{
+		next:          next,
+		attempts:      max(o.attempts, 1),
+		baseDelay:     o.baseDelay,
+		maxDelay:      o.maxDelay,
+		maxRetryAfter: o.maxRetryAfter,
+		statuses:      statuses,
+	}
+}
+
+// RoundTrip returns the first response that shouldn't be retried. When attempts are over,
+// it returns the last response or transport error as is.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if r.Body != nil && r.Body != http.NoBody {
+		rawBody, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = rawBody
+	}
+
+	ctx := r.Context()
+
+	for attempt := 0; ; attempt++ {
+		request := r.Clone(ctx)
+
+		if body != nil {
+			request.Body = io.NopCloser(bytes.NewReader(body))
+			request.ContentLength = int64(len(body))
+		}
+
+		response, err := t.next.RoundTrip(request)
+
+		if err == nil && !t.retryable(response.StatusCode) {
+			return response, nil
+		}
+
+		if attempt+1 == t.attempts || ctx.Err() != nil {
+			return response, err
+		}
+
+		delay := t.backoff(attempt)
+
+		if response != nil {
+			if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+				delay = min(retryAfter, t.maxRetryAfter)
+			}
+
+			// the body must be read to the end to reuse the connection
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+
+		// the request fails at the deadline anyway, so the timer isn't set any later
+		if deadline, ok := ctx.Deadline(); ok {
+			delay = min(delay, max(time.Until(deadline), 0))
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *Transport) retryable(status int) bool {
+	_, ok := t.statuses[status]
+	return ok
+}
+
+// backoff doubles the delay with every attempt and randomizes it in [delay/2, delay],
+// so clients that failed at the same moment don't retry at the same moment.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.maxDelay
+
+	if attempt < 32 {
+		delay = min(t.baseDelay<<attempt, t.maxDelay)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+
+	return half + rand.N(delay-half+1)
+}
+
+// parseRetryAfter supports both forms of the header: delay in seconds and HTTP date.
+// A delay too long for time.Duration is cut to the longest one.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(min(int64(seconds), math.MaxInt64/int64(time.Second))) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
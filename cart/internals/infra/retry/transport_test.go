@@ -0,0 +1,255 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newServer answers with statuses one by one and then with 200, recording the request bodies.
+func newServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int64, chan string) {
+	var calls atomic.Int64
+	bodies := make(chan string, len(statuses)+1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+
+		if int(call) <= len(statuses) {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, &calls, bodies
+}
+
+func newClient(opts ...Option) *http.Client {
+	opts = append([]Option{WithBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+	return &http.Client{Transport: NewTransport(http.DefaultTransport, opts...)}
+}
+
+func TestTransport_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should retry retryable statuses and resend the body", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, bodies := newServer(t, nil, http.StatusTooManyRequests, 420, http.StatusServiceUnavailable)
+
+		response, err := newClient(WithAttempts(4)).Post(server.URL, "application/json", strings.NewReader(`{"sku":1}`))
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, int64(4), calls.Load())
+
+		for range 4 {
+			require.Equal(t, `{"sku":1}`, <-bodies)
+		}
+	})
+
+	t.Run("should return the last response when attempts are over", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+		response, err := newClient(WithAttempts(2)).Get(server.URL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusBadGateway, response.StatusCode)
+		require.Equal(t, int64(2), calls.Load())
+	})
+
+	t.Run("should not retry other statuses", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, nil, http.StatusNotFound)
+
+		response, err := newClient().Get(server.URL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusNotFound, response.StatusCode)
+		require.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("should retry only configured statuses", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, nil, http.StatusNotFound, http.StatusServiceUnavailable)
+
+		response, err := newClient(WithStatuses(http.StatusNotFound)).Get(server.URL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		require.Equal(t, int64(2), calls.Load())
+	})
+
+	t.Run("should wait as long as Retry-After asks", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, http.Header{"Retry-After": {"1"}}, http.StatusTooManyRequests)
+		start := time.Now()
+
+		response, err := newClient().Get(server.URL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, int64(2), calls.Load())
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("should stop waiting when the request context is done", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, http.Header{"Retry-After": {"10"}}, http.StatusTooManyRequests)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		_, err = newClient().Do(request)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("should not wait longer than the max Retry-After wait", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, http.Header{"Retry-After": {"99999999999999"}}, http.StatusTooManyRequests)
+		start := time.Now()
+
+		response, err := newClient(WithMaxRetryAfter(50 * time.Millisecond)).Get(server.URL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, int64(2), calls.Load())
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("should not wait a huge Retry-After past the request deadline", func(t *testing.T) {
+		t.Parallel()
+
+		server, calls, _ := newServer(t, http.Header{"Retry-After": {"99999999999999"}}, http.StatusTooManyRequests)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+
+		start := time.Now()
+
+		_, err = newClient(WithMaxRetryAfter(time.Hour)).Do(request)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int64(1), calls.Load())
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("should retry transport errors", func(t *testing.T) {
+		t.Parallel()
+
+		var calls atomic.Int64
+		transportErr := errors.New("connection reset")
+
+		next := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if calls.Add(1) < 3 {
+				return nil, transportErr
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+		transport := NewTransport(next, WithBackoff(time.Millisecond, time.Millisecond))
+
+		request := httptest.NewRequest(http.MethodGet, "http://product-service/get_product", nil)
+		response, err := transport.RoundTrip(request)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, int64(3), calls.Load())
+
+		calls.Store(0)
+		transport = NewTransport(next, WithAttempts(2), WithBackoff(time.Millisecond, time.Millisecond))
+
+		_, err = transport.RoundTrip(request)
+		require.ErrorIs(t, err, transportErr)
+	})
+}
+
+func TestTransport_Backoff(t *testing.T) {
+	t.Parallel()
+
+	transport := NewTransport(http.DefaultTransport, WithBackoff(100*time.Millisecond, time.Second))
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{attempt: 0, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 1, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 2, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{attempt: 10, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 100, min: 500 * time.Millisecond, max: time.Second},
+	}
+
+	for _, test := range tests {
+		for range 100 {
+			delay := transport.backoff(test.attempt)
+
+			require.GreaterOrEqual(t, delay, test.min)
+			require.LessOrEqual(t, delay, test.max)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	delay, ok := parseRetryAfter("3")
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	require.True(t, ok)
+	require.InDelta(t, time.Hour, delay, float64(2*time.Second))
+
+	// the delay doesn't overflow time.Duration
+	delay, ok = parseRetryAfter("99999999999999")
+	require.True(t, ok)
+	require.Equal(t, time.Duration(math.MaxInt64/int64(time.Second))*time.Second, delay)
+
+	_, ok = parseRetryAfter("")
+	require.False(t, ok)
+
+	_, ok = parseRetryAfter("soon")
+	require.False(t, ok)
+}
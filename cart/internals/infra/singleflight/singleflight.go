@@ -0,0 +1,86 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+// Group coalesces concurrent calls with the same key: while a call for a key is running,
+// other callers with that key wait for its result instead of starting their own.
+// Usage example:
+//
+//	var g Group[string, Product]
+//	product, err := g.Do(ctx, "1", func(ctx context.Context) (Product, error) {
+//		return fetchProduct(ctx, 1)
+//	})
+type Group[K comparable, V any] struct {
+	mx    sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Do runs fn once for all concurrent callers with the same key and returns its result to each of them.
+// fn gets a context that isn't cancelled together with ctx, so the caller that started the call
+// can't fail it for the others. A caller whose ctx is done stops waiting and gets ctx.Err().
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (V, error) {
+	g.mx.Lock()
+
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+
+	c, ok := g.calls[key]
+
+	if !ok {
+		c = &call[V]{done: make(chan struct{})}
+		g.calls[key] = c
+
+		go g.run(context.WithoutCancel(ctx), key, c, fn)
+	}
+
+	g.mx.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		var empty V
+		return empty, ctx.Err()
+	}
+}
+
+// Start runs fn in the background unless a call with the key is running already, then it does nothing.
+// Callers of Do with the key share the started call. Start reports whether it has started the call.
+func (g *Group[K, V]) Start(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) bool {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+
+	if _, ok := g.calls[key]; ok {
+		return false
+	}
+
+	c := &call[V]{done: make(chan struct{})}
+	g.calls[key] = c
+	go g.run(context.WithoutCancel(ctx), key, c, fn)
+
+	return true
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(ctx context.Context) (V, error)) {
+	c.value, c.err = fn(ctx)
+
+	g.mx.Lock()
+	delete(g.calls, key)
+	g.mx.Unlock()
+
+	close(c.done)
+}
@@ -0,0 +1,148 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	t.Run("should share one call between concurrent callers with the same key", func(t *testing.T) {
+		var g Group[string, int]
+		var calls atomic.Int64
+		var wg sync.WaitGroup
+
+		release := make(chan struct{})
+
+		for range 100 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				got, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+					calls.Add(1)
+					<-release
+					return 42, nil
+				})
+
+				require.NoError(t, err)
+				require.Equal(t, 42, got)
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("should run calls with different keys in parallel", func(t *testing.T) {
+		var g Group[int, int]
+		var running atomic.Int64
+		var wg sync.WaitGroup
+
+		release := make(chan struct{})
+
+		for key := range 10 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				got, err := g.Do(context.Background(), key, func(ctx context.Context) (int, error) {
+					running.Add(1)
+					<-release
+					return key, nil
+				})
+
+				require.NoError(t, err)
+				require.Equal(t, key, got)
+			}()
+		}
+
+		require.Eventually(t, func() bool { return running.Load() == 10 }, time.Second, 10*time.Millisecond)
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("should share an error and call again after it", func(t *testing.T) {
+		var g Group[string, int]
+		wantErr := errors.New("upstream is unavailable")
+
+		_, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+			return 0, wantErr
+		})
+		require.ErrorIs(t, err, wantErr)
+
+		got, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+			return 1, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, got)
+	})
+
+	t.Run("should stop waiting when the caller's context is done", func(t *testing.T) {
+		var g Group[string, int]
+
+		release := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := g.Do(ctx, "key", func(ctx context.Context) (int, error) {
+			<-release
+			return 1, ctx.Err()
+		})
+		require.ErrorIs(t, err, context.Canceled)
+
+		close(release)
+
+		got, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+			return 2, nil
+		})
+		require.NoError(t, err)
+		require.Contains(t, []int{1, 2}, got)
+	})
+}
+
+func TestGroup_Start(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var g Group[string, int]
+	var calls atomic.Int64
+	release := make(chan struct{})
+
+	started := g.Start(context.Background(), "key", func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	})
+	require.True(t, started)
+
+	started = g.Start(context.Background(), "key", func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, nil
+	})
+	require.False(t, started)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	got, err := g.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		return 0, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 42, got)
+	require.Equal(t, int64(1), calls.Load())
+}
@@ -6,46 +6,196 @@ import (
 	"errors"
 	"route256.ozon.ru/project/cart/internals/clients"
 	"route256.ozon.ru/project/cart/internals/infra/errgrp"
-	"route256.ozon.ru/project/cart/internals/infra/limiter"
+	"route256.ozon.ru/project/cart/internals/storage"
 	"route256.ozon.ru/project/cart/models"
 	"slices"
+	"time"
 )
 
 type CartService struct {
 	LomsProvider    LomsProvider
 	ProductProvider ProductProvider
 	Store           CartStorage
+	Promos          PromoStorage
+	Events          EventPublisher
+	Checkouts       CheckoutStorage
 }
 
 type ProductProvider interface {
 	GetProduct(ctx context.Context, skuId int64) (clients.ProductInfo, error)
+	GetProducts(ctx context.Context, skuIds []int64) (map[int64]clients.ProductInfo, error)
 }
 
 type LomsProvider interface {
-	CreateOrder(ctx context.Context, userId int64, items []models.Product) (int64, error)
+	CreateOrder(ctx context.Context, userId int64, items []models.Product, idempotencyKey string) (int64, error)
 	GetStockInfo(ctx context.Context, skuId int64) (uint64, error)
+	GetStocksInfo(ctx context.Context, skuIds []int64) (map[int64]uint64, error)
+	CancelOrder(ctx context.Context, orderId int64) error
 }
 
 type CartStorage interface {
-	AddItem(ctx context.Context, userId int64, productId int64, productName string, count uint16) error
-	RemoveItem(ctx context.Context, userId int64, productId int64) error
-	DeleteItemsByUserId(ctx context.Context, userId int64) error
-	GetItemsByUserId(ctx context.Context, userId int64) (map[models.Product]uint16, error)
+	AddItem(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) (uint16, error)
+	RemoveItem(ctx context.Context, owner models.CartOwner, productId int64) error
+	DeleteItemsByOwner(ctx context.Context, owner models.CartOwner) error
+	GetItemsByOwner(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error)
+	SetItemCount(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) error
+	ChangeItemCount(ctx context.Context, owner models.CartOwner, productId int64, delta int32) (uint16, error)
+	SetItemPrices(ctx context.Context, owner models.CartOwner, prices map[int64]uint32) error
+	SetPromoCode(ctx context.Context, owner models.CartOwner, code string) error
+	GetPromoCode(ctx context.Context, owner models.CartOwner) (string, error)
+	MergeItems(ctx context.Context, from models.CartOwner, to models.CartOwner, policy models.MergePolicy) error
+	MoveItem(ctx context.Context, from models.CartOwner, to models.CartOwner, productId int64) (uint16, error)
+}
+
+type PromoStorage interface {
+	CreatePromo(ctx context.Context, promo models.Promo) error
+	UpdatePromo(ctx context.Context, promo models.Promo) error
+	DeletePromo(ctx context.Context, code string) error
+	GetPromo(ctx context.Context, code string) (models.Promo, error)
+	ListPromos(ctx context.Context) ([]models.Promo, error)
+}
+
+// CheckoutStorage keeps the running checkouts and the orders of completed checkouts by idempotency key,
+// all the instances of the service must share it. Both expire after ttl.
+type CheckoutStorage interface {
+	StartCheckout(ctx context.Context, userId int64, ttl time.Duration) (string, bool, error)
+	SetCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) error
+	FinishCheckout(ctx context.Context, userId int64, token string) error
+	GetCheckoutOrder(ctx context.Context, userId int64, key string) (int64, bool, error)
+	SaveCheckoutOrder(ctx context.Context, userId int64, key string, orderId int64, ttl time.Duration) error
+}
+
+// EventPublisher sends cart events to the event stream, Publish must not block the request.
+type EventPublisher interface {
+	Publish(ctx context.Context, event models.CartEvent)
 }
 
 var (
 	ErrProductOutOfStock = errors.New("product is out of stock")
+	ErrPriceChanged      = errors.New("product prices have changed")
 )
 
-func NewCartService(store CartStorage, productProvider ProductProvider, lomsProvider LomsProvider) *CartService {
+// NewCartService returns the cart service, events are not published if events is nil.
+// Checkouts are kept in memory of this instance if checkouts is nil.
+func NewCartService(store CartStorage, productProvider ProductProvider, lomsProvider LomsProvider, promos PromoStorage, events EventPublisher, checkouts CheckoutStorage) *CartService {
+	if events == nil {
+		events = discardEvents{}
+	}
+
+	if checkouts == nil {
+		checkouts = storage.NewInMemoryCheckoutStorage()
+	}
+
 	return &CartService{
-		lomsProvider,
-		productProvider,
-		store,
+		LomsProvider:    lomsProvider,
+		ProductProvider: productProvider,
+		Store:           store,
+		Promos:          promos,
+		Events:          events,
+		Checkouts:       checkouts,
+	}
+}
+
+// SaveProductItem adds count of the product to the cart. Stocks are checked against the total count in the cart.
+// The current price of the product becomes the price the user saw.
+func (service *CartService) SaveProductItem(ctx context.Context, owner models.CartOwner, skuId int64, count uint16) error {
+	item, _, err := service.cartItem(ctx, owner, skuId)
+
+	if err != nil {
+		return err
+	}
+
+	product, err := service.checkProduct(ctx, skuId, uint64(item.Count)+uint64(count))
+
+	if err != nil {
+		return err
+	}
+
+	newCount, err := service.Store.AddItem(ctx, owner, skuId, product.Name, product.Price, count)
+
+	if err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventItemAdded, owner, skuId, newCount)
+	return nil
+}
+
+// SetItemCount sets the count of the product in the cart, 0 removes the product.
+// Stocks are checked and the price the user saw is updated only when the count grows.
+func (service *CartService) SetItemCount(ctx context.Context, owner models.CartOwner, skuId int64, count uint16) error {
+	if count == 0 {
+		return service.DeleteProductItem(ctx, owner, skuId)
+	}
+
+	item, inCart, err := service.cartItem(ctx, owner, skuId)
+
+	if err != nil {
+		return err
+	}
+
+	if inCart && count <= item.Count {
+		if err = service.Store.SetItemCount(ctx, owner, skuId, item.Name, item.Price, count); err != nil {
+			return err
+		}
+
+		if count < item.Count {
+			service.publish(ctx, models.EventItemRemoved, owner, skuId, count)
+		}
+
+		return nil
+	}
+
+	product, err := service.checkProduct(ctx, skuId, uint64(count))
+
+	if err != nil {
+		return err
+	}
+
+	if err = service.Store.SetItemCount(ctx, owner, skuId, product.Name, product.Price, count); err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventItemAdded, owner, skuId, count)
+	return nil
+}
+
+// ChangeItemCount adds the signed delta to the count of the product in the cart and returns the new count.
+// Stocks are checked only when the count grows.
+func (service *CartService) ChangeItemCount(ctx context.Context, owner models.CartOwner, skuId int64, delta int32) (uint16, error) {
+	if delta > 0 {
+		item, inCart, err := service.cartItem(ctx, owner, skuId)
+
+		if err != nil {
+			return 0, err
+		}
+
+		// a product missing in the cart is reported by the storage
+		if inCart {
+			if err = service.checkStock(ctx, skuId, uint64(item.Count)+uint64(delta)); err != nil {
+				return 0, err
+			}
+		}
 	}
+
+	count, err := service.Store.ChangeItemCount(ctx, owner, skuId, delta)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case delta > 0:
+		service.publish(ctx, models.EventItemAdded, owner, skuId, count)
+	case delta < 0:
+		service.publish(ctx, models.EventItemRemoved, owner, skuId, count)
+	}
+
+	return count, nil
 }
 
-func (service *CartService) SaveProductItem(ctx context.Context, userId int64, skuId int64, count uint16) error {
+// checkProduct returns the product if it exists and count of it is in stock.
+func (service *CartService) checkProduct(ctx context.Context, skuId int64, count uint64) (clients.ProductInfo, error) {
 	g, ctxWithCancel := errgrp.WithContext(ctx)
 
 	var product clients.ProductInfo
@@ -62,84 +212,135 @@ func (service *CartService) SaveProductItem(ctx context.Context, userId int64, s
 	})
 
 	g.Go(func() error {
-		availableStocks, err := service.LomsProvider.GetStockInfo(ctxWithCancel, skuId)
+		return service.checkStock(ctxWithCancel, skuId, count)
+	})
 
-		if err != nil {
-			return err
-		}
+	if err := g.Wait(); err != nil {
+		return clients.ProductInfo{}, err
+	}
 
-		if availableStocks < uint64(count) {
-			return ErrProductOutOfStock
-		}
+	return product, nil
+}
 
-		return nil
-	})
+func (service *CartService) checkStock(ctx context.Context, skuId int64, count uint64) error {
+	availableStocks, err := service.LomsProvider.GetStockInfo(ctx, skuId)
 
-	if err := g.Wait(); err != nil {
+	if err != nil {
 		return err
 	}
 
-	return service.Store.AddItem(ctx, userId, skuId, product.Name, count)
+	if availableStocks < count {
+		return ErrProductOutOfStock
+	}
+
+	return nil
 }
 
-func (service *CartService) DeleteCart(ctx context.Context, userId int64) error {
-	return service.Store.DeleteItemsByUserId(ctx, userId)
+// cartItem returns the product with its count if it's in the cart.
+func (service *CartService) cartItem(ctx context.Context, owner models.CartOwner, skuId int64) (models.Product, bool, error) {
+	items, err := service.Store.GetItemsByOwner(ctx, owner)
+
+	if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUserCartEmpty) {
+		return models.Product{}, false, nil
+	}
+
+	if err != nil {
+		return models.Product{}, false, err
+	}
+
+	for item, count := range items {
+		if item.SkuId == skuId {
+			item.Count = count
+			return item, true, nil
+		}
+	}
+
+	return models.Product{}, false, nil
 }
 
-func (service *CartService) DeleteProductItem(ctx context.Context, userId int64, skuId int64) error {
-	return service.Store.RemoveItem(ctx, userId, skuId)
+func (service *CartService) DeleteCart(ctx context.Context, owner models.CartOwner) error {
+	if err := service.Store.DeleteItemsByOwner(ctx, owner); err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventCleared, owner, 0, 0)
+	return nil
+}
+
+func (service *CartService) DeleteProductItem(ctx context.Context, owner models.CartOwner, skuId int64) error {
+	if err := service.Store.RemoveItem(ctx, owner, skuId); err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventItemRemoved, owner, skuId, 0)
+	return nil
 }
 
-func (service *CartService) GetCart(ctx context.Context, userId int64) (uint32, []models.Product, error) {
-	products, err := service.Store.GetItemsByUserId(ctx, userId)
+// GetCart returns the cart at current prices with the discount of the applied promo code.
+func (service *CartService) GetCart(ctx context.Context, owner models.CartOwner) (models.Cart, error) {
+	items, err := service.Store.GetItemsByOwner(ctx, owner)
 
 	if err != nil {
-		return 0, []models.Product{}, err
+		return models.Cart{}, err
 	}
 
-	return service.calculateTotal(ctx, products)
-}
+	subtotal, products, err := service.calculateTotal(ctx, items)
 
-func (service *CartService) calculateTotal(ctx context.Context, products map[models.Product]uint16) (uint32, []models.Product, error) {
-	resultChannel := make(chan models.Product, len(products))
+	if err != nil {
+		return models.Cart{}, err
+	}
 
-	lim, _ := limiter.NewLimiter(1, 10)
-	g, ctxWithCancel := errgrp.WithContext(ctx)
+	cart := newCart(subtotal, products)
+	promo, err := service.appliedPromo(ctx, owner)
 
-	for product, count := range products {
-		lim.Wait()
-		skuId := product.SkuId
+	if err != nil {
+		return models.Cart{}, err
+	}
 
-		g.Go(func() error {
-			productInfo, err := service.ProductProvider.GetProduct(ctxWithCancel, skuId)
+	if promo != nil {
+		// a code that doesn't suit the cart anymore stays applied without a discount
+		cart, _ = withDiscount(cart, *promo)
+	}
 
-			if err != nil {
-				return err
-			}
+	return cart, nil
+}
 
-			resultChannel <- models.Product{
-				SkuId: skuId,
-				Count: count,
-				Name:  productInfo.Name,
-				Price: productInfo.Price,
-			}
+func (service *CartService) calculateTotal(ctx context.Context, products map[models.Product]uint16) (uint32, []models.Product, error) {
+	skuIds := make([]int64, 0, len(products))
 
-			return nil
-		})
+	for product := range products {
+		skuIds = append(skuIds, product.SkuId)
 	}
 
-	if err := g.Wait(); err != nil {
-		close(resultChannel)
+	slices.Sort(skuIds)
+
+	productsInfo, err := service.ProductProvider.GetProducts(ctx, skuIds)
+
+	if err != nil {
 		return 0, []models.Product{}, err
 	}
 
 	total := uint32(0)
 	productsWithPrice := make([]models.Product, len(products))
+	i := 0
+
+	for product, count := range products {
+		productInfo, ok := productsInfo[product.SkuId]
 
-	for i := 0; i < len(products); i++ {
-		result := <-resultChannel
-		productsWithPrice[i] = result
-		total += result.Price * uint32(result.Count)
+		if !ok {
+			return 0, []models.Product{}, clients.ErrProductNotFound
+		}
+
+		productsWithPrice[i] = models.Product{
+			SkuId:        product.SkuId,
+			Count:        count,
+			Name:         productInfo.Name,
+			Price:        productInfo.Price,
+			Stale:        productInfo.Stale,
+			PriceChanged: priceChanged(product.Price, productInfo.Price),
+		}
+		total += productInfo.Price * uint32(count)
+		i++
 	}
 
 	slices.SortFunc(productsWithPrice, func(a, b models.Product) int {
@@ -7,8 +7,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/internals/storage"
 	"route256.ozon.ru/project/cart/models"
 	"testing"
+	"time"
 )
 
 type inputData struct {
@@ -35,6 +37,7 @@ func TestCartService_SaveProductItem(t *testing.T) {
 				count:  1,
 			},
 			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
 				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(wantResult, wantErr)
 				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(10, nil)
 			},
@@ -48,13 +51,14 @@ func TestCartService_SaveProductItem(t *testing.T) {
 				count:  1,
 			},
 			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
 				productInfoMock := clients.ProductInfo{
 					Name:  "Product Name",
 					Price: 100,
 				}
 				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(productInfoMock, nil)
 				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(10, nil)
-				c.AddItemMock.Expect(minimock.AnyContext, input.skuId, input.userId, productInfoMock.Name, input.count).Return(wantErr)
+				c.AddItemMock.Expect(minimock.AnyContext, models.UserCart(input.skuId), input.userId, productInfoMock.Name, productInfoMock.Price, input.count).Return(0, wantErr)
 			},
 			wantErr: errors.New("couldn't save in storage"),
 		},
@@ -66,13 +70,14 @@ func TestCartService_SaveProductItem(t *testing.T) {
 				count:  1,
 			},
 			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
 				productInfoMock := clients.ProductInfo{
 					Name:  "Product Name",
 					Price: 100,
 				}
 				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(productInfoMock, wantErr)
 				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(10, nil)
-				c.AddItemMock.Expect(minimock.AnyContext, input.skuId, input.userId, productInfoMock.Name, input.count).Return(wantErr)
+				c.AddItemMock.Expect(minimock.AnyContext, models.UserCart(input.skuId), input.userId, productInfoMock.Name, productInfoMock.Price, input.count).Return(input.count, wantErr)
 			},
 		},
 		{
@@ -83,6 +88,7 @@ func TestCartService_SaveProductItem(t *testing.T) {
 				count:  10,
 			},
 			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
 				productInfoMock := clients.ProductInfo{
 					Name:  "Product Name",
 					Price: 100,
@@ -100,6 +106,7 @@ func TestCartService_SaveProductItem(t *testing.T) {
 				count:  1,
 			},
 			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
 				productInfoMock := clients.ProductInfo{
 					Name:  "Product Name",
 					Price: 100,
@@ -109,6 +116,20 @@ func TestCartService_SaveProductItem(t *testing.T) {
 			},
 			wantErr: errors.New("stock service is failed"),
 		},
+		{
+			name: "should be err if total count in the cart is out of stock",
+			inputData: inputData{
+				userId: 1,
+				skuId:  1,
+				count:  3,
+			},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product Name"}: 5}, nil)
+				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(clients.ProductInfo{Name: "Product Name", Price: 100}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(7, nil)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
 	}
 
 	for _, test := range tests {
@@ -122,13 +143,164 @@ func TestCartService_SaveProductItem(t *testing.T) {
 			productProviderMock := NewProductProviderMock(mc)
 			lomsProviderMock := NewLomsProviderMock(mc)
 			cartStorageMock := NewCartStorageMock(mc)
-			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
 
 			test.mock(lomsProviderMock, productProviderMock, cartStorageMock, test.inputData, test.result, test.wantErr)
 
-			err := cartService.SaveProductItem(ctx, test.inputData.userId, test.inputData.skuId, test.inputData.count)
+			err := cartService.SaveProductItem(ctx, models.UserCart(test.inputData.userId), test.inputData.skuId, test.inputData.count)
+
+			require.ErrorIs(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestCartService_SetItemCount(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	product := models.Product{SkuId: 1, Name: "Product Name", Price: 90}
+	productInfo := clients.ProductInfo{Name: product.Name, Price: 100}
+
+	tests := []struct {
+		name      string
+		inputData inputData
+		mock      func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, i inputData)
+		wantErr   error
+	}{
+		{
+			name:      "should remove product with 0",
+			inputData: inputData{userId: 1, skuId: 1, count: 0},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.RemoveItemMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId).Return(nil)
+			},
+		},
+		{
+			name:      "should decrease count without checking stocks and keep the price the user saw",
+			inputData: inputData{userId: 1, skuId: 1, count: 2},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{product: 5}, nil)
+				c.SetItemCountMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId, product.Name, product.Price, input.count).Return(nil)
+			},
+		},
+		{
+			name:      "should increase count within stocks",
+			inputData: inputData{userId: 1, skuId: 1, count: 8},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{product: 5}, nil)
+				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(productInfo, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(8, nil)
+				c.SetItemCountMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId, product.Name, productInfo.Price, input.count).Return(nil)
+			},
+		},
+		{
+			name:      "should add product missing in the cart",
+			inputData: inputData{userId: 1, skuId: 1, count: 3},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil, storage.ErrUserNotFound)
+				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(productInfo, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(10, nil)
+				c.SetItemCountMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId, product.Name, productInfo.Price, input.count).Return(nil)
+			},
+		},
+		{
+			name:      "should be err if product out of stock",
+			inputData: inputData{userId: 1, skuId: 1, count: 8},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{product: 5}, nil)
+				p.GetProductMock.Expect(minimock.AnyContext, input.skuId).Return(productInfo, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, input.skuId).Return(7, nil)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			productProviderMock := NewProductProviderMock(mc)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(lomsProviderMock, productProviderMock, cartStorageMock, test.inputData)
+
+			err := cartService.SetItemCount(context.Background(), models.UserCart(test.inputData.userId), test.inputData.skuId, test.inputData.count)
+
+			require.ErrorIs(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestCartService_ChangeItemCount(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	product := models.Product{SkuId: 1, Name: "Product Name"}
+
+	tests := []struct {
+		name      string
+		delta     int32
+		mock      func(l *LomsProviderMock, c *CartStorageMock, delta int32)
+		wantCount uint16
+		wantErr   error
+	}{
+		{
+			name:  "should decrease count without checking stocks",
+			delta: -1,
+			mock: func(l *LomsProviderMock, c *CartStorageMock, delta int32) {
+				c.ChangeItemCountMock.Expect(minimock.AnyContext, models.UserCart(1), 1, delta).Return(4, nil)
+			},
+			wantCount: 4,
+		},
+		{
+			name:  "should increase count within stocks",
+			delta: 3,
+			mock: func(l *LomsProviderMock, c *CartStorageMock, delta int32) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{product: 5}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(8, nil)
+				c.ChangeItemCountMock.Expect(minimock.AnyContext, models.UserCart(1), 1, delta).Return(8, nil)
+			},
+			wantCount: 8,
+		},
+		{
+			name:  "should be err if product out of stock",
+			delta: 3,
+			mock: func(l *LomsProviderMock, c *CartStorageMock, delta int32) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{product: 5}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(7, nil)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
+		{
+			name:  "should be err if product is not in the cart",
+			delta: 1,
+			mock: func(l *LomsProviderMock, c *CartStorageMock, delta int32) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil, storage.ErrUserCartEmpty)
+				c.ChangeItemCountMock.Expect(minimock.AnyContext, models.UserCart(1), 1, delta).Return(0, storage.ErrItemNotFound)
+			},
+			wantErr: storage.ErrItemNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, NewProductProviderMock(mc), lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(lomsProviderMock, cartStorageMock, test.delta)
+
+			count, err := cartService.ChangeItemCount(context.Background(), models.UserCart(1), 1, test.delta)
 
 			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantCount, count)
 		})
 	}
 }
@@ -149,7 +321,7 @@ func TestCartService_DeleteCart(t *testing.T) {
 				userId: 1,
 			},
 			mock: func(c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
-				c.DeleteItemsByUserIdMock.Expect(minimock.AnyContext, input.userId).Return(wantErr)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(wantErr)
 			},
 		},
 		{
@@ -158,7 +330,7 @@ func TestCartService_DeleteCart(t *testing.T) {
 				userId: 1,
 			},
 			mock: func(c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
-				c.DeleteItemsByUserIdMock.Expect(minimock.AnyContext, input.userId).Return(wantErr)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(wantErr)
 			},
 			wantErr: errors.New("failed to delete"),
 		},
@@ -176,11 +348,11 @@ func TestCartService_DeleteCart(t *testing.T) {
 			lomsProviderMock := NewLomsProviderMock(mc)
 			cartStorageMock := NewCartStorageMock(mc)
 
-			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
 
 			test.mock(cartStorageMock, test.inputData, test.result, test.wantErr)
 
-			err := cartService.DeleteCart(ctx, test.inputData.userId)
+			err := cartService.DeleteCart(ctx, models.UserCart(test.inputData.userId))
 
 			require.ErrorIs(t, err, test.wantErr)
 		})
@@ -204,7 +376,7 @@ func TestCartService_DeleteProductItem(t *testing.T) {
 				skuId:  1,
 			},
 			mock: func(p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
-				c.RemoveItemMock.Expect(minimock.AnyContext, input.userId, input.skuId).Return(wantErr)
+				c.RemoveItemMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId).Return(wantErr)
 			},
 			wantErr: errors.New("failed to remove item"),
 		},
@@ -215,7 +387,7 @@ func TestCartService_DeleteProductItem(t *testing.T) {
 				skuId:  1,
 			},
 			mock: func(p *ProductProviderMock, c *CartStorageMock, input inputData, wantResult clients.ProductInfo, wantErr error) {
-				c.RemoveItemMock.Expect(minimock.AnyContext, input.userId, input.skuId).Return(wantErr)
+				c.RemoveItemMock.Expect(minimock.AnyContext, models.UserCart(input.userId), input.skuId).Return(wantErr)
 			},
 		},
 	}
@@ -232,11 +404,11 @@ func TestCartService_DeleteProductItem(t *testing.T) {
 			lomsProviderMock := NewLomsProviderMock(mc)
 			cartStorageMock := NewCartStorageMock(mc)
 
-			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
 
 			test.mock(productProviderMock, cartStorageMock, test.inputData, test.result, test.wantErr)
 
-			err := cartService.DeleteProductItem(ctx, test.inputData.userId, test.inputData.skuId)
+			err := cartService.DeleteProductItem(ctx, models.UserCart(test.inputData.userId), test.inputData.skuId)
 
 			require.ErrorIs(t, err, test.wantErr)
 		})
@@ -264,15 +436,15 @@ func TestCartService_GetCart(t *testing.T) {
 					wantProducts[1]: wantProducts[1].Count,
 					wantProducts[0]: wantProducts[0].Count,
 				}
-				p.GetProductMock.When(minimock.AnyContext, wantProducts[1].SkuId).Then(
-					clients.ProductInfo{Name: wantProducts[1].Name, Price: wantProducts[1].Price},
-					wantErr,
-				)
-				p.GetProductMock.When(minimock.AnyContext, wantProducts[0].SkuId).Then(
-					clients.ProductInfo{Name: wantProducts[0].Name, Price: wantProducts[0].Price},
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{wantProducts[0].SkuId, wantProducts[1].SkuId}).Return(
+					map[int64]clients.ProductInfo{
+						wantProducts[0].SkuId: {Name: wantProducts[0].Name, Price: wantProducts[0].Price},
+						wantProducts[1].SkuId: {Name: wantProducts[1].Name, Price: wantProducts[1].Price},
+					},
 					wantErr,
 				)
-				c.GetItemsByUserIdMock.Expect(minimock.AnyContext, input.userId).Return(productsMap, nil)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(productsMap, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
 			},
 			wantTotal: 700,
 			wantProducts: []models.Product{
@@ -290,13 +462,35 @@ func TestCartService_GetCart(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "should flag products with changed prices",
+			inputData: inputData{
+				userId: 1,
+			},
+			mock: func(p *ProductProviderMock, c *CartStorageMock, input inputData, wantTotal uint32, wantProducts []models.Product, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{
+					{SkuId: 1, Name: "Product name 1", Price: 90}: 1,
+					{SkuId: 2, Name: "Product name 2"}:            1,
+				}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1, 2}).Return(map[int64]clients.ProductInfo{
+					1: {Name: "Product name 1", Price: 100},
+					2: {Name: "Product name 2", Price: 200},
+				}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+			},
+			wantTotal: 300,
+			wantProducts: []models.Product{
+				{SkuId: 1, Name: "Product name 1", Count: 1, Price: 100, PriceChanged: true},
+				{SkuId: 2, Name: "Product name 2", Count: 1, Price: 200},
+			},
+		},
 		{
 			name: "should be failed if user is not found",
 			inputData: inputData{
 				userId: 1,
 			},
 			mock: func(p *ProductProviderMock, c *CartStorageMock, input inputData, wantTotal uint32, wantProducts []models.Product, wantErr error) {
-				c.GetItemsByUserIdMock.Expect(minimock.AnyContext, input.userId).Return(map[models.Product]uint16{}, wantErr)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{}, wantErr)
 			},
 			wantTotal:    0,
 			wantProducts: []models.Product{},
@@ -312,13 +506,26 @@ func TestCartService_GetCart(t *testing.T) {
 					{SkuId: 1, Name: "Product name", Count: 5, Price: 100}: 0,
 				}
 
-				c.GetItemsByUserIdMock.Expect(minimock.AnyContext, input.userId).Return(productsMap, nil)
-				p.GetProductMock.Expect(minimock.AnyContext, 1).Return(clients.ProductInfo{}, wantErr)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(productsMap, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(nil, wantErr)
 			},
 			wantTotal:    0,
 			wantProducts: []models.Product{},
 			wantErr:      errors.New("cart is empty"),
 		},
+		{
+			name: "should be failed if product is missing in the batch",
+			inputData: inputData{
+				userId: 1,
+			},
+			mock: func(p *ProductProviderMock, c *CartStorageMock, input inputData, wantTotal uint32, wantProducts []models.Product, wantErr error) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1}: 1}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{}, nil)
+			},
+			wantTotal:    0,
+			wantProducts: []models.Product{},
+			wantErr:      clients.ErrProductNotFound,
+		},
 	}
 
 	for _, test := range tests {
@@ -333,15 +540,992 @@ func TestCartService_GetCart(t *testing.T) {
 			lomsProviderMock := NewLomsProviderMock(mc)
 			cartStorageMock := NewCartStorageMock(mc)
 
-			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
 
 			test.mock(productProviderMock, cartStorageMock, test.inputData, test.wantTotal, test.wantProducts, test.wantErr)
 
-			total, products, err := cartService.GetCart(ctx, test.inputData.userId)
+			cart, err := cartService.GetCart(ctx, models.UserCart(test.inputData.userId))
+
+			require.ErrorIs(t, err, test.wantErr)
+
+			if test.wantErr == nil {
+				require.Equal(t, test.wantTotal, cart.Total)
+				require.Equal(t, test.wantTotal, cart.Subtotal)
+				require.Equal(t, test.wantProducts, cart.Items)
+			}
+		})
+	}
+}
+
+func TestCartService_Checkout(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	products := []models.Product{
+		{SkuId: 1, Name: "Product name", Count: 2, Price: 100},
+	}
+	cleanupErr := errors.New("storage is unavailable")
+
+	tests := []struct {
+		name        string
+		inputData   inputData
+		mock        func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, i inputData)
+		wantOrderId int64
+		wantErr     error
+	}{
+		{
+			name:      "should be checked out successfully",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(10, nil)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil)
+			},
+			wantOrderId: 10,
+		},
+		{
+			name:      "should be error if prices are stale",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100, Stale: true}}, nil)
+			},
+			wantErr: ErrPricesStale,
+		},
+		{
+			name:      "should be error if order is not created",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(0, errors.New("loms is unavailable"))
+			},
+			wantErr: ErrOrderNotCreated,
+		},
+		{
+			name:      "should retry cart cleanup",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(10, nil)
+				c.DeleteItemsByOwnerMock.Set(func(ctx context.Context, owner models.CartOwner) error {
+					if c.DeleteItemsByOwnerBeforeCounter() == 1 {
+						return cleanupErr
+					}
+					return nil
+				})
+			},
+			wantOrderId: 10,
+		},
+		{
+			name:      "should cancel the order if cart cleanup is failed",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(10, nil)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(cleanupErr)
+				l.CancelOrderMock.Expect(minimock.AnyContext, 10).Return(nil)
+			},
+			wantErr: ErrCheckoutRolledBack,
+		},
+		{
+			name:      "should be error if neither cleanup nor compensation succeeded",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(10, nil)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(cleanupErr)
+				l.CancelOrderMock.Expect(minimock.AnyContext, 10).Return(errors.New("loms is unavailable"))
+			},
+			wantOrderId: 10,
+			wantErr:     ErrCheckoutIncomplete,
+		},
+		{
+			name:      "should be error and update the prices the user saw if prices are changed",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 90}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.SetItemPricesMock.Expect(minimock.AnyContext, models.UserCart(input.userId), map[int64]uint32{1: 100}).Return(nil)
+			},
+			wantErr: ErrPriceChanged,
+		},
+		{
+			name:      "should be checked out at the prices the user saw",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 100}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(10, nil)
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(nil)
+			},
+			wantOrderId: 10,
+		},
+		{
+			name:      "should be error if products are out of stock",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 1}, nil)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
+		{
+			name:      "should be error if stocks are reserved by someone else before the order",
+			inputData: inputData{userId: 1},
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock, input inputData) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(input.userId)).Return("", nil)
+				l.GetStocksInfoMock.Set(func(ctx context.Context, skuIds []int64) (map[int64]uint64, error) {
+					if l.GetStocksInfoBeforeCounter() == 1 {
+						return map[int64]uint64{1: 10}, nil
+					}
+					return map[int64]uint64{1: 0}, nil
+				})
+				l.CreateOrderMock.Expect(minimock.AnyContext, input.userId, products, "").Return(0, clients.ErrOutOfStock)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			productProviderMock := NewProductProviderMock(mc)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(lomsProviderMock, productProviderMock, cartStorageMock, test.inputData)
+
+			orderId, err := cartService.Checkout(context.Background(), test.inputData.userId, "")
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantOrderId, orderId)
+		})
+	}
+
+	t.Run("should be error if checkout is in progress", func(t *testing.T) {
+		t.Parallel()
+
+		mc := minimock.NewController(t)
+		checkouts := storage.NewInMemoryCheckoutStorage()
+		cartService := NewCartService(NewCartStorageMock(mc), NewProductProviderMock(mc), NewLomsProviderMock(mc), NewPromoStorageMock(mc), nil, checkouts)
+
+		// another instance is checking out the cart
+		_, started, err := checkouts.StartCheckout(context.Background(), 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+
+		_, err = cartService.Checkout(context.Background(), 1, "")
+
+		require.ErrorIs(t, err, ErrCheckoutInProgress)
+	})
+
+	t.Run("should be error if checkout storage fails", func(t *testing.T) {
+		t.Parallel()
+
+		mc := minimock.NewController(t)
+		checkoutStorageMock := NewCheckoutStorageMock(mc)
+		cartService := NewCartService(NewCartStorageMock(mc), NewProductProviderMock(mc), NewLomsProviderMock(mc), NewPromoStorageMock(mc), nil, checkoutStorageMock)
+		wantErr := errors.New("storage is not available")
+
+		checkoutStorageMock.StartCheckoutMock.Expect(minimock.AnyContext, 1, checkoutTTL).Return("", false, wantErr)
+
+		_, err := cartService.Checkout(context.Background(), 1, "")
+
+		require.ErrorIs(t, err, wantErr)
+	})
+
+	t.Run("should finish the checkout by its token", func(t *testing.T) {
+		t.Parallel()
+
+		mc := minimock.NewController(t)
+		cartStorageMock := NewCartStorageMock(mc)
+		checkoutStorageMock := NewCheckoutStorageMock(mc)
+		cartService := NewCartService(cartStorageMock, NewProductProviderMock(mc), NewLomsProviderMock(mc), NewPromoStorageMock(mc), nil, checkoutStorageMock)
+
+		checkoutStorageMock.StartCheckoutMock.Expect(minimock.AnyContext, 1, checkoutTTL).Return("token-1", true, nil)
+		cartStorageMock.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil, storage.ErrUserCartEmpty)
+		checkoutStorageMock.FinishCheckoutMock.Expect(minimock.AnyContext, 1, "token-1").Return(nil)
+
+		_, err := cartService.Checkout(context.Background(), 1, "")
+
+		require.ErrorIs(t, err, storage.ErrUserCartEmpty)
+	})
+
+	t.Run("should return the same order for a repeated idempotency key", func(t *testing.T) {
+		t.Parallel()
 
-			require.Equal(t, test.wantTotal, total)
-			require.Equal(t, test.wantProducts, products)
-			require.ErrorIs(t, test.wantErr, err)
+		mc := minimock.NewController(t)
+		productProviderMock := NewProductProviderMock(mc)
+		lomsProviderMock := NewLomsProviderMock(mc)
+		cartStorageMock := NewCartStorageMock(mc)
+		checkouts := storage.NewInMemoryCheckoutStorage()
+		cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, checkouts)
+		// the repeated request goes to another instance sharing the checkouts
+		otherService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), nil, checkouts)
+
+		cartStorageMock.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{{SkuId: 1, Name: "Product name"}: 2}, nil)
+		productProviderMock.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+		cartStorageMock.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1)).Return("", nil)
+		lomsProviderMock.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+		lomsProviderMock.CreateOrderMock.Expect(minimock.AnyContext, 1, products, "checkout-1").Return(10, nil)
+		cartStorageMock.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil)
+
+		orderId, err := cartService.Checkout(context.Background(), 1, "checkout-1")
+		require.NoError(t, err)
+		require.Equal(t, int64(10), orderId)
+
+		orderId, err = otherService.Checkout(context.Background(), 1, "checkout-1")
+		require.NoError(t, err)
+		require.Equal(t, int64(10), orderId)
+		require.Equal(t, uint64(1), lomsProviderMock.CreateOrderAfterCounter())
+	})
+}
+
+func TestCartService_ValidateCart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	items := map[models.Product]uint16{
+		{SkuId: 1, Name: "Product 1"}: 2,
+		{SkuId: 2, Name: "Product 2"}: 5,
+		{SkuId: 3, Name: "Product 3"}: 1,
+	}
+	stocksErr := errors.New("loms is unavailable")
+
+	tests := []struct {
+		name          string
+		mock          func(l *LomsProviderMock, c *CartStorageMock)
+		wantShortages []models.StockShortage
+		wantErr       error
+	}{
+		{
+			name: "should report no shortages",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(items, nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1, 2, 3}).Return(map[int64]uint64{1: 2, 2: 10, 3: 1}, nil)
+			},
+			wantShortages: []models.StockShortage{},
+		},
+		{
+			name: "should report every line short of stocks",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(items, nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1, 2, 3}).Return(map[int64]uint64{1: 1, 2: 10}, nil)
+			},
+			wantShortages: []models.StockShortage{
+				{SkuId: 1, Requested: 2, Available: 1},
+				{SkuId: 3, Requested: 1, Available: 0},
+			},
+		},
+		{
+			name: "should be error if cart is empty",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil, storage.ErrUserCartEmpty)
+			},
+			wantErr: storage.ErrUserCartEmpty,
+		},
+		{
+			name: "should be error if stocks are unavailable",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(items, nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1, 2, 3}).Return(nil, stocksErr)
+			},
+			wantErr: stocksErr,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, NewProductProviderMock(mc), lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(lomsProviderMock, cartStorageMock)
+
+			shortages, err := cartService.ValidateCart(context.Background(), models.UserCart(1))
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantShortages, shortages)
 		})
 	}
 }
+
+func TestCartService_ApplyPromo(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	promo := models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10, MinTotal: 500}
+	items := map[models.Product]uint16{
+		{SkuId: 1, Name: "Product name", Price: 300}: 2,
+	}
+	products := map[int64]clients.ProductInfo{
+		1: {Name: "Product name", Price: 300},
+	}
+
+	tests := []struct {
+		name     string
+		mock     func(p *ProductProviderMock, c *CartStorageMock, s *PromoStorageMock)
+		wantCart models.Cart
+		wantErr  error
+	}{
+		{
+			name: "should apply the code and itemize the discount",
+			mock: func(p *ProductProviderMock, c *CartStorageMock, s *PromoStorageMock) {
+				s.GetPromoMock.Expect(minimock.AnyContext, promo.Code).Return(promo, nil)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(items, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(products, nil)
+				c.SetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1), promo.Code).Return(nil)
+			},
+			wantCart: models.Cart{
+				Items:         []models.Product{{SkuId: 1, Name: "Product name", Count: 2, Price: 300}},
+				Subtotal:      600,
+				Discounts:     []models.Discount{{Code: promo.Code, Type: models.PromoPercentOff, Amount: 60}},
+				Total:         540,
+				PromoCode:     promo.Code,
+				UnitDiscounts: map[int64]uint32{1: 30},
+			},
+		},
+		{
+			name: "should not apply the code below the minimum total",
+			mock: func(p *ProductProviderMock, c *CartStorageMock, s *PromoStorageMock) {
+				s.GetPromoMock.Expect(minimock.AnyContext, promo.Code).Return(promo, nil)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{
+					{SkuId: 1, Name: "Product name", Price: 300}: 1,
+				}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(products, nil)
+			},
+			wantErr: ErrPromoNotApplicable,
+		},
+		{
+			name: "should be failed if the code is not found",
+			mock: func(p *ProductProviderMock, c *CartStorageMock, s *PromoStorageMock) {
+				s.GetPromoMock.Expect(minimock.AnyContext, promo.Code).Return(models.Promo{}, storage.ErrPromoNotFound)
+			},
+			wantErr: storage.ErrPromoNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			productProviderMock := NewProductProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			promoStorageMock := NewPromoStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, NewLomsProviderMock(mc), promoStorageMock, nil, nil)
+
+			test.mock(productProviderMock, cartStorageMock, promoStorageMock)
+
+			cart, err := cartService.ApplyPromo(context.Background(), models.UserCart(1), promo.Code)
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantCart, cart)
+		})
+	}
+}
+
+func TestCartService_CheckoutWithPromo(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	items := map[models.Product]uint16{
+		{SkuId: 1, Name: "First product", Price: 300}:  2,
+		{SkuId: 2, Name: "Second product", Price: 100}: 1,
+	}
+	products := map[int64]clients.ProductInfo{
+		1: {Name: "First product", Price: 300},
+		2: {Name: "Second product", Price: 100},
+	}
+
+	tests := []struct {
+		name        string
+		promo       models.Promo
+		mock        func(l *LomsProviderMock, promo models.Promo)
+		wantOrderId int64
+		wantErr     error
+	}{
+		{
+			name:  "should send the discounted prices to LOMS",
+			promo: models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10},
+			mock: func(l *LomsProviderMock, promo models.Promo) {
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1, 2}).Return(map[int64]uint64{1: 10, 2: 10}, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, 1, []models.Product{
+					{SkuId: 1, Name: "First product", Count: 2, Price: 270},
+					{SkuId: 2, Name: "Second product", Count: 1, Price: 90},
+				}, "").Return(10, nil)
+			},
+			wantOrderId: 10,
+		},
+		{
+			name:    "should be error if the promo code doesn't suit the cart anymore",
+			promo:   models.Promo{Code: "BIG", Type: models.PromoFixedOff, Amount: 100, MinTotal: 1000},
+			mock:    func(l *LomsProviderMock, promo models.Promo) {},
+			wantErr: ErrPromoNotApplicable,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			productProviderMock := NewProductProviderMock(mc)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			promoStorageMock := NewPromoStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, promoStorageMock, nil, nil)
+
+			cartStorageMock.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(items, nil)
+			productProviderMock.GetProductsMock.Expect(minimock.AnyContext, []int64{1, 2}).Return(products, nil)
+			cartStorageMock.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(test.promo.Code, nil)
+			promoStorageMock.GetPromoMock.Expect(minimock.AnyContext, test.promo.Code).Return(test.promo, nil)
+
+			if test.wantErr == nil {
+				cartStorageMock.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil)
+			}
+
+			test.mock(lomsProviderMock, test.promo)
+
+			orderId, err := cartService.Checkout(context.Background(), 1, "")
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantOrderId, orderId)
+		})
+	}
+}
+
+func TestUnitDiscounts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		products      []models.Product
+		amount        uint32
+		wantDiscounts map[int64]uint32
+		wantAmount    uint32
+	}{
+		{
+			name:          "should spread the amount in proportion to prices",
+			products:      []models.Product{{SkuId: 1, Price: 300, Count: 2}, {SkuId: 2, Price: 100, Count: 1}},
+			amount:        70,
+			wantDiscounts: map[int64]uint32{1: 30, 2: 10},
+			wantAmount:    70,
+		},
+		{
+			name:          "should round the unit discount up when the amount doesn't divide",
+			products:      []models.Product{{SkuId: 1, Price: 100, Count: 3}},
+			amount:        10,
+			wantDiscounts: map[int64]uint32{1: 4},
+			wantAmount:    12,
+		},
+		{
+			name:          "should make the products free with the whole subtotal",
+			products:      []models.Product{{SkuId: 1, Price: 100, Count: 3}, {SkuId: 2, Price: 7, Count: 1}},
+			amount:        307,
+			wantDiscounts: map[int64]uint32{1: 100, 2: 7},
+			wantAmount:    307,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			subtotal := uint32(0)
+
+			for _, product := range test.products {
+				subtotal += product.Price * uint32(product.Count)
+			}
+
+			discounts, amount := unitDiscounts(test.products, subtotal, test.amount)
+
+			require.Equal(t, test.wantDiscounts, discounts)
+			require.Equal(t, test.wantAmount, amount)
+		})
+	}
+}
+
+func TestCartService_GetCartWithDeletedPromo(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	mc := minimock.NewController(t)
+	productProviderMock := NewProductProviderMock(mc)
+	cartStorageMock := NewCartStorageMock(mc)
+	promoStorageMock := NewPromoStorageMock(mc)
+	cartService := NewCartService(cartStorageMock, productProviderMock, NewLomsProviderMock(mc), promoStorageMock, nil, nil)
+
+	cartStorageMock.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{{SkuId: 1, Price: 100}: 1}, nil)
+	productProviderMock.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Price: 100}}, nil)
+	cartStorageMock.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1)).Return("GONE", nil)
+	promoStorageMock.GetPromoMock.Expect(minimock.AnyContext, "GONE").Return(models.Promo{}, storage.ErrPromoNotFound)
+
+	cart, err := cartService.GetCart(context.Background(), models.UserCart(1))
+
+	require.NoError(t, err)
+	require.Equal(t, uint32(100), cart.Total)
+	require.Empty(t, cart.Discounts)
+	require.Empty(t, cart.PromoCode)
+}
+
+func TestPromoDiscount(t *testing.T) {
+	t.Parallel()
+
+	products := []models.Product{
+		{SkuId: 1, Price: 100, Count: 5},
+		{SkuId: 2, Price: 50, Count: 2},
+	}
+
+	tests := []struct {
+		name       string
+		promo      models.Promo
+		wantAmount uint32
+		wantErr    error
+	}{
+		{"should take percent off", models.Promo{Type: models.PromoPercentOff, Percent: 15}, 90, nil},
+		{"should take fixed amount off", models.Promo{Type: models.PromoFixedOff, Amount: 250}, 250, nil},
+		{"should not take more than the subtotal", models.Promo{Type: models.PromoFixedOff, Amount: 1000}, 600, nil},
+		{"should make every third product free", models.Promo{Type: models.PromoBuyNGetM, SkuId: 1, BuyCount: 2, FreeCount: 1}, 100, nil},
+		{"should not apply buy n get m without enough products", models.Promo{Type: models.PromoBuyNGetM, SkuId: 2, BuyCount: 2, FreeCount: 1}, 0, ErrPromoNotApplicable},
+		{"should not apply buy n get m to missing product", models.Promo{Type: models.PromoBuyNGetM, SkuId: 3, BuyCount: 1, FreeCount: 1}, 0, ErrPromoNotApplicable},
+		{"should apply at the minimum total", models.Promo{Type: models.PromoFixedOff, Amount: 10, MinTotal: 600}, 10, nil},
+		{"should not apply below the minimum total", models.Promo{Type: models.PromoFixedOff, Amount: 10, MinTotal: 601}, 0, ErrPromoNotApplicable},
+		{"should not apply unknown type", models.Promo{Type: "gift"}, 0, ErrPromoNotApplicable},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			amount, err := promoDiscount(test.promo, products, 600)
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantAmount, amount)
+		})
+	}
+}
+
+func TestCartService_MergeCart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	session := "0123456789abcdef"
+
+	// the guest has no lists
+	mergeNoLists := func(c *CartStorageMock) {
+		for _, list := range models.Lists {
+			c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session).WithList(list), models.UserCart(1).WithList(list), models.MergeMax).Then(storage.ErrUserNotFound)
+		}
+	}
+
+	// userItems returns the items of the user cart before the merge and after it
+	userItems := func(c *CartStorageMock, before map[models.Product]uint16, beforeErr error, after map[models.Product]uint16, afterErr error) {
+		c.GetItemsByOwnerMock.Set(func(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error) {
+			require.Equal(t, models.UserCart(1), owner)
+
+			if c.GetItemsByOwnerBeforeCounter() == 1 {
+				return before, beforeErr
+			}
+
+			return after, afterErr
+		})
+	}
+
+	tests := []struct {
+		name          string
+		mock          func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock)
+		wantCart      models.Cart
+		wantShortages []models.StockShortage
+		wantEvents    []models.CartEvent
+		wantErr       error
+	}{
+		{
+			name: "should return the merged cart",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				mergeNoLists(c)
+				userItems(c, nil, storage.ErrUserNotFound, map[models.Product]uint16{{SkuId: 1, Price: 100}: 2}, nil)
+				c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Then(nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]uint64{1: 10}, nil)
+			},
+			wantCart: models.Cart{
+				Items:     []models.Product{{SkuId: 1, Name: "Product name", Price: 100, Count: 2}},
+				Subtotal:  200,
+				Discounts: []models.Discount{},
+				Total:     200,
+			},
+			wantShortages: []models.StockShortage{},
+			wantEvents: []models.CartEvent{
+				{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 2},
+			},
+		},
+		{
+			name: "should publish only the changed lines and return shortages of the merged counts",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				mergeNoLists(c)
+				userItems(c,
+					map[models.Product]uint16{{SkuId: 1, Price: 100}: 2, {SkuId: 2, Price: 50}: 1}, nil,
+					map[models.Product]uint16{{SkuId: 1, Price: 100}: 5, {SkuId: 2, Price: 50}: 1}, nil,
+				)
+				c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Then(nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1, 2}).Return(map[int64]clients.ProductInfo{
+					1: {Name: "First product", Price: 100},
+					2: {Name: "Second product", Price: 50},
+				}, nil)
+				c.GetPromoCodeMock.Expect(minimock.AnyContext, models.UserCart(1)).Return("", nil)
+				l.GetStocksInfoMock.Expect(minimock.AnyContext, []int64{1, 2}).Return(map[int64]uint64{1: 3, 2: 10}, nil)
+			},
+			wantCart: models.Cart{
+				Items: []models.Product{
+					{SkuId: 1, Name: "First product", Price: 100, Count: 5},
+					{SkuId: 2, Name: "Second product", Price: 50, Count: 1},
+				},
+				Subtotal:  550,
+				Discounts: []models.Discount{},
+				Total:     550,
+			},
+			wantShortages: []models.StockShortage{{SkuId: 1, Requested: 5, Available: 3}},
+			wantEvents: []models.CartEvent{
+				{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 5},
+			},
+		},
+		{
+			name: "should return empty cart if both carts have no products",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				mergeNoLists(c)
+				userItems(c, nil, storage.ErrUserCartEmpty, nil, storage.ErrUserCartEmpty)
+				c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Then(nil)
+			},
+			wantCart:      models.Cart{Items: []models.Product{}, Discounts: []models.Discount{}},
+			wantShortages: []models.StockShortage{},
+		},
+		{
+			name: "should be failed without guest cart",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				mergeNoLists(c)
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil, storage.ErrUserNotFound)
+				c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Then(storage.ErrUserNotFound)
+			},
+			wantErr: ErrGuestCartNotFound,
+		},
+		{
+			name: "should merge lists of the guest without cart",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				for _, list := range models.Lists {
+					var err error
+
+					if list != models.ListWishlist {
+						err = storage.ErrUserNotFound
+					}
+
+					c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session).WithList(list), models.UserCart(1).WithList(list), models.MergeMax).Then(err)
+				}
+
+				userItems(c, nil, storage.ErrUserNotFound, nil, storage.ErrUserNotFound)
+				c.MergeItemsMock.When(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Then(storage.ErrUserNotFound)
+			},
+			wantCart:      models.Cart{Items: []models.Product{}, Discounts: []models.Discount{}},
+			wantShortages: []models.StockShortage{},
+		},
+		{
+			name: "should not merge lists if the cart merge fails",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil, storage.ErrUserNotFound)
+				c.MergeItemsMock.Expect(minimock.AnyContext, models.GuestCart(session), models.UserCart(1), models.MergeMax).Return(storage.ErrItemCountOverflow)
+			},
+			wantErr: storage.ErrItemCountOverflow,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			productProviderMock := NewProductProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			var events EventPublisher
+			var published []models.CartEvent
+
+			if len(test.wantEvents) != 0 {
+				eventPublisherMock := NewEventPublisherMock(mc)
+				eventPublisherMock.PublishMock.Set(func(ctx context.Context, event models.CartEvent) {
+					event.Time = time.Time{}
+					published = append(published, event)
+				})
+				events = eventPublisherMock
+			}
+
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), events, nil)
+
+			test.mock(lomsProviderMock, productProviderMock, cartStorageMock)
+
+			cart, shortages, err := cartService.MergeCart(context.Background(), 1, session, models.MergeMax)
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantCart, cart)
+			require.Equal(t, test.wantShortages, shortages)
+			require.Equal(t, test.wantEvents, published)
+		})
+	}
+}
+
+func TestCartService_MoveToCart(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	product := models.Product{SkuId: 1, Name: "Product Name"}
+	list := models.UserCart(1).WithList(models.ListSavedForLater)
+
+	tests := []struct {
+		name    string
+		mock    func(l *LomsProviderMock, c *CartStorageMock)
+		wantErr error
+	}{
+		{
+			name: "should move product within stocks of the cart and the list",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.When(minimock.AnyContext, list).Then(map[models.Product]uint16{product: 3}, nil)
+				c.GetItemsByOwnerMock.When(minimock.AnyContext, models.UserCart(1)).Then(map[models.Product]uint16{product: 2}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(5, nil)
+				c.MoveItemMock.Expect(minimock.AnyContext, list, models.UserCart(1), 1).Return(5, nil)
+			},
+		},
+		{
+			name: "should be err if product out of stock",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.When(minimock.AnyContext, list).Then(map[models.Product]uint16{product: 3}, nil)
+				c.GetItemsByOwnerMock.When(minimock.AnyContext, models.UserCart(1)).Then(nil, storage.ErrUserNotFound)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(2, nil)
+			},
+			wantErr: ErrProductOutOfStock,
+		},
+		{
+			name: "should be err if product is not in the list",
+			mock: func(l *LomsProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, list).Return(nil, storage.ErrUserNotFound)
+				c.MoveItemMock.Expect(minimock.AnyContext, list, models.UserCart(1), 1).Return(0, storage.ErrUserNotFound)
+			},
+			wantErr: storage.ErrUserNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, NewProductProviderMock(mc), lomsProviderMock, NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(lomsProviderMock, cartStorageMock)
+
+			err := cartService.MoveToCart(context.Background(), models.UserCart(1), models.ListSavedForLater, 1)
+
+			require.ErrorIs(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestCartService_GetList(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	list := models.UserCart(1).WithList(models.ListWishlist)
+
+	tests := []struct {
+		name      string
+		mock      func(p *ProductProviderMock, c *CartStorageMock)
+		wantItems []models.Product
+		wantErr   error
+	}{
+		{
+			name: "should return products at current prices",
+			mock: func(p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, list).Return(map[models.Product]uint16{{SkuId: 1, Price: 90}: 2}, nil)
+				p.GetProductsMock.Expect(minimock.AnyContext, []int64{1}).Return(map[int64]clients.ProductInfo{1: {Name: "Product name", Price: 100}}, nil)
+			},
+			wantItems: []models.Product{{SkuId: 1, Name: "Product name", Price: 100, Count: 2, PriceChanged: true}},
+		},
+		{
+			name: "should return empty list if nothing was moved to it",
+			mock: func(p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, list).Return(nil, storage.ErrUserNotFound)
+			},
+			wantItems: []models.Product{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			productProviderMock := NewProductProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, NewLomsProviderMock(mc), NewPromoStorageMock(mc), nil, nil)
+
+			test.mock(productProviderMock, cartStorageMock)
+
+			items, err := cartService.GetList(context.Background(), models.UserCart(1), models.ListWishlist)
+
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantItems, items)
+		})
+	}
+}
+
+func TestCartService_Events(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	product := models.Product{SkuId: 1, Name: "Product Name", Price: 100}
+	guest := models.GuestCart("0123456789abcdef")
+
+	tests := []struct {
+		name      string
+		mock      func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock)
+		call      func(cartService *CartService) error
+		wantEvent models.CartEvent
+	}{
+		{
+			name: "should publish the count after adding",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{product: 2}, nil)
+				p.GetProductMock.Expect(minimock.AnyContext, 1).Return(clients.ProductInfo{Name: product.Name, Price: product.Price}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(10, nil)
+				c.AddItemMock.Expect(minimock.AnyContext, models.UserCart(1), 1, product.Name, product.Price, 3).Return(5, nil)
+			},
+			call: func(cartService *CartService) error {
+				return cartService.SaveProductItem(context.Background(), models.UserCart(1), 1, 3)
+			},
+			wantEvent: models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 5},
+		},
+		{
+			name: "should publish the count stored by the storage",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{product: 2}, nil)
+				p.GetProductMock.Expect(minimock.AnyContext, 1).Return(clients.ProductInfo{Name: product.Name, Price: product.Price}, nil)
+				l.GetStockInfoMock.Expect(minimock.AnyContext, 1).Return(10, nil)
+				c.AddItemMock.Expect(minimock.AnyContext, models.UserCart(1), 1, product.Name, product.Price, 3).Return(7, nil)
+			},
+			call: func(cartService *CartService) error {
+				return cartService.SaveProductItem(context.Background(), models.UserCart(1), 1, 3)
+			},
+			wantEvent: models.CartEvent{Type: models.EventItemAdded, UserId: 1, SkuId: 1, Count: 7},
+		},
+		{
+			name: "should publish removal when count is reduced",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.GetItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(map[models.Product]uint16{product: 5}, nil)
+				c.SetItemCountMock.Expect(minimock.AnyContext, models.UserCart(1), 1, product.Name, product.Price, 3).Return(nil)
+			},
+			call: func(cartService *CartService) error {
+				return cartService.SetItemCount(context.Background(), models.UserCart(1), 1, 3)
+			},
+			wantEvent: models.CartEvent{Type: models.EventItemRemoved, UserId: 1, SkuId: 1, Count: 3},
+		},
+		{
+			name: "should publish removal of the guest product",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.RemoveItemMock.Expect(minimock.AnyContext, guest, 1).Return(nil)
+			},
+			call: func(cartService *CartService) error {
+				return cartService.DeleteProductItem(context.Background(), guest, 1)
+			},
+			wantEvent: models.CartEvent{Type: models.EventItemRemoved, Session: guest.Session, SkuId: 1},
+		},
+		{
+			name: "should publish clearing",
+			mock: func(l *LomsProviderMock, p *ProductProviderMock, c *CartStorageMock) {
+				c.DeleteItemsByOwnerMock.Expect(minimock.AnyContext, models.UserCart(1)).Return(nil)
+			},
+			call: func(cartService *CartService) error {
+				return cartService.DeleteCart(context.Background(), models.UserCart(1))
+			},
+			wantEvent: models.CartEvent{Type: models.EventCleared, UserId: 1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			productProviderMock := NewProductProviderMock(mc)
+			cartStorageMock := NewCartStorageMock(mc)
+			eventPublisherMock := NewEventPublisherMock(mc)
+			cartService := NewCartService(cartStorageMock, productProviderMock, lomsProviderMock, NewPromoStorageMock(mc), eventPublisherMock, nil)
+
+			test.mock(lomsProviderMock, productProviderMock, cartStorageMock)
+
+			var event models.CartEvent
+
+			eventPublisherMock.PublishMock.Set(func(ctx context.Context, published models.CartEvent) {
+				event = published
+			})
+
+			require.NoError(t, test.call(cartService))
+			require.False(t, event.Time.IsZero())
+
+			event.Time = time.Time{}
+			require.Equal(t, test.wantEvent, event)
+		})
+	}
+}
+
+func TestCartService_EventsNotPublishedOnFailure(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	mc := minimock.NewController(t)
+	cartStorageMock := NewCartStorageMock(mc)
+	cartService := NewCartService(cartStorageMock, NewProductProviderMock(mc), NewLomsProviderMock(mc), NewPromoStorageMock(mc), NewEventPublisherMock(mc), nil)
+
+	cartStorageMock.RemoveItemMock.Expect(minimock.AnyContext, models.UserCart(1), 1).Return(storage.ErrItemNotFound)
+
+	err := cartService.DeleteProductItem(context.Background(), models.UserCart(1), 1)
+	require.ErrorIs(t, err, storage.ErrItemNotFound)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+const (
+	cartCleanupAttempts = 3
+	cartCleanupBackoff  = 50 * time.Millisecond
+	idempotencyKeyTTL   = 24 * time.Hour
+	// checkoutTTL is longer than any checkout takes, a checkout of a crashed instance unlocks the cart after it
+	checkoutTTL = time.Minute
+)
+
+var (
+	ErrCheckoutInProgress = errors.New("checkout is already in progress")
+	ErrOrderNotCreated    = errors.New("order is not created")
+	ErrCheckoutRolledBack = errors.New("checkout is rolled back, the order is cancelled")
+	ErrCheckoutIncomplete = errors.New("order is created, but the cart is not cleared")
+	ErrPricesStale        = errors.New("product prices can't be confirmed while the product service is unavailable")
+)
+
+// Checkout creates an order in LOMS from the user's cart and clears the cart.
+// The order is created only if the prices are the ones the user saw, otherwise *PriceChangedError is returned.
+// LOMS gets the unit prices with the discount of the applied promo code. Prices served from the expired
+// cache while the product service fails are never charged, the checkout fails with ErrPricesStale instead.
+// If the cart can't be cleared, the order is cancelled, so a retry doesn't produce a second order.
+// A non-empty idempotencyKey is passed to LOMS, and a repeated checkout with the same key
+// returns the original order.
+func (service *CartService) Checkout(ctx context.Context, userId int64, idempotencyKey string) (int64, error) {
+	if idempotencyKey != "" {
+		orderId, ok, err := service.Checkouts.GetCheckoutOrder(ctx, userId, idempotencyKey)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			return orderId, nil
+		}
+	}
+
+	token, started, err := service.Checkouts.StartCheckout(ctx, userId, checkoutTTL)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !started {
+		return 0, ErrCheckoutInProgress
+	}
+
+	defer service.finishCheckout(ctx, userId, token)
+
+	items, err := service.Store.GetItemsByOwner(ctx, models.UserCart(userId))
+
+	if err != nil {
+		return 0, err
+	}
+
+	subtotal, products, err := service.calculateTotal(ctx, items)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = ensurePricesFresh(products); err != nil {
+		return 0, err
+	}
+
+	if err = service.ensurePricesSeen(ctx, models.UserCart(userId), items, products); err != nil {
+		return 0, err
+	}
+
+	cart, err := service.chargedCart(ctx, models.UserCart(userId), subtotal, products)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = service.ensureInStock(ctx, products); err != nil {
+		return 0, err
+	}
+
+	orderId, err := service.LomsProvider.CreateOrder(ctx, userId, cart.ChargedItems(), idempotencyKey)
+
+	if err != nil {
+		service.setCheckoutStatus(ctx, userId, token, models.CheckoutFailed, 0)
+
+		// stocks may have been reserved by someone else since the check
+		if errors.Is(err, clients.ErrOutOfStock) {
+			if stockErr := service.ensureInStock(ctx, products); stockErr != nil {
+				return 0, stockErr
+			}
+		}
+
+		return 0, fmt.Errorf("%w: %w", ErrOrderNotCreated, err)
+	}
+
+	service.setCheckoutStatus(ctx, userId, token, models.CheckoutOrderCreated, orderId)
+
+	// the order already exists, so finish the saga even if the client has gone away
+	ctx = context.WithoutCancel(ctx)
+
+	cleanupErr := service.clearCartWithRetry(ctx, userId)
+
+	if cleanupErr == nil {
+		service.setCheckoutStatus(ctx, userId, token, models.CheckoutCompleted, orderId)
+		service.publishCheckout(ctx, userId, orderId, products)
+
+		if idempotencyKey != "" {
+			if err = service.Checkouts.SaveCheckoutOrder(ctx, userId, idempotencyKey, orderId, idempotencyKeyTTL); err != nil {
+				log.Printf("[checkout] user %d: save order %d of idempotency key: %v", userId, orderId, err)
+			}
+		}
+
+		return orderId, nil
+	}
+
+	if err = service.LomsProvider.CancelOrder(ctx, orderId); err != nil {
+		service.setCheckoutStatus(ctx, userId, token, models.CheckoutFailed, orderId)
+		return orderId, fmt.Errorf("%w: order %d: %w", ErrCheckoutIncomplete, orderId, errors.Join(cleanupErr, err))
+	}
+
+	service.setCheckoutStatus(ctx, userId, token, models.CheckoutCompensated, orderId)
+
+	return 0, fmt.Errorf("%w: %w", ErrCheckoutRolledBack, cleanupErr)
+}
+
+// setCheckoutStatus records the status of the running checkout, a failure to record it doesn't fail the checkout.
+func (service *CartService) setCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) {
+	log.Printf("[checkout] user %d: order %d, status %s", userId, orderId, status)
+
+	if err := service.Checkouts.SetCheckoutStatus(ctx, userId, token, status, orderId); err != nil {
+		log.Printf("[checkout] user %d: set status %s: %v", userId, status, err)
+	}
+}
+
+// finishCheckout unlocks the cart unless another checkout has taken it over after this one has expired.
+// If it fails, the cart is unlocked when the checkout expires.
+func (service *CartService) finishCheckout(ctx context.Context, userId int64, token string) {
+	if err := service.Checkouts.FinishCheckout(context.WithoutCancel(ctx), userId, token); err != nil {
+		log.Printf("[checkout] user %d: finish: %v", userId, err)
+	}
+}
+
+// chargedCart returns the cart with the discount of the applied promo code. Unlike GetCart, a code
+// that doesn't suit the cart anymore fails the checkout with *PromoNotApplicableError,
+// so the user is never charged other than the total they saw.
+func (service *CartService) chargedCart(ctx context.Context, owner models.CartOwner, subtotal uint32, products []models.Product) (models.Cart, error) {
+	cart := newCart(subtotal, products)
+	promo, err := service.appliedPromo(ctx, owner)
+
+	if err != nil || promo == nil {
+		return cart, err
+	}
+
+	return withDiscount(cart, *promo)
+}
+
+// ensurePricesFresh returns ErrPricesStale if some of the prices are taken from the expired cache.
+func ensurePricesFresh(products []models.Product) error {
+	stale := make([]int64, 0)
+
+	for _, product := range products {
+		if product.Stale {
+			stale = append(stale, product.SkuId)
+		}
+	}
+
+	if len(stale) > 0 {
+		return fmt.Errorf("%w: skus %v", ErrPricesStale, stale)
+	}
+
+	return nil
+}
+
+// ensureInStock returns *OutOfStockError if LOMS can't reserve some of the products.
+func (service *CartService) ensureInStock(ctx context.Context, products []models.Product) error {
+	shortages, err := service.stockShortages(ctx, products)
+
+	if err != nil {
+		return err
+	}
+
+	if len(shortages) > 0 {
+		return &OutOfStockError{Shortages: shortages}
+	}
+
+	return nil
+}
+
+func (service *CartService) clearCartWithRetry(ctx context.Context, userId int64) error {
+	var err error
+
+	for attempt := range cartCleanupAttempts {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * cartCleanupBackoff)
+		}
+
+		if err = service.DeleteCart(ctx, models.UserCart(userId)); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
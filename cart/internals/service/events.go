@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+// discardEvents is the publisher of a cart service without the event stream.
+type discardEvents struct{}
+
+func (discardEvents) Publish(context.Context, models.CartEvent) {}
+
+// publish sends the event of the cart of owner after the change is stored, count is the count of the product after the change.
+func (service *CartService) publish(ctx context.Context, eventType models.CartEventType, owner models.CartOwner, skuId int64, count uint16) {
+	service.Events.Publish(ctx, models.CartEvent{
+		Type:    eventType,
+		UserId:  owner.UserId,
+		Session: owner.Session,
+		SkuId:   skuId,
+		Count:   count,
+		Time:    time.Now().UTC(),
+	})
+}
+
+// publishCheckout sends an event for every product of the order created from the cart of the user.
+func (service *CartService) publishCheckout(ctx context.Context, userId int64, orderId int64, products []models.Product) {
+	now := time.Now().UTC()
+
+	for _, product := range products {
+		service.Events.Publish(ctx, models.CartEvent{
+			Type:    models.EventCheckedOut,
+			UserId:  userId,
+			SkuId:   product.SkuId,
+			Count:   product.Count,
+			OrderId: orderId,
+			Time:    now,
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"route256.ozon.ru/project/cart/internals/storage"
+	"route256.ozon.ru/project/cart/models"
+)
+
+// Lists are kept by the cart storage under the owner with the list, they are never priced into the cart total
+// and never checked out.
+
+// MoveToList moves the product with its whole count from the cart into the list.
+func (service *CartService) MoveToList(ctx context.Context, owner models.CartOwner, list models.ListName, skuId int64) error {
+	if _, err := service.Store.MoveItem(ctx, owner, owner.WithList(list), skuId); err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventItemRemoved, owner, skuId, 0)
+	return nil
+}
+
+// MoveToCart moves the product with its whole count from the list back into the cart.
+// Stocks are checked against the count the cart will have.
+func (service *CartService) MoveToCart(ctx context.Context, owner models.CartOwner, list models.ListName, skuId int64) error {
+	listItem, inList, err := service.cartItem(ctx, owner.WithList(list), skuId)
+
+	if err != nil {
+		return err
+	}
+
+	// a product missing in the list is reported by the storage
+	if inList {
+		cartItem, _, err := service.cartItem(ctx, owner, skuId)
+
+		if err != nil {
+			return err
+		}
+
+		if err = service.checkStock(ctx, skuId, uint64(cartItem.Count)+uint64(listItem.Count)); err != nil {
+			return err
+		}
+	}
+
+	count, err := service.Store.MoveItem(ctx, owner.WithList(list), owner, skuId)
+
+	if err != nil {
+		return err
+	}
+
+	service.publish(ctx, models.EventItemAdded, owner, skuId, count)
+	return nil
+}
+
+// GetList returns the products of the list at current prices, a list nothing was moved to is empty.
+func (service *CartService) GetList(ctx context.Context, owner models.CartOwner, list models.ListName) ([]models.Product, error) {
+	items, err := service.Store.GetItemsByOwner(ctx, owner.WithList(list))
+
+	if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUserCartEmpty) {
+		return []models.Product{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, products, err := service.calculateTotal(ctx, items)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (service *CartService) DeleteListItem(ctx context.Context, owner models.CartOwner, list models.ListName, skuId int64) error {
+	return service.Store.RemoveItem(ctx, owner.WithList(list), skuId)
+}
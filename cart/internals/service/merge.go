@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"route256.ozon.ru/project/cart/internals/storage"
+	"route256.ozon.ru/project/cart/models"
+)
+
+var (
+	ErrGuestCartNotFound = errors.New("guest cart is not found")
+)
+
+// MergeCart folds the guest cart of the session into the cart of the user after they log in and returns the merged cart.
+// Policy decides the count of a product that is in both carts. The guest promo code is kept only if the user has none.
+// The guest lists are merged into the lists of the user the same way, a guest with lists only has no cart to merge.
+// The merged counts are checked against LOMS stocks, the lines exceeding them are returned as shortages
+// for the user to fix before checkout.
+func (service *CartService) MergeCart(ctx context.Context, userId int64, session string, policy models.MergePolicy) (models.Cart, []models.StockShortage, error) {
+	counts, err := service.itemCounts(ctx, models.UserCart(userId))
+
+	if err != nil {
+		return models.Cart{}, nil, err
+	}
+
+	// the cart goes first, so a failed merge leaves the lists as they were and can be retried
+	err = service.Store.MergeItems(ctx, models.GuestCart(session), models.UserCart(userId), policy)
+	found := err == nil
+
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		return models.Cart{}, nil, err
+	}
+
+	for _, list := range models.Lists {
+		err = service.Store.MergeItems(ctx, models.GuestCart(session).WithList(list), models.UserCart(userId).WithList(list), policy)
+
+		if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+			return models.Cart{}, nil, err
+		}
+
+		found = found || err == nil
+	}
+
+	if !found {
+		return models.Cart{}, nil, ErrGuestCartNotFound
+	}
+
+	cart, err := service.GetCart(ctx, models.UserCart(userId))
+
+	// both carts may have had no products, or the guest may have had only lists
+	if errors.Is(err, storage.ErrUserCartEmpty) || errors.Is(err, storage.ErrUserNotFound) {
+		return newCart(0, []models.Product{}), []models.StockShortage{}, nil
+	}
+
+	if err != nil {
+		return models.Cart{}, nil, err
+	}
+
+	for _, item := range cart.Items {
+		if counts[item.SkuId] != item.Count {
+			service.publish(ctx, models.EventItemAdded, models.UserCart(userId), item.SkuId, item.Count)
+		}
+	}
+
+	shortages, err := service.stockShortages(ctx, cart.Items)
+
+	if err != nil {
+		return models.Cart{}, nil, err
+	}
+
+	return cart, shortages, nil
+}
+
+// itemCounts returns the counts of the products in the cart by sku, a missing cart has none.
+func (service *CartService) itemCounts(ctx context.Context, owner models.CartOwner) (map[int64]uint16, error) {
+	items, err := service.Store.GetItemsByOwner(ctx, owner)
+
+	if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUserCartEmpty) {
+		return map[int64]uint16{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]uint16, len(items))
+
+	for item, count := range items {
+		counts[item.SkuId] = count
+	}
+
+	return counts, nil
+}
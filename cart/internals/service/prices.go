@@ -0,0 +1,73 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"route256.ozon.ru/project/cart/models"
+	"slices"
+	"strings"
+)
+
+// PriceChangedError lists the cart lines whose prices changed since the user saw them. It matches ErrPriceChanged with errors.Is.
+type PriceChangedError struct {
+	Changes []models.PriceChange
+}
+
+func (e *PriceChangedError) Error() string {
+	lines := make([]string, len(e.Changes))
+
+	for i, change := range e.Changes {
+		lines[i] = fmt.Sprintf("sku %d: %d -> %d", change.SkuId, change.OldPrice, change.NewPrice)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrPriceChanged, strings.Join(lines, "; "))
+}
+
+func (e *PriceChangedError) Unwrap() error {
+	return ErrPriceChanged
+}
+
+// priceChanged reports whether the current price differs from the price the user saw.
+// Lines saved before prices were stored have no price the user saw and never change.
+func priceChanged(seen uint32, current uint32) bool {
+	return seen != 0 && seen != current
+}
+
+// ensurePricesSeen returns *PriceChangedError if the current prices of the products differ from the prices the user saw.
+// The current prices become the prices the user saw, so the user confirms them by repeating the request.
+func (service *CartService) ensurePricesSeen(ctx context.Context, owner models.CartOwner, items map[models.Product]uint16, products []models.Product) error {
+	seen := make(map[int64]uint32, len(items))
+
+	for item := range items {
+		seen[item.SkuId] = item.Price
+	}
+
+	changes := make([]models.PriceChange, 0)
+	prices := make(map[int64]uint32)
+
+	for _, product := range products {
+		if priceChanged(seen[product.SkuId], product.Price) {
+			changes = append(changes, models.PriceChange{
+				SkuId:    product.SkuId,
+				OldPrice: seen[product.SkuId],
+				NewPrice: product.Price,
+			})
+			prices[product.SkuId] = product.Price
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := service.Store.SetItemPrices(ctx, owner, prices); err != nil {
+		return err
+	}
+
+	slices.SortFunc(changes, func(a, b models.PriceChange) int {
+		return cmp.Compare(a.SkuId, b.SkuId)
+	})
+
+	return &PriceChangedError{Changes: changes}
+}
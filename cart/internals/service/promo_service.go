@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"route256.ozon.ru/project/cart/models"
+)
+
+// PromoService manages promo codes, applying them to carts is up to CartService.
+type PromoService struct {
+	Store PromoStorage
+}
+
+func NewPromoService(store PromoStorage) *PromoService {
+	return &PromoService{Store: store}
+}
+
+func (service *PromoService) CreatePromo(ctx context.Context, promo models.Promo) error {
+	return service.Store.CreatePromo(ctx, promo)
+}
+
+func (service *PromoService) UpdatePromo(ctx context.Context, promo models.Promo) error {
+	return service.Store.UpdatePromo(ctx, promo)
+}
+
+func (service *PromoService) DeletePromo(ctx context.Context, code string) error {
+	return service.Store.DeletePromo(ctx, code)
+}
+
+func (service *PromoService) GetPromo(ctx context.Context, code string) (models.Promo, error) {
+	return service.Store.GetPromo(ctx, code)
+}
+
+func (service *PromoService) ListPromos(ctx context.Context) ([]models.Promo, error) {
+	return service.Store.ListPromos(ctx)
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"route256.ozon.ru/project/cart/internals/storage"
+	"route256.ozon.ru/project/cart/models"
+)
+
+var (
+	ErrPromoNotApplicable = errors.New("promo code is not applicable to the cart")
+)
+
+// PromoNotApplicableError tells why the promo code gives no discount to the cart.
+// It matches ErrPromoNotApplicable with errors.Is.
+type PromoNotApplicableError struct {
+	Reason string
+}
+
+func (e *PromoNotApplicableError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrPromoNotApplicable, e.Reason)
+}
+
+func (e *PromoNotApplicableError) Unwrap() error {
+	return ErrPromoNotApplicable
+}
+
+// ApplyPromo applies the promo code to the cart instead of the applied one and returns the cart with the discount.
+// The code is applied only if it gives a discount to the cart as it is now, otherwise *PromoNotApplicableError is returned.
+func (service *CartService) ApplyPromo(ctx context.Context, owner models.CartOwner, code string) (models.Cart, error) {
+	promo, err := service.Promos.GetPromo(ctx, code)
+
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	items, err := service.Store.GetItemsByOwner(ctx, owner)
+
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	subtotal, products, err := service.calculateTotal(ctx, items)
+
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	cart, err := withDiscount(newCart(subtotal, products), promo)
+
+	if err != nil {
+		return models.Cart{}, err
+	}
+
+	if err = service.Store.SetPromoCode(ctx, owner, promo.Code); err != nil {
+		return models.Cart{}, err
+	}
+
+	return cart, nil
+}
+
+// RemovePromo removes the promo code applied to the cart.
+func (service *CartService) RemovePromo(ctx context.Context, owner models.CartOwner) error {
+	return service.Store.SetPromoCode(ctx, owner, "")
+}
+
+// appliedPromo returns the promo code applied to the cart, nil if there is none or the code has been deleted since.
+func (service *CartService) appliedPromo(ctx context.Context, owner models.CartOwner) (*models.Promo, error) {
+	code, err := service.Store.GetPromoCode(ctx, owner)
+
+	if err != nil || code == "" {
+		return nil, err
+	}
+
+	promo, err := service.Promos.GetPromo(ctx, code)
+
+	if errors.Is(err, storage.ErrPromoNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &promo, nil
+}
+
+func newCart(subtotal uint32, products []models.Product) models.Cart {
+	return models.Cart{
+		Items:     products,
+		Subtotal:  subtotal,
+		Discounts: []models.Discount{},
+		Total:     subtotal,
+	}
+}
+
+// withDiscount applies the promo to the cart. The cart keeps the code even if the promo gives no discount.
+// The discount is spread over the units of the products, see unitDiscounts.
+func withDiscount(cart models.Cart, promo models.Promo) (models.Cart, error) {
+	cart.PromoCode = promo.Code
+	amount, err := promoDiscount(promo, cart.Items, cart.Subtotal)
+
+	if err != nil {
+		return cart, err
+	}
+
+	cart.UnitDiscounts, amount = unitDiscounts(cart.Items, cart.Subtotal, amount)
+	cart.Discounts = append(cart.Discounts, models.Discount{
+		Code:   promo.Code,
+		Type:   promo.Type,
+		Amount: amount,
+	})
+	cart.Total = cart.Subtotal - amount
+
+	return cart, nil
+}
+
+// promoDiscount returns the amount the promo takes off the cart, it's never more than the subtotal.
+func promoDiscount(promo models.Promo, products []models.Product, subtotal uint32) (uint32, error) {
+	if subtotal < promo.MinTotal {
+		return 0, &PromoNotApplicableError{fmt.Sprintf("cart total %d is less than %d", subtotal, promo.MinTotal)}
+	}
+
+	var amount uint64
+
+	switch promo.Type {
+	case models.PromoPercentOff:
+		amount = uint64(subtotal) * uint64(promo.Percent) / 100
+	case models.PromoFixedOff:
+		amount = uint64(promo.Amount)
+	case models.PromoBuyNGetM:
+		amount = buyNGetMDiscount(promo, products)
+
+		if amount == 0 {
+			return 0, &PromoNotApplicableError{fmt.Sprintf(
+				"add %d of product %d to the cart to get %d free",
+				uint32(promo.BuyCount)+uint32(promo.FreeCount), promo.SkuId, promo.FreeCount,
+			)}
+		}
+	default:
+		return 0, &PromoNotApplicableError{fmt.Sprintf("unknown promo type %q", promo.Type)}
+	}
+
+	if amount == 0 {
+		return 0, &PromoNotApplicableError{"the cart gets no discount"}
+	}
+
+	return uint32(min(amount, uint64(subtotal))), nil
+}
+
+// unitDiscounts spreads amount over the units of the products in proportion to their prices and returns
+// the discount of a unit by sku with the amount spread. A unit price has no fractions, so the amount spread
+// may exceed amount by less than the count of a product, never by more than the subtotal.
+func unitDiscounts(products []models.Product, subtotal uint32, amount uint32) (map[int64]uint32, uint32) {
+	discounts := make(map[int64]uint32, len(products))
+
+	if subtotal == 0 {
+		return discounts, 0
+	}
+
+	var spread uint64
+
+	for _, product := range products {
+		unit := uint64(product.Price) * uint64(amount) / uint64(subtotal)
+		discounts[product.SkuId] = uint32(unit)
+		spread += unit * uint64(product.Count)
+	}
+
+	// what is left after rounding down goes to the products in sku order
+	for _, product := range products {
+		if spread >= uint64(amount) {
+			break
+		}
+
+		if product.Count == 0 {
+			continue
+		}
+
+		left := uint64(amount) - spread
+		extra := min((left+uint64(product.Count)-1)/uint64(product.Count), uint64(product.Price-discounts[product.SkuId]))
+		discounts[product.SkuId] += uint32(extra)
+		spread += extra * uint64(product.Count)
+	}
+
+	return discounts, uint32(spread)
+}
+
+// buyNGetMDiscount makes FreeCount of every BuyCount+FreeCount products free.
+func buyNGetMDiscount(promo models.Promo, products []models.Product) uint64 {
+	set := uint64(promo.BuyCount) + uint64(promo.FreeCount)
+
+	if set == 0 {
+		return 0
+	}
+
+	for _, product := range products {
+		if product.SkuId == promo.SkuId {
+			free := uint64(product.Count) / set * uint64(promo.FreeCount)
+			return free * uint64(product.Price)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"route256.ozon.ru/project/cart/models"
+	"slices"
+	"strings"
+)
+
+// OutOfStockError lists the cart lines exceeding LOMS stocks. It matches ErrProductOutOfStock with errors.Is.
+type OutOfStockError struct {
+	Shortages []models.StockShortage
+}
+
+func (e *OutOfStockError) Error() string {
+	lines := make([]string, len(e.Shortages))
+
+	for i, shortage := range e.Shortages {
+		lines[i] = fmt.Sprintf("sku %d: requested %d, available %d", shortage.SkuId, shortage.Requested, shortage.Available)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrProductOutOfStock, strings.Join(lines, "; "))
+}
+
+func (e *OutOfStockError) Unwrap() error {
+	return ErrProductOutOfStock
+}
+
+// ValidateCart checks every line of the cart against LOMS stocks and returns the lines that can't be ordered.
+func (service *CartService) ValidateCart(ctx context.Context, owner models.CartOwner) ([]models.StockShortage, error) {
+	items, err := service.Store.GetItemsByOwner(ctx, owner)
+
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]models.Product, 0, len(items))
+
+	for item, count := range items {
+		item.Count = count
+		products = append(products, item)
+	}
+
+	return service.stockShortages(ctx, products)
+}
+
+// stockShortages requests stocks of all the products in one call and returns shortages sorted by sku.
+func (service *CartService) stockShortages(ctx context.Context, products []models.Product) ([]models.StockShortage, error) {
+	skuIds := make([]int64, 0, len(products))
+
+	for _, product := range products {
+		skuIds = append(skuIds, product.SkuId)
+	}
+
+	slices.Sort(skuIds)
+
+	stocks, err := service.LomsProvider.GetStocksInfo(ctx, skuIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shortages := make([]models.StockShortage, 0)
+
+	for _, product := range products {
+		if available := stocks[product.SkuId]; available < uint64(product.Count) {
+			shortages = append(shortages, models.StockShortage{
+				SkuId:     product.SkuId,
+				Requested: product.Count,
+				Available: available,
+			})
+		}
+	}
+
+	slices.SortFunc(shortages, func(a, b models.StockShortage) int {
+		return cmp.Compare(a.SkuId, b.SkuId)
+	})
+
+	return shortages, nil
+}
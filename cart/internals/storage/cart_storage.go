@@ -3,30 +3,85 @@ package storage
 import (
 	"context"
 	"errors"
+	"maps"
+	"math"
 	"route256.ozon.ru/project/cart/models"
 	"sync"
 )
 
 type InMemoryCartStorage struct {
-	mx       sync.RWMutex
-	carts    map[int64]map[int64]uint16
-	products map[int64]models.Product
+	mx         sync.RWMutex
+	carts      map[models.CartOwner]map[int64]cartLine
+	products   map[int64]models.Product
+	promoCodes map[models.CartOwner]string
+}
+
+// cartLine is a product in the cart with the price the user saw when they put it there.
+type cartLine struct {
+	count uint16
+	price uint32
 }
 
 var (
 	ErrUserNotFound  = errors.New("user is not found")
 	ErrUserCartEmpty = errors.New("products are not found")
+	ErrItemNotFound  = errors.New("product is not in the cart")
+	// ErrItemCountOverflow is returned when a count change doesn't fit into uint16
+	ErrItemCountOverflow = errors.New("product count is too big")
 )
 
 func NewInMemoryCartStorage() *InMemoryCartStorage {
 	return &InMemoryCartStorage{
 		sync.RWMutex{},
-		make(map[int64]map[int64]uint16),
+		make(map[models.CartOwner]map[int64]cartLine),
 		make(map[int64]models.Product),
+		make(map[models.CartOwner]string),
+	}
+}
+
+// AddItem adds count of the product to the cart, keeps price as the price the user saw and returns the new count.
+// Nothing changes if the count doesn't fit into uint16.
+func (store *InMemoryCartStorage) AddItem(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) (uint16, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	line := store.carts[owner][productId]
+	newCount := uint32(line.count) + uint32(count)
+
+	if newCount > math.MaxUint16 {
+		return 0, ErrItemCountOverflow
+	}
+
+	if _, ok := store.products[productId]; !ok {
+		store.products[productId] = models.Product{SkuId: productId, Name: productName}
 	}
+
+	if store.carts[owner] == nil {
+		store.carts[owner] = map[int64]cartLine{}
+	}
+
+	store.carts[owner][productId] = cartLine{count: uint16(newCount), price: price}
+	return uint16(newCount), nil
+}
+
+func (store *InMemoryCartStorage) RemoveItem(ctx context.Context, owner models.CartOwner, productId int64) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if store.carts[owner] == nil {
+		return ErrUserNotFound
+	}
+
+	delete(store.carts[owner], productId)
+	return nil
 }
 
-func (store *InMemoryCartStorage) AddItem(ctx context.Context, userId int64, productId int64, productName string, count uint16) error {
+// SetItemCount sets the count of the product in the cart, 0 removes the product.
+func (store *InMemoryCartStorage) SetItemCount(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) error {
+	if count == 0 {
+		return store.RemoveItem(ctx, owner, productId)
+	}
+
 	store.mx.Lock()
 	defer store.mx.Unlock()
 
@@ -34,55 +89,211 @@ func (store *InMemoryCartStorage) AddItem(ctx context.Context, userId int64, pro
 		store.products[productId] = models.Product{SkuId: productId, Name: productName}
 	}
 
-	if store.carts[userId] == nil {
-		store.carts[userId] = map[int64]uint16{}
+	if store.carts[owner] == nil {
+		store.carts[owner] = map[int64]cartLine{}
 	}
 
-	store.carts[userId][productId] += count
+	store.carts[owner][productId] = cartLine{count: count, price: price}
 	return nil
 }
 
-func (store *InMemoryCartStorage) RemoveItem(ctx context.Context, userId int64, productId int64) error {
+// SetItemPrices replaces the prices the user saw for the products of the cart, products missing in the cart are skipped.
+func (store *InMemoryCartStorage) SetItemPrices(ctx context.Context, owner models.CartOwner, prices map[int64]uint32) error {
 	store.mx.Lock()
 	defer store.mx.Unlock()
 
-	if store.carts[userId] == nil {
+	if store.carts[owner] == nil {
 		return ErrUserNotFound
 	}
 
-	delete(store.carts[userId], productId)
+	for productId, price := range prices {
+		if line, ok := store.carts[owner][productId]; ok {
+			line.price = price
+			store.carts[owner][productId] = line
+		}
+	}
+
 	return nil
 }
 
-func (store *InMemoryCartStorage) DeleteItemsByUserId(ctx context.Context, userId int64) error {
+// ChangeItemCount adds the signed delta to the count of the product in the cart and returns the new count.
+// The product is removed when the count drops to 0 or below.
+func (store *InMemoryCartStorage) ChangeItemCount(ctx context.Context, owner models.CartOwner, productId int64, delta int32) (uint16, error) {
 	store.mx.Lock()
 	defer store.mx.Unlock()
 
-	if store.carts[userId] == nil {
+	if store.carts[owner] == nil {
+		return 0, ErrUserNotFound
+	}
+
+	line, ok := store.carts[owner][productId]
+
+	if !ok {
+		return 0, ErrItemNotFound
+	}
+
+	newCount := int64(line.count) + int64(delta)
+
+	switch {
+	case newCount > math.MaxUint16:
+		return 0, ErrItemCountOverflow
+	case newCount <= 0:
+		delete(store.carts[owner], productId)
+		return 0, nil
+	}
+
+	line.count = uint16(newCount)
+	store.carts[owner][productId] = line
+	return line.count, nil
+}
+
+// SetPromoCode applies the promo code to the cart, an empty code removes the applied one.
+func (store *InMemoryCartStorage) SetPromoCode(ctx context.Context, owner models.CartOwner, code string) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if store.carts[owner] == nil {
+		return ErrUserNotFound
+	}
+
+	if code == "" {
+		delete(store.promoCodes, owner)
+		return nil
+	}
+
+	store.promoCodes[owner] = code
+	return nil
+}
+
+// GetPromoCode returns the promo code applied to the cart or an empty string.
+func (store *InMemoryCartStorage) GetPromoCode(ctx context.Context, owner models.CartOwner) (string, error) {
+	store.mx.RLock()
+	defer store.mx.RUnlock()
+
+	return store.promoCodes[owner], nil
+}
+
+// MergeItems moves the products of cart from into cart to, policy decides the count of a product that is in both
+// and the line of cart to is kept then. The promo code of cart from is moved if cart to has none, cart from is deleted.
+// Nothing changes if a count doesn't fit into uint16.
+func (store *InMemoryCartStorage) MergeItems(ctx context.Context, from models.CartOwner, to models.CartOwner, policy models.MergePolicy) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if store.carts[from] == nil {
+		return ErrUserNotFound
+	}
+
+	merged := make(map[int64]cartLine, len(store.carts[from]))
+
+	for productId, line := range store.carts[from] {
+		if current, ok := store.carts[to][productId]; ok {
+			count := mergeCount(policy, current.count, line.count)
+
+			if count > math.MaxUint16 {
+				return ErrItemCountOverflow
+			}
+
+			line = cartLine{count: uint16(count), price: current.price}
+		}
+
+		merged[productId] = line
+	}
+
+	if store.carts[to] == nil {
+		store.carts[to] = map[int64]cartLine{}
+	}
+
+	maps.Copy(store.carts[to], merged)
+
+	if code, ok := store.promoCodes[from]; ok && store.promoCodes[to] == "" {
+		store.promoCodes[to] = code
+	}
+
+	delete(store.carts, from)
+	delete(store.promoCodes, from)
+	return nil
+}
+
+// MoveItem moves the product from cart from into cart to and returns its count in cart to. The count is added
+// to the product if cart to has it and the line of cart to is kept then. Nothing changes if the count doesn't fit into uint16.
+func (store *InMemoryCartStorage) MoveItem(ctx context.Context, from models.CartOwner, to models.CartOwner, productId int64) (uint16, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if store.carts[from] == nil {
+		return 0, ErrUserNotFound
+	}
+
+	line, ok := store.carts[from][productId]
+
+	if !ok {
+		return 0, ErrItemNotFound
+	}
+
+	if current, ok := store.carts[to][productId]; ok {
+		count := mergeCount(models.MergeSum, current.count, line.count)
+
+		if count > math.MaxUint16 {
+			return 0, ErrItemCountOverflow
+		}
+
+		line = cartLine{count: uint16(count), price: current.price}
+	}
+
+	if store.carts[to] == nil {
+		store.carts[to] = map[int64]cartLine{}
+	}
+
+	store.carts[to][productId] = line
+	delete(store.carts[from], productId)
+	return line.count, nil
+}
+
+// mergeCount returns the count of a product that is in both carts, it may not fit into uint16.
+func mergeCount(policy models.MergePolicy, toCount uint16, fromCount uint16) uint32 {
+	switch policy {
+	case models.MergeSum:
+		return uint32(toCount) + uint32(fromCount)
+	case models.MergeMax:
+		return uint32(max(toCount, fromCount))
+	default:
+		return uint32(toCount)
+	}
+}
+
+func (store *InMemoryCartStorage) DeleteItemsByOwner(ctx context.Context, owner models.CartOwner) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	delete(store.promoCodes, owner)
+
+	if store.carts[owner] == nil {
 		return nil
 	}
 
-	delete(store.carts, userId)
+	delete(store.carts, owner)
 	return nil
 }
 
-func (store *InMemoryCartStorage) GetItemsByUserId(ctx context.Context, userId int64) (map[models.Product]uint16, error) {
+func (store *InMemoryCartStorage) GetItemsByOwner(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error) {
 	store.mx.RLock()
 	defer store.mx.RUnlock()
 
-	if store.carts[userId] == nil {
+	if store.carts[owner] == nil {
 		return nil, ErrUserNotFound
 	}
 
 	products := make(map[models.Product]uint16)
 
-	if len(store.carts[userId]) == 0 {
+	if len(store.carts[owner]) == 0 {
 		return nil, ErrUserCartEmpty
 	}
 
-	for productId, count := range store.carts[userId] {
+	for productId, line := range store.carts[owner] {
 		product := store.products[productId]
-		products[product] = count
+		product.Price = line.price
+		products[product] = line.count
 	}
 
 	return products, nil
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"github.com/gojuno/minimock/v3"
 	"github.com/stretchr/testify/require"
 	"route256.ozon.ru/project/cart/models"
@@ -11,6 +12,7 @@ type inputData struct {
 	userId int64
 	skuId  int64
 	name   string
+	price  uint32
 	count  uint16
 }
 
@@ -27,19 +29,20 @@ func TestInMemoryCartStorage_AddItem(t *testing.T) {
 			skuId:  1,
 			count:  1,
 			name:   "Product name",
+			price:  100,
 		}
 		product := models.Product{
 			SkuId: inputData.skuId,
 			Name:  "Product name",
 			Count: 0,
-			Price: 0,
+			Price: 100,
 		}
 		want := map[models.Product]uint16{product: 1}
 
-		err := cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
 
-		got, err := cartStorage.GetItemsByUserId(minimock.AnyContext, inputData.userId)
+		got, err := cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
 		require.Equal(t, want, got)
 	})
 
@@ -63,15 +66,42 @@ func TestInMemoryCartStorage_AddItem(t *testing.T) {
 		}
 		want := map[models.Product]uint16{product: 4}
 
-		err := cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
 
-		err = cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		count, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
+		require.Equal(t, uint16(4), count)
 
-		expected, err := cartStorage.GetItemsByUserId(minimock.AnyContext, inputData.userId)
+		expected, err := cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
 		require.Equal(t, want, expected)
 	})
+
+	t.Run("should keep the last price the user saw", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage := NewInMemoryCartStorage()
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(minimock.AnyContext, models.UserCart(1), 1, "Product name", 100, 1)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(minimock.AnyContext, models.UserCart(1), 1, "Product name", 120, 1)))
+
+		got, err := cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 120}: 2}, got)
+	})
+
+	t.Run("should be error on uint16 overflow", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage := NewInMemoryCartStorage()
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(minimock.AnyContext, models.UserCart(1), 1, "Product name", 100, 65535)))
+		require.ErrorIs(t, ignoreCount(cartStorage.AddItem(minimock.AnyContext, models.UserCart(1), 1, "Product name", 120, 1)), ErrItemCountOverflow)
+
+		got, err := cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 100}: 65535}, got)
+	})
 }
 
 func TestInMemoryCartStorage_RemoveItem(t *testing.T) {
@@ -88,7 +118,7 @@ func TestInMemoryCartStorage_RemoveItem(t *testing.T) {
 			name:   "Product name",
 		}
 
-		err := cartStorage.RemoveItem(minimock.AnyContext, inputData.userId, inputData.skuId)
+		err := cartStorage.RemoveItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId)
 
 		require.ErrorIs(t, err, ErrUserNotFound)
 	})
@@ -104,15 +134,15 @@ func TestInMemoryCartStorage_RemoveItem(t *testing.T) {
 			name:   "Product name",
 		}
 
-		err := cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
 
-		err = cartStorage.RemoveItem(minimock.AnyContext, inputData.userId, inputData.skuId)
+		err = cartStorage.RemoveItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId)
 		require.NoError(t, err)
 	})
 }
 
-func TestInMemoryCartStorage_GetItemsByUserId(t *testing.T) {
+func TestInMemoryCartStorage_GetItemsByOwner(t *testing.T) {
 	t.Run("should be error if user is not found", func(t *testing.T) {
 		t.Parallel()
 
@@ -125,7 +155,7 @@ func TestInMemoryCartStorage_GetItemsByUserId(t *testing.T) {
 			name:   "Product name",
 		}
 
-		_, err := cartStorage.GetItemsByUserId(minimock.AnyContext, inputData.userId)
+		_, err := cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
 		require.ErrorIs(t, err, ErrUserNotFound)
 	})
 
@@ -141,18 +171,18 @@ func TestInMemoryCartStorage_GetItemsByUserId(t *testing.T) {
 			name:   "Product name",
 		}
 
-		err := cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
 
-		err = cartStorage.RemoveItem(minimock.AnyContext, inputData.userId, inputData.skuId)
+		err = cartStorage.RemoveItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId)
 		require.NoError(t, err)
 
-		_, err = cartStorage.GetItemsByUserId(minimock.AnyContext, inputData.userId)
+		_, err = cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
 		require.ErrorIs(t, err, ErrUserCartEmpty)
 	})
 }
 
-func TestInMemoryCartStorage_DeleteItemsByUserId(t *testing.T) {
+func TestInMemoryCartStorage_DeleteItemsByOwner(t *testing.T) {
 	t.Run("should not be error if user is not found", func(t *testing.T) {
 		t.Parallel()
 
@@ -162,7 +192,7 @@ func TestInMemoryCartStorage_DeleteItemsByUserId(t *testing.T) {
 			userId: 1,
 		}
 
-		err := cartStorage.DeleteItemsByUserId(minimock.AnyContext, inputData.userId)
+		err := cartStorage.DeleteItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
 		require.NoError(t, err)
 	})
 
@@ -178,17 +208,376 @@ func TestInMemoryCartStorage_DeleteItemsByUserId(t *testing.T) {
 			name:   "Product name",
 		}
 
-		err := cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, err := cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		require.NoError(t, err)
 
-		err = cartStorage.DeleteItemsByUserId(minimock.AnyContext, inputData.userId)
+		err = cartStorage.DeleteItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
+		require.NoError(t, err)
+
+		_, err = cartStorage.GetItemsByOwner(minimock.AnyContext, models.UserCart(inputData.userId))
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+// ignoreCount drops the count reported by AddItem and MoveItem where the test checks only the error.
+func ignoreCount(_ uint16, err error) error {
+	return err
+}
+
+// itemCountStorage is the part of a cart storage covered by the shared item count and merge tests.
+type itemCountStorage interface {
+	AddItem(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) (uint16, error)
+	SetItemCount(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) error
+	ChangeItemCount(ctx context.Context, owner models.CartOwner, productId int64, delta int32) (uint16, error)
+	SetItemPrices(ctx context.Context, owner models.CartOwner, prices map[int64]uint32) error
+	GetItemsByOwner(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error)
+	SetPromoCode(ctx context.Context, owner models.CartOwner, code string) error
+	GetPromoCode(ctx context.Context, owner models.CartOwner) (string, error)
+	MergeItems(ctx context.Context, from models.CartOwner, to models.CartOwner, policy models.MergePolicy) error
+	MoveItem(ctx context.Context, from models.CartOwner, to models.CartOwner, productId int64) (uint16, error)
+}
+
+func testSetItemCount(t *testing.T, newStorage func(t *testing.T) itemCountStorage) {
+	product := models.Product{SkuId: 1, Name: "Product name", Price: 100}
+
+	tests := []struct {
+		name    string
+		inCart  uint16
+		count   uint16
+		want    map[models.Product]uint16
+		wantErr error
+	}{
+		{"should add product missing in the cart", 0, 3, map[models.Product]uint16{product: 3}, nil},
+		{"should overwrite the count", 5, 3, map[models.Product]uint16{product: 3}, nil},
+		{"should remove product with 0", 5, 0, nil, ErrUserCartEmpty},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			cartStorage := newStorage(t)
+
+			if test.inCart > 0 {
+				require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), product.SkuId, product.Name, product.Price, test.inCart)))
+			}
+
+			require.NoError(t, cartStorage.SetItemCount(ctx, models.UserCart(1), product.SkuId, product.Name, product.Price, test.count))
+
+			got, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.want, got)
+		})
+	}
+}
+
+func testChangeItemCount(t *testing.T, newStorage func(t *testing.T) itemCountStorage) {
+	product := models.Product{SkuId: 1, Name: "Product name", Price: 100}
+
+	tests := []struct {
+		name      string
+		inCart    uint16
+		otherSku  bool
+		delta     int32
+		wantCount uint16
+		wantErr   error
+	}{
+		{"should increase the count", 2, false, 3, 5, nil},
+		{"should decrease the count", 5, false, -1, 4, nil},
+		{"should remove product when count drops to 0", 2, false, -2, 0, nil},
+		{"should remove product when count drops below 0", 2, false, -10, 0, nil},
+		{"should be error without user", 0, false, 1, 0, ErrUserNotFound},
+		{"should be error for product missing in the cart", 2, true, 1, 0, ErrItemNotFound},
+		{"should be error on uint16 overflow", 65535, false, 1, 0, ErrItemCountOverflow},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			cartStorage := newStorage(t)
+			skuId := product.SkuId
+
+			if test.otherSku {
+				skuId++
+			}
+
+			if test.inCart > 0 {
+				require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), product.SkuId, product.Name, product.Price, test.inCart)))
+			}
+
+			count, err := cartStorage.ChangeItemCount(ctx, models.UserCart(1), skuId, test.delta)
+			require.ErrorIs(t, err, test.wantErr)
+			require.Equal(t, test.wantCount, count)
+
+			if test.wantErr != nil || test.wantCount > 0 {
+				return
+			}
+
+			_, err = cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+			require.ErrorIs(t, err, ErrUserCartEmpty)
+		})
+	}
+}
+
+func testSetItemPrices(t *testing.T, newStorage func(t *testing.T) itemCountStorage) {
+	t.Run("should replace prices of products in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "First product", 100, 1)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 2, "Second product", 200, 2)))
+		require.NoError(t, cartStorage.SetItemPrices(ctx, models.UserCart(1), map[int64]uint32{1: 150, 3: 300}))
+
+		got, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
 		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{
+			{SkuId: 1, Name: "First product", Price: 150}:  1,
+			{SkuId: 2, Name: "Second product", Price: 200}: 2,
+		}, got)
+	})
 
-		_, err = cartStorage.GetItemsByUserId(minimock.AnyContext, inputData.userId)
+	t.Run("should be error without user", func(t *testing.T) {
+		t.Parallel()
+
+		err := newStorage(t).SetItemPrices(context.Background(), models.UserCart(1), map[int64]uint32{1: 150})
 		require.ErrorIs(t, err, ErrUserNotFound)
 	})
 }
 
+func testMergeItems(t *testing.T, newStorage func(t *testing.T) itemCountStorage) {
+	user := models.UserCart(1)
+	guest := models.GuestCart("0123456789abcdef")
+
+	tests := []struct {
+		name      string
+		policy    models.MergePolicy
+		wantItems map[models.Product]uint16
+	}{
+		{
+			name:   "should sum counts",
+			policy: models.MergeSum,
+			wantItems: map[models.Product]uint16{
+				{SkuId: 1, Name: "First product", Price: 100}:  5,
+				{SkuId: 2, Name: "Second product", Price: 200}: 1,
+			},
+		},
+		{
+			name:   "should keep the larger count",
+			policy: models.MergeMax,
+			wantItems: map[models.Product]uint16{
+				{SkuId: 1, Name: "First product", Price: 100}:  3,
+				{SkuId: 2, Name: "Second product", Price: 200}: 1,
+			},
+		},
+		{
+			name:   "should keep the user count",
+			policy: models.MergeKeepUser,
+			wantItems: map[models.Product]uint16{
+				{SkuId: 1, Name: "First product", Price: 100}:  2,
+				{SkuId: 2, Name: "Second product", Price: 200}: 1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			cartStorage := newStorage(t)
+
+			require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, user, 1, "First product", 100, 2)))
+			require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, guest, 1, "First product", 90, 3)))
+			require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, guest, 2, "Second product", 200, 1)))
+			require.NoError(t, cartStorage.SetPromoCode(ctx, guest, "SALE10"))
+
+			require.NoError(t, cartStorage.MergeItems(ctx, guest, user, test.policy))
+
+			got, err := cartStorage.GetItemsByOwner(ctx, user)
+			require.NoError(t, err)
+			require.Equal(t, test.wantItems, got)
+
+			code, err := cartStorage.GetPromoCode(ctx, user)
+			require.NoError(t, err)
+			require.Equal(t, "SALE10", code)
+
+			_, err = cartStorage.GetItemsByOwner(ctx, guest)
+			require.ErrorIs(t, err, ErrUserNotFound)
+		})
+	}
+
+	t.Run("should keep the user promo code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, user, 1, "First product", 100, 1)))
+		require.NoError(t, cartStorage.SetPromoCode(ctx, user, "USER"))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, guest, 2, "Second product", 200, 1)))
+		require.NoError(t, cartStorage.SetPromoCode(ctx, guest, "GUEST"))
+
+		require.NoError(t, cartStorage.MergeItems(ctx, guest, user, models.MergeSum))
+
+		code, err := cartStorage.GetPromoCode(ctx, user)
+		require.NoError(t, err)
+		require.Equal(t, "USER", code)
+	})
+
+	t.Run("should change nothing on overflow", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, user, 1, "First product", 100, 60000)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, guest, 1, "First product", 100, 10000)))
+
+		require.ErrorIs(t, cartStorage.MergeItems(ctx, guest, user, models.MergeSum), ErrItemCountOverflow)
+
+		got, err := cartStorage.GetItemsByOwner(ctx, guest)
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "First product", Price: 100}: 10000}, got)
+	})
+
+	t.Run("should be error without guest cart", func(t *testing.T) {
+		t.Parallel()
+
+		err := newStorage(t).MergeItems(context.Background(), guest, user, models.MergeSum)
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func testMoveItem(t *testing.T, newStorage func(t *testing.T) itemCountStorage) {
+	cart := models.UserCart(1)
+	list := cart.WithList(models.ListSavedForLater)
+
+	t.Run("should move product into the list", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, cart, 1, "First product", 100, 2)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, cart, 2, "Second product", 200, 1)))
+
+		require.NoError(t, ignoreCount(cartStorage.MoveItem(ctx, cart, list, 1)))
+
+		got, err := cartStorage.GetItemsByOwner(ctx, list)
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "First product", Price: 100}: 2}, got)
+
+		got, err = cartStorage.GetItemsByOwner(ctx, cart)
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 2, Name: "Second product", Price: 200}: 1}, got)
+	})
+
+	t.Run("should add the count to the product in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, cart, 1, "First product", 100, 2)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, list, 1, "First product", 90, 3)))
+
+		count, err := cartStorage.MoveItem(ctx, list, cart, 1)
+		require.NoError(t, err)
+		require.Equal(t, uint16(5), count)
+
+		got, err := cartStorage.GetItemsByOwner(ctx, cart)
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "First product", Price: 100}: 5}, got)
+
+		_, err = cartStorage.GetItemsByOwner(ctx, list)
+		require.ErrorIs(t, err, ErrUserCartEmpty)
+	})
+
+	t.Run("should change nothing on overflow", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, cart, 1, "First product", 100, 60000)))
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, list, 1, "First product", 100, 10000)))
+
+		require.ErrorIs(t, ignoreCount(cartStorage.MoveItem(ctx, list, cart, 1)), ErrItemCountOverflow)
+
+		got, err := cartStorage.GetItemsByOwner(ctx, list)
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "First product", Price: 100}: 10000}, got)
+	})
+
+	t.Run("should be error for product missing in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage := newStorage(t)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, cart, 1, "First product", 100, 1)))
+		require.ErrorIs(t, ignoreCount(cartStorage.MoveItem(ctx, cart, list, 2)), ErrItemNotFound)
+	})
+
+	t.Run("should be error without cart", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newStorage(t).MoveItem(context.Background(), cart, list, 1)
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestInMemoryCartStorage_SetItemCount(t *testing.T) {
+	t.Parallel()
+
+	testSetItemCount(t, func(t *testing.T) itemCountStorage {
+		return NewInMemoryCartStorage()
+	})
+}
+
+func TestInMemoryCartStorage_ChangeItemCount(t *testing.T) {
+	t.Parallel()
+
+	testChangeItemCount(t, func(t *testing.T) itemCountStorage {
+		return NewInMemoryCartStorage()
+	})
+}
+
+func TestInMemoryCartStorage_SetItemPrices(t *testing.T) {
+	t.Parallel()
+
+	testSetItemPrices(t, func(t *testing.T) itemCountStorage {
+		return NewInMemoryCartStorage()
+	})
+}
+
+func TestInMemoryCartStorage_MergeItems(t *testing.T) {
+	t.Parallel()
+
+	testMergeItems(t, func(t *testing.T) itemCountStorage {
+		return NewInMemoryCartStorage()
+	})
+}
+
+func TestInMemoryCartStorage_MoveItem(t *testing.T) {
+	t.Parallel()
+
+	testMoveItem(t, func(t *testing.T) itemCountStorage {
+		return NewInMemoryCartStorage()
+	})
+}
+
 func BenchmarkInMemoryCartStorage_AddItem(b *testing.B) {
 	cartStorage := NewInMemoryCartStorage()
 
@@ -200,7 +589,7 @@ func BenchmarkInMemoryCartStorage_AddItem(b *testing.B) {
 	}
 
 	for n := 0; n < b.N; n++ {
-		_ = cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, _ = cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 	}
 }
 
@@ -216,8 +605,8 @@ func BenchmarkInMemoryCartStorage_RemoveItem(b *testing.B) {
 
 	for n := 0; n < b.N; n++ {
 		b.StopTimer()
-		_ = cartStorage.AddItem(minimock.AnyContext, inputData.userId, inputData.skuId, inputData.name, inputData.count)
+		_, _ = cartStorage.AddItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId, inputData.name, inputData.price, inputData.count)
 		b.StartTimer()
-		_ = cartStorage.RemoveItem(minimock.AnyContext, inputData.userId, inputData.skuId)
+		_ = cartStorage.RemoveItem(minimock.AnyContext, models.UserCart(inputData.userId), inputData.skuId)
 	}
 }
@@ -0,0 +1,29 @@
+-- name: StartCheckout :execrows
+insert into checkouts (user_id, token, status, order_id, expires_at)
+values ($1, $2, $3, 0, $4)
+on conflict (user_id) do update
+set token = excluded.token, status = excluded.status, order_id = 0, expires_at = excluded.expires_at
+where checkouts.expires_at < $5;
+
+-- name: UpdateCheckoutStatus :exec
+update checkouts
+set status = $3, order_id = $4
+where user_id = $1 and token = $2;
+
+-- name: DeleteCheckout :exec
+delete from checkouts
+where user_id = $1 and token = $2;
+
+-- name: GetCheckoutOrder :one
+select order_id from checkout_orders
+where user_id = $1 and idempotency_key = $2 and expires_at > $3;
+
+-- name: InsertCheckoutOrder :exec
+insert into checkout_orders (user_id, idempotency_key, order_id, expires_at)
+values ($1, $2, $3, $4)
+on conflict (user_id, idempotency_key) do update
+set order_id = excluded.order_id, expires_at = excluded.expires_at;
+
+-- name: DeleteExpiredCheckoutOrders :exec
+delete from checkout_orders
+where expires_at < $1;
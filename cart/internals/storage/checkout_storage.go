@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"route256.ozon.ru/project/cart/models"
+	"sync"
+	"time"
+)
+
+type checkoutState struct {
+	token     string
+	status    models.CheckoutStatus
+	orderId   int64
+	expiresAt time.Time
+}
+
+type checkoutOrderId struct {
+	userId int64
+	key    string
+}
+
+type checkoutOrder struct {
+	orderId   int64
+	expiresAt time.Time
+}
+
+// InMemoryCheckoutStorage keeps the checkouts of this instance only, so it suits a single instance of the service.
+type InMemoryCheckoutStorage struct {
+	mx     sync.Mutex
+	states map[int64]checkoutState
+	orders map[checkoutOrderId]checkoutOrder
+}
+
+func NewInMemoryCheckoutStorage() *InMemoryCheckoutStorage {
+	return &InMemoryCheckoutStorage{
+		states: make(map[int64]checkoutState),
+		orders: make(map[checkoutOrderId]checkoutOrder),
+	}
+}
+
+// StartCheckout locks the cart of the user for ttl and returns the token of the checkout, nothing is started
+// while another checkout of the user is running.
+func (store *InMemoryCheckoutStorage) StartCheckout(ctx context.Context, userId int64, ttl time.Duration) (string, bool, error) {
+	token, err := newCheckoutToken()
+
+	if err != nil {
+		return "", false, err
+	}
+
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	now := time.Now()
+
+	if state, ok := store.states[userId]; ok && now.Before(state.expiresAt) {
+		return "", false, nil
+	}
+
+	store.states[userId] = checkoutState{token: token, status: models.CheckoutStarted, expiresAt: now.Add(ttl)}
+	return token, true, nil
+}
+
+// SetCheckoutStatus records the status of the checkout of token, a checkout taken over by another token is left as is.
+func (store *InMemoryCheckoutStorage) SetCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if state, ok := store.states[userId]; ok && state.token == token {
+		state.status = status
+		state.orderId = orderId
+		store.states[userId] = state
+	}
+
+	return nil
+}
+
+// FinishCheckout unlocks the cart if it's still locked by the checkout of token.
+func (store *InMemoryCheckoutStorage) FinishCheckout(ctx context.Context, userId int64, token string) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if state, ok := store.states[userId]; ok && state.token == token {
+		delete(store.states, userId)
+	}
+
+	return nil
+}
+
+func (store *InMemoryCheckoutStorage) GetCheckoutOrder(ctx context.Context, userId int64, key string) (int64, bool, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	order, ok := store.orders[checkoutOrderId{userId, key}]
+
+	if !ok || time.Now().After(order.expiresAt) {
+		return 0, false, nil
+	}
+
+	return order.orderId, true, nil
+}
+
+func (store *InMemoryCheckoutStorage) SaveCheckoutOrder(ctx context.Context, userId int64, key string, orderId int64, ttl time.Duration) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	now := time.Now()
+
+	for k, order := range store.orders {
+		if now.After(order.expiresAt) {
+			delete(store.orders, k)
+		}
+	}
+
+	store.orders[checkoutOrderId{userId, key}] = checkoutOrder{
+		orderId:   orderId,
+		expiresAt: now.Add(ttl),
+	}
+
+	return nil
+}
+
+// newCheckoutToken returns a random token that tells the checkout holding the lock from the ones that held it before.
+func newCheckoutToken() (string, error) {
+	token := make([]byte, 16)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+	"time"
+)
+
+type checkoutStorage interface {
+	StartCheckout(ctx context.Context, userId int64, ttl time.Duration) (string, bool, error)
+	SetCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) error
+	FinishCheckout(ctx context.Context, userId int64, token string) error
+	GetCheckoutOrder(ctx context.Context, userId int64, key string) (int64, bool, error)
+	SaveCheckoutOrder(ctx context.Context, userId int64, key string, orderId int64, ttl time.Duration) error
+}
+
+func newRedisCheckoutStorage(t *testing.T) (*RedisCheckoutStorage, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return NewRedisCheckoutStorage(client), server
+}
+
+func testCheckoutStorage(t *testing.T, newStorage func(t *testing.T) checkoutStorage) {
+	t.Run("should start one checkout of the user at a time", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts := newStorage(t)
+
+		token, started, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+		require.NotEmpty(t, token)
+
+		require.NoError(t, checkouts.SetCheckoutStatus(ctx, 1, token, models.CheckoutOrderCreated, 10))
+
+		_, started, err = checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.False(t, started)
+
+		otherToken, started, err := checkouts.StartCheckout(ctx, 2, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+		require.NotEqual(t, token, otherToken)
+
+		require.NoError(t, checkouts.FinishCheckout(ctx, 1, token))
+
+		_, started, err = checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+	})
+
+	t.Run("should not finish the checkout of another token", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts := newStorage(t)
+
+		_, started, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+
+		require.NoError(t, checkouts.SetCheckoutStatus(ctx, 1, "other", models.CheckoutFailed, 0))
+		require.NoError(t, checkouts.FinishCheckout(ctx, 1, "other"))
+
+		_, started, err = checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.False(t, started)
+	})
+
+	t.Run("should ignore the status of a missing checkout", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts := newStorage(t)
+
+		require.NoError(t, checkouts.SetCheckoutStatus(ctx, 1, "token", models.CheckoutFailed, 0))
+
+		_, started, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+	})
+
+	t.Run("should return the order of the idempotency key", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts := newStorage(t)
+
+		_, found, err := checkouts.GetCheckoutOrder(ctx, 1, "checkout-1")
+		require.NoError(t, err)
+		require.False(t, found)
+
+		require.NoError(t, checkouts.SaveCheckoutOrder(ctx, 1, "checkout-1", 10, time.Minute))
+
+		orderId, found, err := checkouts.GetCheckoutOrder(ctx, 1, "checkout-1")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, int64(10), orderId)
+
+		_, found, err = checkouts.GetCheckoutOrder(ctx, 2, "checkout-1")
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+}
+
+func TestInMemoryCheckoutStorage(t *testing.T) {
+	t.Parallel()
+
+	testCheckoutStorage(t, func(t *testing.T) checkoutStorage {
+		return NewInMemoryCheckoutStorage()
+	})
+
+	t.Run("should expire checkouts and orders", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts := NewInMemoryCheckoutStorage()
+
+		expiredToken, _, err := checkouts.StartCheckout(ctx, 1, 10*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, checkouts.SaveCheckoutOrder(ctx, 1, "checkout-1", 10, 10*time.Millisecond))
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, started, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+
+		// the expired checkout can't unlock the cart taken over since
+		require.NoError(t, checkouts.FinishCheckout(ctx, 1, expiredToken))
+
+		_, started, err = checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.False(t, started)
+
+		_, found, err := checkouts.GetCheckoutOrder(ctx, 1, "checkout-1")
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+}
+
+func TestRedisCheckoutStorage(t *testing.T) {
+	t.Parallel()
+
+	testCheckoutStorage(t, func(t *testing.T) checkoutStorage {
+		checkouts, _ := newRedisCheckoutStorage(t)
+		return checkouts
+	})
+
+	t.Run("should expire checkouts and orders", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		checkouts, server := newRedisCheckoutStorage(t)
+
+		expiredToken, _, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, checkouts.SetCheckoutStatus(ctx, 1, expiredToken, models.CheckoutOrderCreated, 10))
+		require.NoError(t, checkouts.SaveCheckoutOrder(ctx, 1, "checkout-1", 10, time.Hour))
+
+		server.FastForward(time.Minute + time.Second)
+
+		token, started, err := checkouts.StartCheckout(ctx, 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+
+		// the expired checkout can't touch the checkout taken over since
+		require.NoError(t, checkouts.SetCheckoutStatus(ctx, 1, expiredToken, models.CheckoutFailed, 10))
+		require.NoError(t, checkouts.FinishCheckout(ctx, 1, expiredToken))
+
+		value, err := server.Get(checkoutKey(1))
+		require.NoError(t, err)
+		require.Equal(t, checkoutValue(token, models.CheckoutStarted, 0), value)
+		require.Greater(t, server.TTL(checkoutKey(1)), time.Duration(0))
+
+		_, found, err := checkouts.GetCheckoutOrder(ctx, 1, "checkout-1")
+		require.NoError(t, err)
+		require.True(t, found)
+
+		server.FastForward(time.Hour)
+
+		_, found, err = checkouts.GetCheckoutOrder(ctx, 1, "checkout-1")
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"math"
+	storage "route256.ozon.ru/project/cart/internals/storage/sqlc"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+// pgxPool is the part of *pgxpool.Pool the storage uses, pgxmock implements it in tests.
+type pgxPool interface {
+	storage.DBTX
+	Begin(ctx context.Context) (pgx.Tx, error)
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+type PostgresCartStorage struct {
+	pool pgxPool
+}
+
+func NewPostgresCartStorage(pool *pgxpool.Pool) *PostgresCartStorage {
+	return &PostgresCartStorage{pool: pool}
+}
+
+// AddItem adds count of the product to the cart and returns the new count, nothing changes if the count doesn't fit into uint16.
+func (store *PostgresCartStorage) AddItem(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) (uint16, error) {
+	var newCount int32
+
+	err := pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		err := q.InsertCart(ctx, storage.InsertCartParams{
+			Owner:     owner.Key(),
+			CreatedAt: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		newCount, err = q.AddCartItem(ctx, storage.AddCartItemParams{
+			Owner: owner.Key(),
+			SkuID: productId,
+			Name:  productName,
+			Count: int32(count),
+			Price: int64(price),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if newCount > math.MaxUint16 {
+			return ErrItemCountOverflow
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(newCount), nil
+}
+
+func (store *PostgresCartStorage) RemoveItem(ctx context.Context, owner models.CartOwner, productId int64) error {
+	return pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, owner.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		return q.DeleteCartItem(ctx, storage.DeleteCartItemParams{
+			Owner: owner.Key(),
+			SkuID: productId,
+		})
+	})
+}
+
+// SetItemCount sets the count of the product in the cart, 0 removes the product.
+func (store *PostgresCartStorage) SetItemCount(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) error {
+	if count == 0 {
+		return store.RemoveItem(ctx, owner, productId)
+	}
+
+	return pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		err := q.InsertCart(ctx, storage.InsertCartParams{
+			Owner:     owner.Key(),
+			CreatedAt: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return q.SetCartItem(ctx, storage.SetCartItemParams{
+			Owner: owner.Key(),
+			SkuID: productId,
+			Name:  productName,
+			Count: int32(count),
+			Price: int64(price),
+		})
+	})
+}
+
+// SetItemPrices replaces the prices the user saw for the products of the cart, products missing in the cart are skipped.
+func (store *PostgresCartStorage) SetItemPrices(ctx context.Context, owner models.CartOwner, prices map[int64]uint32) error {
+	return pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, owner.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		for productId, price := range prices {
+			err := q.SetCartItemPrice(ctx, storage.SetCartItemPriceParams{
+				Owner: owner.Key(),
+				SkuID: productId,
+				Price: int64(price),
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ChangeItemCount adds the signed delta to the count of the product in the cart and returns the new count.
+// The product is removed when the count drops to 0 or below.
+func (store *PostgresCartStorage) ChangeItemCount(ctx context.Context, owner models.CartOwner, productId int64, delta int32) (uint16, error) {
+	var newCount int32
+
+	err := pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, owner.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		count, err := q.ChangeCartItemCount(ctx, storage.ChangeCartItemCountParams{
+			Owner: owner.Key(),
+			SkuID: productId,
+			Count: delta,
+		})
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrItemNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case count > math.MaxUint16:
+			return ErrItemCountOverflow
+		case count <= 0:
+			count = 0
+			err = q.DeleteCartItem(ctx, storage.DeleteCartItemParams{
+				Owner: owner.Key(),
+				SkuID: productId,
+			})
+		}
+
+		newCount = count
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(newCount), nil
+}
+
+// SetPromoCode applies the promo code to the cart, an empty code removes the applied one.
+func (store *PostgresCartStorage) SetPromoCode(ctx context.Context, owner models.CartOwner, code string) error {
+	rows, err := storage.New(store.pool).SetCartPromoCode(ctx, storage.SetCartPromoCodeParams{
+		PromoCode: code,
+		Owner:     owner.Key(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetPromoCode returns the promo code applied to the cart or an empty string.
+func (store *PostgresCartStorage) GetPromoCode(ctx context.Context, owner models.CartOwner) (string, error) {
+	code, err := storage.New(store.pool).GetCartPromoCode(ctx, owner.Key())
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return code.String, nil
+}
+
+// MergeItems moves the products of cart from into cart to, policy decides the count of a product that is in both
+// and the line of cart to is kept then. The promo code of cart from is moved if cart to has none, cart from is deleted.
+// Nothing changes if a count doesn't fit into uint16.
+func (store *PostgresCartStorage) MergeItems(ctx context.Context, from models.CartOwner, to models.CartOwner, policy models.MergePolicy) error {
+	return pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, from.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		err := q.InsertCart(ctx, storage.InsertCartParams{
+			Owner:     to.Key(),
+			CreatedAt: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		err = q.MergeCartItems(ctx, storage.MergeCartItemsParams{
+			ToOwner:   to.Key(),
+			FromOwner: from.Key(),
+			Policy:    string(policy),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		maxCount, err := q.GetMaxCartItemCount(ctx, to.Key())
+
+		if err != nil {
+			return err
+		}
+
+		if maxCount > math.MaxUint16 {
+			return ErrItemCountOverflow
+		}
+
+		err = q.MergeCartPromoCode(ctx, storage.MergeCartPromoCodeParams{
+			ToOwner:   to.Key(),
+			FromOwner: from.Key(),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return q.DeleteCart(ctx, from.Key())
+	})
+}
+
+// MoveItem moves the product from cart from into cart to and returns its count in cart to. The count is added
+// to the product if cart to has it and the line of cart to is kept then. Nothing changes if the count doesn't fit into uint16.
+func (store *PostgresCartStorage) MoveItem(ctx context.Context, from models.CartOwner, to models.CartOwner, productId int64) (uint16, error) {
+	var newCount int32
+
+	err := pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, from.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		err := q.InsertCart(ctx, storage.InsertCartParams{
+			Owner:     to.Key(),
+			CreatedAt: pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		newCount, err = q.MoveCartItem(ctx, storage.MoveCartItemParams{
+			ToOwner:   to.Key(),
+			FromOwner: from.Key(),
+			SkuID:     productId,
+		})
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrItemNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if newCount > math.MaxUint16 {
+			return ErrItemCountOverflow
+		}
+
+		return q.DeleteCartItem(ctx, storage.DeleteCartItemParams{
+			Owner: from.Key(),
+			SkuID: productId,
+		})
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(newCount), nil
+}
+
+func (store *PostgresCartStorage) DeleteItemsByOwner(ctx context.Context, owner models.CartOwner) error {
+	return storage.New(store.pool).DeleteCart(ctx, owner.Key())
+}
+
+func (store *PostgresCartStorage) GetItemsByOwner(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error) {
+	var items []storage.CartItem
+
+	err := pgx.BeginTxFunc(ctx, store.pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if _, err := q.GetCart(ctx, owner.Key()); err != nil {
+			return handleSqlError(err)
+		}
+
+		cartItems, err := q.GetCartItems(ctx, owner.Key())
+		items = cartItems
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrUserCartEmpty
+	}
+
+	products := make(map[models.Product]uint16, len(items))
+
+	for _, item := range items {
+		products[models.Product{SkuId: item.SkuID, Name: item.Name, Price: uint32(item.Price)}] = uint16(item.Count)
+	}
+
+	return products, nil
+}
+
+func handleSqlError(err error) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrUserNotFound
+	default:
+		return err
+	}
+}
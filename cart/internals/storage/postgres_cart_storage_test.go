@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+)
+
+// expectCommit expects the end of a successful pgx.BeginFunc, it rolls back the closed transaction in a defer.
+func expectCommit(conn pgxmock.PgxPoolIface) {
+	conn.ExpectCommit()
+	conn.ExpectRollback().WillReturnError(pgx.ErrTxClosed)
+}
+
+// expectRollback expects the end of a failed pgx.BeginFunc, it rolls back the closed transaction in a defer.
+func expectRollback(conn pgxmock.PgxPoolIface) {
+	conn.ExpectRollback()
+	conn.ExpectRollback().WillReturnError(pgx.ErrTxClosed)
+}
+
+func newPostgresCartStorage(t *testing.T) (*PostgresCartStorage, pgxmock.PgxPoolIface) {
+	conn, err := pgxmock.NewPool()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.ExpectationsWereMet())
+	})
+
+	return &PostgresCartStorage{pool: conn}, conn
+}
+
+func TestPostgresCartStorage_AddItem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should be summarize with the product in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectExec("insert into carts").WithArgs("1", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		conn.ExpectQuery("insert into cart_items").
+			WithArgs("1", int64(1), "Product name", int32(3), int64(100)).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(5)))
+		expectCommit(conn)
+
+		count, err := cartStorage.AddItem(context.Background(), models.UserCart(1), 1, "Product name", 100, 3)
+		require.NoError(t, err)
+		require.Equal(t, uint16(5), count)
+	})
+
+	t.Run("should be error on uint16 overflow", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectExec("insert into carts").WithArgs("1", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		conn.ExpectQuery("insert into cart_items").
+			WithArgs("1", int64(1), "Product name", int32(1), int64(100)).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(65536)))
+		expectRollback(conn)
+
+		require.ErrorIs(t, ignoreCount(cartStorage.AddItem(context.Background(), models.UserCart(1), 1, "Product name", 100, 1)), ErrItemCountOverflow)
+	})
+}
+
+func TestPostgresCartStorage_RemoveItem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should remove product from the cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow("1", pgtype.Timestamp{}))
+		conn.ExpectExec("delete from cart_items").WithArgs("1", int64(1)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		expectCommit(conn)
+
+		require.NoError(t, cartStorage.RemoveItem(context.Background(), models.UserCart(1), 1))
+	})
+
+	t.Run("should be error without cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		require.ErrorIs(t, cartStorage.RemoveItem(context.Background(), models.UserCart(1), 1), ErrUserNotFound)
+	})
+}
+
+func TestPostgresCartStorage_ChangeItemCount(t *testing.T) {
+	t.Parallel()
+
+	// expectChange expects the count of product 1 in the cart of user 1 to be changed by delta
+	expectChange := func(conn pgxmock.PgxPoolIface, delta int32) *pgxmock.ExpectedQuery {
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow("1", pgtype.Timestamp{}))
+
+		return conn.ExpectQuery("update cart_items").WithArgs("1", int64(1), delta)
+	}
+
+	t.Run("should return the new count", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectChange(conn, -2).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(3)))
+		expectCommit(conn)
+
+		count, err := cartStorage.ChangeItemCount(context.Background(), models.UserCart(1), 1, -2)
+		require.NoError(t, err)
+		require.Equal(t, uint16(3), count)
+	})
+
+	t.Run("should remove product when the count drops to zero", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectChange(conn, -5).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(-2)))
+		conn.ExpectExec("delete from cart_items").WithArgs("1", int64(1)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		expectCommit(conn)
+
+		count, err := cartStorage.ChangeItemCount(context.Background(), models.UserCart(1), 1, -5)
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+
+	t.Run("should be error on uint16 overflow", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectChange(conn, 1).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(65536)))
+		expectRollback(conn)
+
+		_, err := cartStorage.ChangeItemCount(context.Background(), models.UserCart(1), 1, 1)
+		require.ErrorIs(t, err, ErrItemCountOverflow)
+	})
+
+	t.Run("should be error for product missing in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectChange(conn, 1).WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		_, err := cartStorage.ChangeItemCount(context.Background(), models.UserCart(1), 1, 1)
+		require.ErrorIs(t, err, ErrItemNotFound)
+	})
+
+	t.Run("should be error without cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		_, err := cartStorage.ChangeItemCount(context.Background(), models.UserCart(1), 1, 1)
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestPostgresCartStorage_GetItemsByOwner(t *testing.T) {
+	t.Parallel()
+
+	readOnly := pgx.TxOptions{AccessMode: pgx.ReadOnly}
+
+	t.Run("should return products of the cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBeginTx(readOnly)
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow("1", pgtype.Timestamp{}))
+		conn.ExpectQuery("select owner, sku_id, name, count, price from cart_items").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "sku_id", "name", "count", "price"}).
+				AddRow("1", int64(1), "First product", int32(2), int64(100)).
+				AddRow("1", int64(2), "Second product", int32(1), int64(200)))
+		expectCommit(conn)
+
+		got, err := cartStorage.GetItemsByOwner(context.Background(), models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{
+			{SkuId: 1, Name: "First product", Price: 100}:  2,
+			{SkuId: 2, Name: "Second product", Price: 200}: 1,
+		}, got)
+	})
+
+	t.Run("should be error for empty cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBeginTx(readOnly)
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow("1", pgtype.Timestamp{}))
+		conn.ExpectQuery("select owner, sku_id, name, count, price from cart_items").WithArgs("1").
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "sku_id", "name", "count", "price"}))
+		expectCommit(conn)
+
+		_, err := cartStorage.GetItemsByOwner(context.Background(), models.UserCart(1))
+		require.ErrorIs(t, err, ErrUserCartEmpty)
+	})
+
+	t.Run("should be error without cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBeginTx(readOnly)
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs("1").WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		_, err := cartStorage.GetItemsByOwner(context.Background(), models.UserCart(1))
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
+
+func TestPostgresCartStorage_MergeItems(t *testing.T) {
+	t.Parallel()
+
+	guest := models.GuestCart("0123456789abcdef")
+
+	// expectMerge expects the products of the guest cart to be merged into the cart of user 1 by the max policy
+	expectMerge := func(conn pgxmock.PgxPoolIface) *pgxmock.ExpectedQuery {
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs(guest.Key()).
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow(guest.Key(), pgtype.Timestamp{}))
+		conn.ExpectExec("insert into carts").WithArgs("1", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		conn.ExpectExec("insert into cart_items").WithArgs("1", guest.Key(), string(models.MergeMax)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+		return conn.ExpectQuery("select coalesce").WithArgs("1")
+	}
+
+	t.Run("should merge guest cart and delete it", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectMerge(conn).WillReturnRows(pgxmock.NewRows([]string{"coalesce"}).AddRow(int32(5)))
+		conn.ExpectExec("update carts").WithArgs("1", guest.Key()).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		conn.ExpectExec("delete from carts").WithArgs(guest.Key()).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		expectCommit(conn)
+
+		require.NoError(t, cartStorage.MergeItems(context.Background(), guest, models.UserCart(1), models.MergeMax))
+	})
+
+	t.Run("should change nothing on overflow", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectMerge(conn).WillReturnRows(pgxmock.NewRows([]string{"coalesce"}).AddRow(int32(65536)))
+		expectRollback(conn)
+
+		require.ErrorIs(t, cartStorage.MergeItems(context.Background(), guest, models.UserCart(1), models.MergeMax), ErrItemCountOverflow)
+	})
+
+	t.Run("should be error without guest cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs(guest.Key()).WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		require.ErrorIs(t, cartStorage.MergeItems(context.Background(), guest, models.UserCart(1), models.MergeMax), ErrUserNotFound)
+	})
+}
+
+func TestPostgresCartStorage_MoveItem(t *testing.T) {
+	t.Parallel()
+
+	cart := models.UserCart(1)
+	list := cart.WithList(models.ListSavedForLater)
+
+	// expectMove expects product 1 to be moved from the list into the cart
+	expectMove := func(conn pgxmock.PgxPoolIface) *pgxmock.ExpectedQuery {
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs(list.Key()).
+			WillReturnRows(pgxmock.NewRows([]string{"owner", "created_at"}).AddRow(list.Key(), pgtype.Timestamp{}))
+		conn.ExpectExec("insert into carts").WithArgs(cart.Key(), pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		return conn.ExpectQuery("insert into cart_items").WithArgs(cart.Key(), list.Key(), int64(1))
+	}
+
+	t.Run("should return the count in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectMove(conn).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(5)))
+		conn.ExpectExec("delete from cart_items").WithArgs(list.Key(), int64(1)).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		expectCommit(conn)
+
+		count, err := cartStorage.MoveItem(context.Background(), list, cart, 1)
+		require.NoError(t, err)
+		require.Equal(t, uint16(5), count)
+	})
+
+	t.Run("should change nothing on overflow", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectMove(conn).WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int32(70000)))
+		expectRollback(conn)
+
+		_, err := cartStorage.MoveItem(context.Background(), list, cart, 1)
+		require.ErrorIs(t, err, ErrItemCountOverflow)
+	})
+
+	t.Run("should be error for product missing in the list", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		expectMove(conn).WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		_, err := cartStorage.MoveItem(context.Background(), list, cart, 1)
+		require.ErrorIs(t, err, ErrItemNotFound)
+	})
+
+	t.Run("should be error without list", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, conn := newPostgresCartStorage(t)
+
+		conn.ExpectBegin()
+		conn.ExpectQuery("select owner, created_at from carts").WithArgs(list.Key()).WillReturnError(pgx.ErrNoRows)
+		expectRollback(conn)
+
+		_, err := cartStorage.MoveItem(context.Background(), list, cart, 1)
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	storage "route256.ozon.ru/project/cart/internals/storage/sqlc"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+// PostgresCheckoutStorage shares the checkouts between the replicas. A running checkout is a row
+// that can be taken over only after it expires, so a checkout of a crashed replica doesn't lock the cart forever.
+// The row is changed and deleted only by the token of the checkout that has taken it.
+type PostgresCheckoutStorage struct {
+	pool pgxPool
+}
+
+func NewPostgresCheckoutStorage(pool *pgxpool.Pool) *PostgresCheckoutStorage {
+	return &PostgresCheckoutStorage{pool: pool}
+}
+
+func (store *PostgresCheckoutStorage) StartCheckout(ctx context.Context, userId int64, ttl time.Duration) (string, bool, error) {
+	token, err := newCheckoutToken()
+
+	if err != nil {
+		return "", false, err
+	}
+
+	now := time.Now().UTC()
+
+	rows, err := storage.New(store.pool).StartCheckout(ctx, storage.StartCheckoutParams{
+		UserID:      userId,
+		Token:       token,
+		Status:      int32(models.CheckoutStarted),
+		ExpiresAt:   pgtype.Timestamp{Time: now.Add(ttl), Valid: true},
+		ExpiresAt_2: pgtype.Timestamp{Time: now, Valid: true},
+	})
+
+	if err != nil || rows == 0 {
+		return "", false, err
+	}
+
+	return token, true, nil
+}
+
+func (store *PostgresCheckoutStorage) SetCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) error {
+	return storage.New(store.pool).UpdateCheckoutStatus(ctx, storage.UpdateCheckoutStatusParams{
+		UserID:  userId,
+		Token:   token,
+		Status:  int32(status),
+		OrderID: orderId,
+	})
+}
+
+func (store *PostgresCheckoutStorage) FinishCheckout(ctx context.Context, userId int64, token string) error {
+	return storage.New(store.pool).DeleteCheckout(ctx, storage.DeleteCheckoutParams{
+		UserID: userId,
+		Token:  token,
+	})
+}
+
+func (store *PostgresCheckoutStorage) GetCheckoutOrder(ctx context.Context, userId int64, key string) (int64, bool, error) {
+	orderId, err := storage.New(store.pool).GetCheckoutOrder(ctx, storage.GetCheckoutOrderParams{
+		UserID:         userId,
+		IdempotencyKey: key,
+		ExpiresAt:      pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return orderId, true, nil
+}
+
+func (store *PostgresCheckoutStorage) SaveCheckoutOrder(ctx context.Context, userId int64, key string, orderId int64, ttl time.Duration) error {
+	now := time.Now().UTC()
+
+	return pgx.BeginFunc(ctx, store.pool, func(tx pgx.Tx) error {
+		q := storage.New(tx)
+
+		if err := q.DeleteExpiredCheckoutOrders(ctx, pgtype.Timestamp{Time: now, Valid: true}); err != nil {
+			return err
+		}
+
+		return q.InsertCheckoutOrder(ctx, storage.InsertCheckoutOrderParams{
+			UserID:         userId,
+			IdempotencyKey: key,
+			OrderID:        orderId,
+			ExpiresAt:      pgtype.Timestamp{Time: now.Add(ttl), Valid: true},
+		})
+	})
+}
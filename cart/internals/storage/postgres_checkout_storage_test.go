@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+	"time"
+)
+
+// timestampNear matches a timestamp within a second of want.
+type timestampNear struct {
+	want time.Time
+}
+
+func (a timestampNear) Match(v any) bool {
+	ts, ok := v.(pgtype.Timestamp)
+	return ok && ts.Valid && ts.Time.Sub(a.want).Abs() < time.Second
+}
+
+// capturedString matches any string and keeps it.
+type capturedString struct {
+	value *string
+}
+
+func (a capturedString) Match(v any) bool {
+	s, ok := v.(string)
+	*a.value = s
+	return ok
+}
+
+func newPostgresCheckoutStorage(t *testing.T) (*PostgresCheckoutStorage, pgxmock.PgxPoolIface) {
+	conn, err := pgxmock.NewPool()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.ExpectationsWereMet())
+	})
+
+	return &PostgresCheckoutStorage{pool: conn}, conn
+}
+
+func TestPostgresCheckoutStorage_StartCheckout(t *testing.T) {
+	t.Parallel()
+
+	// the running checkout is taken over only after it has expired
+	startQuery := regexp.QuoteMeta("on conflict (user_id) do update") + ".*" + regexp.QuoteMeta("where checkouts.expires_at < $5")
+
+	t.Run("should take a missing or expired checkout", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+		var sentToken string
+		now := time.Now().UTC()
+
+		conn.ExpectExec(startQuery).
+			WithArgs(int64(1), capturedString{&sentToken}, int32(models.CheckoutStarted), timestampNear{now.Add(time.Minute)}, timestampNear{now}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		token, started, err := checkouts.StartCheckout(context.Background(), 1, time.Minute)
+		require.NoError(t, err)
+		require.True(t, started)
+		require.NotEmpty(t, token)
+		require.Equal(t, sentToken, token)
+	})
+
+	t.Run("should not take a running checkout", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+		now := time.Now().UTC()
+
+		conn.ExpectExec(startQuery).
+			WithArgs(int64(1), pgxmock.AnyArg(), int32(models.CheckoutStarted), timestampNear{now.Add(time.Minute)}, timestampNear{now}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		token, started, err := checkouts.StartCheckout(context.Background(), 1, time.Minute)
+		require.NoError(t, err)
+		require.False(t, started)
+		require.Empty(t, token)
+	})
+}
+
+func TestPostgresCheckoutStorage_FinishCheckout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should set the status of the checkout of the token", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+
+		conn.ExpectExec(regexp.QuoteMeta("where user_id = $1 and token = $2")).
+			WithArgs(int64(1), "token", int32(models.CheckoutOrderCreated), int64(10)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		require.NoError(t, checkouts.SetCheckoutStatus(context.Background(), 1, "token", models.CheckoutOrderCreated, 10))
+	})
+
+	t.Run("should delete the checkout of the token", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+
+		conn.ExpectExec(regexp.QuoteMeta("delete from checkouts\nwhere user_id = $1 and token = $2")).
+			WithArgs(int64(1), "token").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+		require.NoError(t, checkouts.FinishCheckout(context.Background(), 1, "token"))
+	})
+}
+
+func TestPostgresCheckoutStorage_CheckoutOrder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should return the order that hasn't expired", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+
+		conn.ExpectQuery(regexp.QuoteMeta("expires_at > $3")).
+			WithArgs(int64(1), "checkout-1", timestampNear{time.Now().UTC()}).
+			WillReturnRows(pgxmock.NewRows([]string{"order_id"}).AddRow(int64(10)))
+
+		orderId, found, err := checkouts.GetCheckoutOrder(context.Background(), 1, "checkout-1")
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, int64(10), orderId)
+	})
+
+	t.Run("should not find the expired order", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+
+		conn.ExpectQuery(regexp.QuoteMeta("expires_at > $3")).
+			WithArgs(int64(1), "checkout-1", timestampNear{time.Now().UTC()}).
+			WillReturnError(pgx.ErrNoRows)
+
+		_, found, err := checkouts.GetCheckoutOrder(context.Background(), 1, "checkout-1")
+		require.NoError(t, err)
+		require.False(t, found)
+	})
+
+	t.Run("should delete the expired orders when saving one", func(t *testing.T) {
+		t.Parallel()
+
+		checkouts, conn := newPostgresCheckoutStorage(t)
+		now := time.Now().UTC()
+
+		conn.ExpectBegin()
+		conn.ExpectExec("delete from checkout_orders").WithArgs(timestampNear{now}).WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		conn.ExpectExec("insert into checkout_orders").
+			WithArgs(int64(1), "checkout-1", int64(10), timestampNear{now.Add(time.Hour)}).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		expectCommit(conn)
+
+		require.NoError(t, checkouts.SaveCheckoutOrder(context.Background(), 1, "checkout-1", 10, time.Hour))
+	})
+}
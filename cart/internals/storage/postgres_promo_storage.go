@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	storage "route256.ozon.ru/project/cart/internals/storage/sqlc"
+	"route256.ozon.ru/project/cart/models"
+)
+
+type PostgresPromoStorage struct {
+	pool pgxPool
+}
+
+func NewPostgresPromoStorage(pool *pgxpool.Pool) *PostgresPromoStorage {
+	return &PostgresPromoStorage{pool: pool}
+}
+
+func (store *PostgresPromoStorage) CreatePromo(ctx context.Context, promo models.Promo) error {
+	rows, err := storage.New(store.pool).InsertPromo(ctx, storage.InsertPromoParams(toPromoRow(promo)))
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrPromoExists
+	}
+
+	return nil
+}
+
+func (store *PostgresPromoStorage) UpdatePromo(ctx context.Context, promo models.Promo) error {
+	rows, err := storage.New(store.pool).UpdatePromo(ctx, storage.UpdatePromoParams(toPromoRow(promo)))
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrPromoNotFound
+	}
+
+	return nil
+}
+
+func (store *PostgresPromoStorage) DeletePromo(ctx context.Context, code string) error {
+	rows, err := storage.New(store.pool).DeletePromo(ctx, code)
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrPromoNotFound
+	}
+
+	return nil
+}
+
+func (store *PostgresPromoStorage) GetPromo(ctx context.Context, code string) (models.Promo, error) {
+	row, err := storage.New(store.pool).GetPromo(ctx, code)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Promo{}, ErrPromoNotFound
+	}
+
+	if err != nil {
+		return models.Promo{}, err
+	}
+
+	return fromPromoRow(row), nil
+}
+
+// ListPromos returns all the promo codes sorted by code.
+func (store *PostgresPromoStorage) ListPromos(ctx context.Context) ([]models.Promo, error) {
+	rows, err := storage.New(store.pool).ListPromos(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	promos := make([]models.Promo, len(rows))
+
+	for i, row := range rows {
+		promos[i] = fromPromoRow(row)
+	}
+
+	return promos, nil
+}
+
+func toPromoRow(promo models.Promo) storage.Promo {
+	return storage.Promo{
+		Code:      promo.Code,
+		Type:      string(promo.Type),
+		Percent:   int32(promo.Percent),
+		Amount:    int64(promo.Amount),
+		SkuID:     promo.SkuId,
+		BuyCount:  int32(promo.BuyCount),
+		FreeCount: int32(promo.FreeCount),
+		MinTotal:  int64(promo.MinTotal),
+	}
+}
+
+func fromPromoRow(row storage.Promo) models.Promo {
+	return models.Promo{
+		Code:      row.Code,
+		Type:      models.PromoType(row.Type),
+		Percent:   uint32(row.Percent),
+		Amount:    uint32(row.Amount),
+		SkuId:     row.SkuID,
+		BuyCount:  uint16(row.BuyCount),
+		FreeCount: uint16(row.FreeCount),
+		MinTotal:  uint32(row.MinTotal),
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+)
+
+var promoColumns = []string{"code", "type", "percent", "amount", "sku_id", "buy_count", "free_count", "min_total"}
+
+func newPostgresPromoStorage(t *testing.T) (*PostgresPromoStorage, pgxmock.PgxPoolIface) {
+	conn, err := pgxmock.NewPool()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.ExpectationsWereMet())
+	})
+
+	return &PostgresPromoStorage{pool: conn}, conn
+}
+
+func TestPostgresPromoStorage_CreatePromo(t *testing.T) {
+	t.Parallel()
+
+	promo := models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10, MinTotal: 1000}
+	insertQuery := regexp.QuoteMeta("insert into promos") + ".*" + regexp.QuoteMeta("on conflict (code) do nothing")
+
+	t.Run("should insert promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(insertQuery).
+			WithArgs("SALE10", "percent_off", int32(10), int64(0), int64(0), int32(0), int32(0), int64(1000)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+		require.NoError(t, promos.CreatePromo(context.Background(), promo))
+	})
+
+	t.Run("should be error on existing promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(insertQuery).
+			WithArgs("SALE10", "percent_off", int32(10), int64(0), int64(0), int32(0), int32(0), int64(1000)).
+			WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+		require.ErrorIs(t, promos.CreatePromo(context.Background(), promo), ErrPromoExists)
+	})
+}
+
+func TestPostgresPromoStorage_UpdatePromo(t *testing.T) {
+	t.Parallel()
+
+	promo := models.Promo{Code: "FREE", Type: models.PromoBuyNGetM, SkuId: 1, BuyCount: 2, FreeCount: 1}
+	updateQuery := regexp.QuoteMeta("update promos") + ".*" + regexp.QuoteMeta("where code = $1")
+
+	t.Run("should update promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(updateQuery).
+			WithArgs("FREE", "buy_n_get_m", int32(0), int64(0), int64(1), int32(2), int32(1), int64(0)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+		require.NoError(t, promos.UpdatePromo(context.Background(), promo))
+	})
+
+	t.Run("should be error on missing promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(updateQuery).
+			WithArgs("FREE", "buy_n_get_m", int32(0), int64(0), int64(1), int32(2), int32(1), int64(0)).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+		require.ErrorIs(t, promos.UpdatePromo(context.Background(), promo), ErrPromoNotFound)
+	})
+}
+
+func TestPostgresPromoStorage_DeletePromo(t *testing.T) {
+	t.Parallel()
+
+	deleteQuery := regexp.QuoteMeta("delete from promos")
+
+	t.Run("should delete promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(deleteQuery).
+			WithArgs("SALE10").
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+		require.NoError(t, promos.DeletePromo(context.Background(), "SALE10"))
+	})
+
+	t.Run("should be error on missing promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectExec(deleteQuery).
+			WithArgs("SALE10").
+			WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+		require.ErrorIs(t, promos.DeletePromo(context.Background(), "SALE10"), ErrPromoNotFound)
+	})
+}
+
+func TestPostgresPromoStorage_GetPromo(t *testing.T) {
+	t.Parallel()
+
+	getQuery := regexp.QuoteMeta("from promos") + `\s+` + regexp.QuoteMeta("where code = $1")
+
+	t.Run("should return promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectQuery(getQuery).
+			WithArgs("SALE10").
+			WillReturnRows(pgxmock.NewRows(promoColumns).
+				AddRow("SALE10", "fixed_off", int32(0), int64(300), int64(0), int32(0), int32(0), int64(1000)))
+
+		got, err := promos.GetPromo(context.Background(), "SALE10")
+		require.NoError(t, err)
+		require.Equal(t, models.Promo{Code: "SALE10", Type: models.PromoFixedOff, Amount: 300, MinTotal: 1000}, got)
+	})
+
+	t.Run("should be error on missing promo code", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectQuery(getQuery).
+			WithArgs("SALE10").
+			WillReturnError(pgx.ErrNoRows)
+
+		_, err := promos.GetPromo(context.Background(), "SALE10")
+		require.ErrorIs(t, err, ErrPromoNotFound)
+	})
+}
+
+func TestPostgresPromoStorage_ListPromos(t *testing.T) {
+	t.Parallel()
+
+	listQuery := regexp.QuoteMeta("from promos") + `\s+` + regexp.QuoteMeta("order by code")
+
+	t.Run("should list promo codes in the order of the query", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectQuery(listQuery).
+			WillReturnRows(pgxmock.NewRows(promoColumns).
+				AddRow("A", "fixed_off", int32(0), int64(100), int64(0), int32(0), int32(0), int64(0)).
+				AddRow("SALE10", "percent_off", int32(10), int64(0), int64(0), int32(0), int32(0), int64(0)))
+
+		got, err := promos.ListPromos(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []models.Promo{
+			{Code: "A", Type: models.PromoFixedOff, Amount: 100},
+			{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10},
+		}, got)
+	})
+
+	t.Run("should return empty list without promo codes", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+
+		conn.ExpectQuery(listQuery).WillReturnRows(pgxmock.NewRows(promoColumns))
+
+		got, err := promos.ListPromos(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("should be error on failed query", func(t *testing.T) {
+		t.Parallel()
+
+		promos, conn := newPostgresPromoStorage(t)
+		queryErr := errors.New("connection refused")
+
+		conn.ExpectQuery(listQuery).WillReturnError(queryErr)
+
+		_, err := promos.ListPromos(context.Background())
+		require.ErrorIs(t, err, queryErr)
+	})
+}
@@ -0,0 +1,21 @@
+-- name: InsertPromo :execrows
+insert into promos (code, type, percent, amount, sku_id, buy_count, free_count, min_total)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
+on conflict (code) do nothing;
+
+-- name: UpdatePromo :execrows
+update promos
+set type = $2, percent = $3, amount = $4, sku_id = $5, buy_count = $6, free_count = $7, min_total = $8
+where code = $1;
+
+-- name: DeletePromo :execrows
+delete from promos
+where code = $1;
+
+-- name: GetPromo :one
+select code, type, percent, amount, sku_id, buy_count, free_count, min_total from promos
+where code = $1;
+
+-- name: ListPromos :many
+select code, type, percent, amount, sku_id, buy_count, free_count, min_total from promos
+order by code;
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"route256.ozon.ru/project/cart/models"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrPromoNotFound = errors.New("promo code is not found")
+	ErrPromoExists   = errors.New("promo code already exists")
+)
+
+type InMemoryPromoStorage struct {
+	mx     sync.RWMutex
+	promos map[string]models.Promo
+}
+
+func NewInMemoryPromoStorage() *InMemoryPromoStorage {
+	return &InMemoryPromoStorage{
+		promos: make(map[string]models.Promo),
+	}
+}
+
+func (store *InMemoryPromoStorage) CreatePromo(ctx context.Context, promo models.Promo) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if _, ok := store.promos[promo.Code]; ok {
+		return ErrPromoExists
+	}
+
+	store.promos[promo.Code] = promo
+	return nil
+}
+
+func (store *InMemoryPromoStorage) UpdatePromo(ctx context.Context, promo models.Promo) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if _, ok := store.promos[promo.Code]; !ok {
+		return ErrPromoNotFound
+	}
+
+	store.promos[promo.Code] = promo
+	return nil
+}
+
+func (store *InMemoryPromoStorage) DeletePromo(ctx context.Context, code string) error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+
+	if _, ok := store.promos[code]; !ok {
+		return ErrPromoNotFound
+	}
+
+	delete(store.promos, code)
+	return nil
+}
+
+func (store *InMemoryPromoStorage) GetPromo(ctx context.Context, code string) (models.Promo, error) {
+	store.mx.RLock()
+	defer store.mx.RUnlock()
+
+	promo, ok := store.promos[code]
+
+	if !ok {
+		return models.Promo{}, ErrPromoNotFound
+	}
+
+	return promo, nil
+}
+
+// ListPromos returns all the promo codes sorted by code.
+func (store *InMemoryPromoStorage) ListPromos(ctx context.Context) ([]models.Promo, error) {
+	store.mx.RLock()
+	defer store.mx.RUnlock()
+
+	promos := make([]models.Promo, 0, len(store.promos))
+
+	for _, promo := range store.promos {
+		promos = append(promos, promo)
+	}
+
+	slices.SortFunc(promos, func(a, b models.Promo) int {
+		return cmp.Compare(a.Code, b.Code)
+	})
+
+	return promos, nil
+}
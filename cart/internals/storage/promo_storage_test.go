@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gojuno/minimock/v3"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+)
+
+type promoStorage interface {
+	CreatePromo(ctx context.Context, promo models.Promo) error
+	UpdatePromo(ctx context.Context, promo models.Promo) error
+	DeletePromo(ctx context.Context, code string) error
+	GetPromo(ctx context.Context, code string) (models.Promo, error)
+	ListPromos(ctx context.Context) ([]models.Promo, error)
+}
+
+func newRedisPromoStorage(t *testing.T) (*RedisPromoStorage, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return NewRedisPromoStorage(client), server
+}
+
+func testPromoStorage(t *testing.T, newStorage func(t *testing.T) promoStorage) {
+	promo := models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10}
+
+	t.Run("should create, update and delete promo code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		promos := newStorage(t)
+
+		require.NoError(t, promos.CreatePromo(ctx, promo))
+		require.ErrorIs(t, promos.CreatePromo(ctx, promo), ErrPromoExists)
+
+		updated := promo
+		updated.Percent = 20
+		require.NoError(t, promos.UpdatePromo(ctx, updated))
+
+		got, err := promos.GetPromo(ctx, promo.Code)
+		require.NoError(t, err)
+		require.Equal(t, updated, got)
+
+		require.NoError(t, promos.DeletePromo(ctx, promo.Code))
+		_, err = promos.GetPromo(ctx, promo.Code)
+		require.ErrorIs(t, err, ErrPromoNotFound)
+	})
+
+	t.Run("should not update or delete missing promo code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		promos := newStorage(t)
+
+		require.ErrorIs(t, promos.UpdatePromo(ctx, promo), ErrPromoNotFound)
+		require.ErrorIs(t, promos.DeletePromo(ctx, promo.Code), ErrPromoNotFound)
+
+		// the failed update must not create the code
+		_, err := promos.GetPromo(ctx, promo.Code)
+		require.ErrorIs(t, err, ErrPromoNotFound)
+	})
+
+	t.Run("should list promo codes sorted by code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		promos := newStorage(t)
+		first := models.Promo{Code: "A", Type: models.PromoFixedOff, Amount: 100}
+
+		got, err := promos.ListPromos(ctx)
+		require.NoError(t, err)
+		require.Empty(t, got)
+
+		require.NoError(t, promos.CreatePromo(ctx, promo))
+		require.NoError(t, promos.CreatePromo(ctx, first))
+
+		got, err = promos.ListPromos(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []models.Promo{first, promo}, got)
+	})
+}
+
+func TestInMemoryPromoStorage(t *testing.T) {
+	t.Parallel()
+
+	testPromoStorage(t, func(t *testing.T) promoStorage {
+		return NewInMemoryPromoStorage()
+	})
+}
+
+func TestRedisPromoStorage(t *testing.T) {
+	t.Parallel()
+
+	testPromoStorage(t, func(t *testing.T) promoStorage {
+		promos, _ := newRedisPromoStorage(t)
+		return promos
+	})
+
+	t.Run("should keep promo codes without expiration", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		promos, server := newRedisPromoStorage(t)
+
+		require.NoError(t, promos.CreatePromo(ctx, models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 10}))
+		require.NoError(t, promos.UpdatePromo(ctx, models.Promo{Code: "SALE10", Type: models.PromoPercentOff, Percent: 20}))
+
+		require.Zero(t, server.TTL(promosKey))
+		require.JSONEq(t, `{"code":"SALE10","type":"percent_off","percent":20}`, server.HGet(promosKey, "SALE10"))
+	})
+
+	t.Run("should be error on a broken promo code", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		promos, server := newRedisPromoStorage(t)
+
+		server.HSet(promosKey, "SALE10", "{")
+
+		_, err := promos.GetPromo(ctx, "SALE10")
+		require.ErrorContains(t, err, `broken promo code "SALE10"`)
+
+		_, err = promos.ListPromos(ctx)
+		require.ErrorContains(t, err, `broken promo code "SALE10"`)
+	})
+}
+
+func TestInMemoryCartStorage_PromoCode(t *testing.T) {
+	t.Parallel()
+
+	cartStorage := NewInMemoryCartStorage()
+
+	require.ErrorIs(t, cartStorage.SetPromoCode(minimock.AnyContext, models.UserCart(1), "SALE10"), ErrUserNotFound)
+	require.NoError(t, ignoreCount(cartStorage.AddItem(minimock.AnyContext, models.UserCart(1), 1, "Product name", 100, 1)))
+	require.NoError(t, cartStorage.SetPromoCode(minimock.AnyContext, models.UserCart(1), "SALE10"))
+
+	code, err := cartStorage.GetPromoCode(minimock.AnyContext, models.UserCart(1))
+	require.NoError(t, err)
+	require.Equal(t, "SALE10", code)
+
+	require.NoError(t, cartStorage.DeleteItemsByOwner(minimock.AnyContext, models.UserCart(1)))
+
+	code, err = cartStorage.GetPromoCode(minimock.AnyContext, models.UserCart(1))
+	require.NoError(t, err)
+	require.Empty(t, code)
+}
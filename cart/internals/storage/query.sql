@@ -0,0 +1,82 @@
+-- name: InsertCart :exec
+insert into carts (owner, created_at)
+values ($1, $2)
+on conflict (owner) do nothing;
+
+-- name: GetCart :one
+select owner, created_at from carts
+where owner = $1;
+
+-- name: DeleteCart :exec
+delete from carts
+where owner = $1;
+
+-- name: AddCartItem :one
+insert into cart_items (owner, sku_id, name, count, price)
+values ($1, $2, $3, $4, $5)
+on conflict (owner, sku_id) do update
+set count = cart_items.count + excluded.count, price = excluded.price
+returning count;
+
+-- name: SetCartItem :exec
+insert into cart_items (owner, sku_id, name, count, price)
+values ($1, $2, $3, $4, $5)
+on conflict (owner, sku_id) do update
+set count = excluded.count, price = excluded.price;
+
+-- name: SetCartItemPrice :exec
+update cart_items
+set price = $3
+where owner = $1 and sku_id = $2;
+
+-- name: ChangeCartItemCount :one
+update cart_items
+set count = count + $3
+where owner = $1 and sku_id = $2
+returning count;
+
+-- name: DeleteCartItem :exec
+delete from cart_items
+where owner = $1 and sku_id = $2;
+
+-- name: GetCartItems :many
+select owner, sku_id, name, count, price from cart_items
+where owner = $1;
+
+-- name: SetCartPromoCode :execrows
+update carts
+set promo_code = nullif(@promo_code::text, '')
+where owner = @owner;
+
+-- name: GetCartPromoCode :one
+select promo_code from carts
+where owner = $1;
+
+-- name: MergeCartItems :exec
+insert into cart_items (owner, sku_id, name, count, price)
+select @to_owner::text, sku_id, name, count, price from cart_items
+where cart_items.owner = @from_owner::text
+on conflict (owner, sku_id) do update
+set count = case @policy::text
+    when 'sum' then cart_items.count + excluded.count
+    when 'max' then greatest(cart_items.count, excluded.count)
+    else cart_items.count
+end;
+
+-- name: GetMaxCartItemCount :one
+select coalesce(max(count), 0)::int from cart_items
+where owner = $1;
+
+-- name: MergeCartPromoCode :exec
+update carts
+set promo_code = coalesce(carts.promo_code, guest.promo_code)
+from carts guest
+where carts.owner = @to_owner::text and guest.owner = @from_owner::text;
+
+-- name: MoveCartItem :one
+insert into cart_items (owner, sku_id, name, count, price)
+select @to_owner::text, sku_id, name, count, price from cart_items
+where cart_items.owner = @from_owner::text and cart_items.sku_id = @sku_id
+on conflict (owner, sku_id) do update
+set count = cart_items.count + excluded.count
+returning count;
@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"route256.ozon.ru/project/cart/models"
+	"strconv"
+	"time"
+)
+
+// RedisCartStorage keeps every cart as a hash of sku -> count. Product names and the prices the user saw
+// live in sibling hashes. Changes that read a count before writing it (adding, changing, merging and moving
+// products) run as Lua scripts, so replicas can change the same cart concurrently and a count that doesn't
+// fit into uint16 is rejected before anything is written. All keys expire after ttl without writes or reads.
+// The applied promo code has its own key, it is prolonged whenever the code is read.
+// User carts are keyed by the user id, guest carts by "guest:<session>".
+type RedisCartStorage struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// addItemScript adds ARGV[2] to the count of field ARGV[1] atomically, sets its name to ARGV[3] if it's missing
+// and its price to ARGV[4]. ARGV[5] is ttl and ARGV[6] is the marker field. It returns the new count
+// and -3 when the count doesn't fit into uint16.
+var addItemScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], ARGV[1])
+local newCount = tonumber(ARGV[2])
+
+if current then
+	newCount = newCount + tonumber(current)
+end
+
+if newCount > 65535 then
+	return -3
+end
+
+redis.call("HSET", KEYS[1], ARGV[6], 1)
+redis.call("HSET", KEYS[1], ARGV[1], newCount)
+redis.call("HSETNX", KEYS[2], ARGV[1], ARGV[3])
+redis.call("HSET", KEYS[3], ARGV[1], ARGV[4])
+
+for i = 1, 3 do
+	redis.call("EXPIRE", KEYS[i], ARGV[5])
+end
+
+return newCount
+`)
+
+// changeItemCountScript applies ARGV[2] to the count of field ARGV[1] atomically and returns the new count,
+// -1 for a missing cart, -2 for a missing product and -3 when the count doesn't fit into uint16.
+var changeItemCountScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+
+local count = redis.call("HGET", KEYS[1], ARGV[1])
+
+if not count then
+	return -2
+end
+
+local newCount = tonumber(count) + tonumber(ARGV[2])
+
+if newCount > 65535 then
+	return -3
+end
+
+if newCount <= 0 then
+	newCount = 0
+	redis.call("HDEL", KEYS[1], ARGV[1])
+	redis.call("HDEL", KEYS[2], ARGV[1])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+else
+	redis.call("HSET", KEYS[1], ARGV[1], newCount)
+end
+
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+redis.call("EXPIRE", KEYS[2], ARGV[3])
+redis.call("EXPIRE", KEYS[3], ARGV[3])
+
+return newCount
+`)
+
+// setItemPricesScript sets the prices of ARGV[2..] as pairs of field and price for the fields that are in the cart,
+// it returns -1 for a missing cart and 0 otherwise.
+var setItemPricesScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+
+for i = 2, #ARGV, 2 do
+	if redis.call("HEXISTS", KEYS[1], ARGV[i]) == 1 then
+		redis.call("HSET", KEYS[2], ARGV[i], ARGV[i + 1])
+	end
+end
+
+redis.call("EXPIRE", KEYS[1], ARGV[1])
+redis.call("EXPIRE", KEYS[2], ARGV[1])
+
+return 0
+`)
+
+// mergeItemsScript moves the cart of KEYS[1..4] into the cart of KEYS[5..8], both are counts, names, prices and promo code.
+// ARGV[1] is the merge policy, ARGV[2] is ttl and ARGV[3] is the marker field.
+// It returns -1 for a missing source cart, -3 when a count doesn't fit into uint16 and 0 otherwise.
+var mergeItemsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+
+local from = redis.call("HGETALL", KEYS[1])
+local merged = {}
+
+for i = 1, #from, 2 do
+	local field = from[i]
+
+	if field ~= ARGV[3] then
+		local count = tonumber(from[i + 1])
+		local current = redis.call("HGET", KEYS[5], field)
+
+		if current then
+			current = tonumber(current)
+
+			if ARGV[1] == "sum" then
+				count = current + count
+			elseif ARGV[1] == "max" then
+				count = math.max(current, count)
+			else
+				count = current
+			end
+		end
+
+		if count > 65535 then
+			return -3
+		end
+
+		merged[#merged + 1] = {field, count, current == false}
+	end
+end
+
+redis.call("HSET", KEYS[5], ARGV[3], 1)
+
+for _, line in ipairs(merged) do
+	local field = line[1]
+
+	if line[3] then
+		local name = redis.call("HGET", KEYS[2], field)
+		local price = redis.call("HGET", KEYS[3], field)
+
+		if name then
+			redis.call("HSET", KEYS[6], field, name)
+		end
+
+		if price then
+			redis.call("HSET", KEYS[7], field, price)
+		end
+	end
+
+	redis.call("HSET", KEYS[5], field, line[2])
+end
+
+if redis.call("EXISTS", KEYS[8]) == 0 then
+	local code = redis.call("GET", KEYS[4])
+
+	if code then
+		redis.call("SET", KEYS[8], code, "EX", ARGV[2])
+	end
+end
+
+redis.call("DEL", KEYS[1], KEYS[2], KEYS[3], KEYS[4])
+redis.call("EXPIRE", KEYS[5], ARGV[2])
+redis.call("EXPIRE", KEYS[6], ARGV[2])
+redis.call("EXPIRE", KEYS[7], ARGV[2])
+
+return 0
+`)
+
+// moveItemScript moves field ARGV[1] from the cart of KEYS[1..3] into the cart of KEYS[4..6], both are counts, names and prices.
+// ARGV[2] is ttl and ARGV[3] is the marker field. It returns the new count in the target cart,
+// -1 for a missing source cart, -2 for a missing product and -3 when the count doesn't fit into uint16.
+var moveItemScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+
+local count = redis.call("HGET", KEYS[1], ARGV[1])
+
+if not count then
+	return -2
+end
+
+local current = redis.call("HGET", KEYS[4], ARGV[1])
+local newCount = tonumber(count)
+
+if current then
+	newCount = newCount + tonumber(current)
+end
+
+if newCount > 65535 then
+	return -3
+end
+
+if not current then
+	local name = redis.call("HGET", KEYS[2], ARGV[1])
+	local price = redis.call("HGET", KEYS[3], ARGV[1])
+
+	if name then
+		redis.call("HSET", KEYS[5], ARGV[1], name)
+	end
+
+	if price then
+		redis.call("HSET", KEYS[6], ARGV[1], price)
+	end
+end
+
+redis.call("HSET", KEYS[4], ARGV[3], 1)
+redis.call("HSET", KEYS[4], ARGV[1], newCount)
+redis.call("HDEL", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+
+for i = 1, 6 do
+	redis.call("EXPIRE", KEYS[i], ARGV[2])
+end
+
+return newCount
+`)
+
+// cartMarkerField is always present in an existing cart hash, because redis
+// deletes empty hashes and we still need to tell an empty cart from a missing one.
+const cartMarkerField = "-"
+
+func NewRedisCartStorage(client *redis.Client, ttl time.Duration) *RedisCartStorage {
+	return &RedisCartStorage{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// AddItem adds count of the product to the cart and returns the new count, nothing changes if the count doesn't fit into uint16.
+func (store *RedisCartStorage) AddItem(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) (uint16, error) {
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+	field := strconv.FormatInt(productId, 10)
+
+	result, err := addItemScript.Run(ctx, store.client, []string{countsKey, namesKey, pricesKey},
+		field, count, productName, price, int64(store.ttl.Seconds()), cartMarkerField,
+	).Int64()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if result == -3 {
+		return 0, ErrItemCountOverflow
+	}
+
+	return uint16(result), nil
+}
+
+func (store *RedisCartStorage) RemoveItem(ctx context.Context, owner models.CartOwner, productId int64) error {
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+	field := strconv.FormatInt(productId, 10)
+
+	exists, err := store.client.Exists(ctx, countsKey).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return ErrUserNotFound
+	}
+
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, countsKey, field)
+		pipe.HDel(ctx, namesKey, field)
+		pipe.HDel(ctx, pricesKey, field)
+		pipe.Expire(ctx, countsKey, store.ttl)
+		pipe.Expire(ctx, namesKey, store.ttl)
+		pipe.Expire(ctx, pricesKey, store.ttl)
+		return nil
+	})
+
+	return err
+}
+
+// SetItemCount sets the count of the product in the cart, 0 removes the product.
+func (store *RedisCartStorage) SetItemCount(ctx context.Context, owner models.CartOwner, productId int64, productName string, price uint32, count uint16) error {
+	if count == 0 {
+		return store.RemoveItem(ctx, owner, productId)
+	}
+
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+	field := strconv.FormatInt(productId, 10)
+
+	_, err := store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, countsKey, cartMarkerField, 1)
+		pipe.HSet(ctx, countsKey, field, count)
+		pipe.HSetNX(ctx, namesKey, field, productName)
+		pipe.HSet(ctx, pricesKey, field, price)
+		pipe.Expire(ctx, countsKey, store.ttl)
+		pipe.Expire(ctx, namesKey, store.ttl)
+		pipe.Expire(ctx, pricesKey, store.ttl)
+		return nil
+	})
+
+	return err
+}
+
+// SetItemPrices replaces the prices the user saw for the products of the cart, products missing in the cart are skipped.
+func (store *RedisCartStorage) SetItemPrices(ctx context.Context, owner models.CartOwner, prices map[int64]uint32) error {
+	countsKey, _, pricesKey := cartKeys(owner)
+	args := make([]any, 0, 1+2*len(prices))
+	args = append(args, int64(store.ttl.Seconds()))
+
+	for productId, price := range prices {
+		args = append(args, strconv.FormatInt(productId, 10), price)
+	}
+
+	result, err := setItemPricesScript.Run(ctx, store.client, []string{countsKey, pricesKey}, args...).Int64()
+
+	if err != nil {
+		return err
+	}
+
+	if result == -1 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ChangeItemCount adds the signed delta to the count of the product in the cart and returns the new count.
+// The product is removed when the count drops to 0 or below.
+func (store *RedisCartStorage) ChangeItemCount(ctx context.Context, owner models.CartOwner, productId int64, delta int32) (uint16, error) {
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+	field := strconv.FormatInt(productId, 10)
+
+	count, err := changeItemCountScript.Run(
+		ctx,
+		store.client,
+		[]string{countsKey, namesKey, pricesKey},
+		field, delta, int64(store.ttl.Seconds()),
+	).Int64()
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch count {
+	case -1:
+		return 0, ErrUserNotFound
+	case -2:
+		return 0, ErrItemNotFound
+	case -3:
+		return 0, ErrItemCountOverflow
+	}
+
+	return uint16(count), nil
+}
+
+// SetPromoCode applies the promo code to the cart, an empty code removes the applied one.
+func (store *RedisCartStorage) SetPromoCode(ctx context.Context, owner models.CartOwner, code string) error {
+	countsKey, _, _ := cartKeys(owner)
+
+	exists, err := store.client.Exists(ctx, countsKey).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return ErrUserNotFound
+	}
+
+	if code == "" {
+		return store.client.Del(ctx, promoCodeKey(owner)).Err()
+	}
+
+	return store.client.Set(ctx, promoCodeKey(owner), code, store.ttl).Err()
+}
+
+// GetPromoCode returns the promo code applied to the cart or an empty string.
+func (store *RedisCartStorage) GetPromoCode(ctx context.Context, owner models.CartOwner) (string, error) {
+	code, err := store.client.GetEx(ctx, promoCodeKey(owner), store.ttl).Result()
+
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+
+	return code, err
+}
+
+// MergeItems moves the products of cart from into cart to, policy decides the count of a product that is in both
+// and the line of cart to is kept then. The promo code of cart from is moved if cart to has none, cart from is deleted.
+// Nothing changes if a count doesn't fit into uint16.
+func (store *RedisCartStorage) MergeItems(ctx context.Context, from models.CartOwner, to models.CartOwner, policy models.MergePolicy) error {
+	fromCounts, fromNames, fromPrices := cartKeys(from)
+	toCounts, toNames, toPrices := cartKeys(to)
+
+	result, err := mergeItemsScript.Run(
+		ctx,
+		store.client,
+		[]string{fromCounts, fromNames, fromPrices, promoCodeKey(from), toCounts, toNames, toPrices, promoCodeKey(to)},
+		string(policy), int64(store.ttl.Seconds()), cartMarkerField,
+	).Int64()
+
+	if err != nil {
+		return err
+	}
+
+	switch result {
+	case -1:
+		return ErrUserNotFound
+	case -3:
+		return ErrItemCountOverflow
+	}
+
+	return nil
+}
+
+// MoveItem moves the product from cart from into cart to and returns its count in cart to. The count is added
+// to the product if cart to has it and the line of cart to is kept then. Nothing changes if the count doesn't fit into uint16.
+func (store *RedisCartStorage) MoveItem(ctx context.Context, from models.CartOwner, to models.CartOwner, productId int64) (uint16, error) {
+	fromCounts, fromNames, fromPrices := cartKeys(from)
+	toCounts, toNames, toPrices := cartKeys(to)
+
+	result, err := moveItemScript.Run(
+		ctx,
+		store.client,
+		[]string{fromCounts, fromNames, fromPrices, toCounts, toNames, toPrices},
+		strconv.FormatInt(productId, 10), int64(store.ttl.Seconds()), cartMarkerField,
+	).Int64()
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch result {
+	case -1:
+		return 0, ErrUserNotFound
+	case -2:
+		return 0, ErrItemNotFound
+	case -3:
+		return 0, ErrItemCountOverflow
+	}
+
+	return uint16(result), nil
+}
+
+func (store *RedisCartStorage) DeleteItemsByOwner(ctx context.Context, owner models.CartOwner) error {
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+	return store.client.Del(ctx, countsKey, namesKey, pricesKey, promoCodeKey(owner)).Err()
+}
+
+func (store *RedisCartStorage) GetItemsByOwner(ctx context.Context, owner models.CartOwner) (map[models.Product]uint16, error) {
+	countsKey, namesKey, pricesKey := cartKeys(owner)
+
+	var counts, names, prices *redis.MapStringStringCmd
+
+	_, err := store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		counts = pipe.HGetAll(ctx, countsKey)
+		names = pipe.HGetAll(ctx, namesKey)
+		prices = pipe.HGetAll(ctx, pricesKey)
+		pipe.Expire(ctx, countsKey, store.ttl)
+		pipe.Expire(ctx, namesKey, store.ttl)
+		pipe.Expire(ctx, pricesKey, store.ttl)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(counts.Val()) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	products := make(map[models.Product]uint16)
+
+	for field, rawCount := range counts.Val() {
+		if field == cartMarkerField {
+			continue
+		}
+
+		productId, err := strconv.ParseInt(field, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("broken cart item %q: %w", field, err)
+		}
+
+		count, err := strconv.ParseUint(rawCount, 10, 16)
+
+		if err != nil {
+			return nil, fmt.Errorf("broken cart item %q count: %w", field, err)
+		}
+
+		// carts saved before prices were stored have no price
+		var price uint64
+
+		if rawPrice, ok := prices.Val()[field]; ok {
+			if price, err = strconv.ParseUint(rawPrice, 10, 32); err != nil {
+				return nil, fmt.Errorf("broken cart item %q price: %w", field, err)
+			}
+		}
+
+		products[models.Product{SkuId: productId, Name: names.Val()[field], Price: uint32(price)}] = uint16(count)
+	}
+
+	if len(products) == 0 {
+		return nil, ErrUserCartEmpty
+	}
+
+	return products, nil
+}
+
+func cartKeys(owner models.CartOwner) (string, string, string) {
+	key := "cart:" + owner.Key()
+	return key, key + ":names", key + ":prices"
+}
+
+func promoCodeKey(owner models.CartOwner) string {
+	return "cart:" + owner.Key() + ":promo"
+}
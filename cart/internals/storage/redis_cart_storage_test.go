@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"route256.ozon.ru/project/cart/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRedisCartStorage(t *testing.T, ttl time.Duration) (*RedisCartStorage, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return NewRedisCartStorage(client, ttl), server
+}
+
+func TestRedisCartStorage_AddItem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should be summarize with the product in the cart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 2)))
+		count, err := cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 3)
+		require.NoError(t, err)
+		require.Equal(t, uint16(5), count)
+
+		got, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 100}: 5}, got)
+	})
+
+	t.Run("should be error on uint16 overflow", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 65535)))
+		require.ErrorIs(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 120, 1)), ErrItemCountOverflow)
+
+		got, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 100}: 65535}, got)
+	})
+
+	t.Run("should not lose counts on concurrent adds from several replicas", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, server := newRedisCartStorage(t, time.Minute)
+		replica := NewRedisCartStorage(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute)
+
+		var wg sync.WaitGroup
+
+		for i := range 100 {
+			store := cartStorage
+
+			if i%2 == 0 {
+				store = replica
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				require.NoError(t, ignoreCount(store.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 1)))
+			}()
+		}
+
+		wg.Wait()
+
+		got, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.NoError(t, err)
+		require.Equal(t, map[models.Product]uint16{{SkuId: 1, Name: "Product name", Price: 100}: 100}, got)
+	})
+}
+
+func TestRedisCartStorage_RemoveItem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should be error trying to remove item without user", func(t *testing.T) {
+		t.Parallel()
+
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+
+		err := cartStorage.RemoveItem(context.Background(), models.UserCart(1), 1)
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("should be error if cart is empty after removing", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 1)))
+		require.NoError(t, cartStorage.RemoveItem(ctx, models.UserCart(1), 1))
+
+		_, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.ErrorIs(t, err, ErrUserCartEmpty)
+	})
+}
+
+func TestRedisCartStorage_SetItemCount(t *testing.T) {
+	t.Parallel()
+
+	testSetItemCount(t, func(t *testing.T) itemCountStorage {
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+		return cartStorage
+	})
+}
+
+func TestRedisCartStorage_ChangeItemCount(t *testing.T) {
+	t.Parallel()
+
+	testChangeItemCount(t, func(t *testing.T) itemCountStorage {
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+		return cartStorage
+	})
+}
+
+func TestRedisCartStorage_SetItemPrices(t *testing.T) {
+	t.Parallel()
+
+	testSetItemPrices(t, func(t *testing.T) itemCountStorage {
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+		return cartStorage
+	})
+}
+
+func TestRedisCartStorage_MergeItems(t *testing.T) {
+	t.Parallel()
+
+	testMergeItems(t, func(t *testing.T) itemCountStorage {
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+		return cartStorage
+	})
+}
+
+func TestRedisCartStorage_MoveItem(t *testing.T) {
+	t.Parallel()
+
+	testMoveItem(t, func(t *testing.T) itemCountStorage {
+		cartStorage, _ := newRedisCartStorage(t, time.Minute)
+		return cartStorage
+	})
+}
+
+func TestRedisCartStorage_DeleteItemsByOwner(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cartStorage, _ := newRedisCartStorage(t, time.Minute)
+
+	require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 1)))
+	require.NoError(t, cartStorage.DeleteItemsByOwner(ctx, models.UserCart(1)))
+
+	_, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+	require.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestRedisCartStorage_TTL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should expire abandoned cart", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, server := newRedisCartStorage(t, time.Minute)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 1)))
+		server.FastForward(time.Minute + time.Second)
+
+		_, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("should prolong ttl on every access", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		cartStorage, server := newRedisCartStorage(t, time.Minute)
+
+		require.NoError(t, ignoreCount(cartStorage.AddItem(ctx, models.UserCart(1), 1, "Product name", 100, 1)))
+		server.FastForward(50 * time.Second)
+
+		_, err := cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.NoError(t, err)
+
+		server.FastForward(50 * time.Second)
+
+		_, err = cartStorage.GetItemsByOwner(ctx, models.UserCart(1))
+		require.NoError(t, err)
+	})
+}
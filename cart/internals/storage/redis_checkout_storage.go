@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"route256.ozon.ru/project/cart/models"
+	"time"
+)
+
+// RedisCheckoutStorage shares the checkouts between the replicas. A running checkout is a key
+// of "<token>:<status>:<order id>" set only if it is missing, the order of a completed checkout is a key per idempotency key.
+// Both expire after their ttl, so a checkout of a crashed replica doesn't lock the cart forever.
+// The checkout is changed and deleted only by the token that has set it, a checkout that has outlived its ttl
+// can't touch the one that has taken the cart over since.
+type RedisCheckoutStorage struct {
+	client *redis.Client
+}
+
+// setCheckoutStatusScript sets the value of the checkout to ARGV[2] keeping its ttl if the checkout has token ARGV[1].
+var setCheckoutStatusScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+
+if not value or string.sub(value, 1, #ARGV[1] + 1) ~= ARGV[1] .. ":" then
+	return 0
+end
+
+redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+return 1
+`)
+
+// finishCheckoutScript deletes the checkout if it has token ARGV[1].
+var finishCheckoutScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+
+if not value or string.sub(value, 1, #ARGV[1] + 1) ~= ARGV[1] .. ":" then
+	return 0
+end
+
+return redis.call("DEL", KEYS[1])
+`)
+
+func NewRedisCheckoutStorage(client *redis.Client) *RedisCheckoutStorage {
+	return &RedisCheckoutStorage{client: client}
+}
+
+func (store *RedisCheckoutStorage) StartCheckout(ctx context.Context, userId int64, ttl time.Duration) (string, bool, error) {
+	token, err := newCheckoutToken()
+
+	if err != nil {
+		return "", false, err
+	}
+
+	started, err := store.client.SetNX(ctx, checkoutKey(userId), checkoutValue(token, models.CheckoutStarted, 0), ttl).Result()
+
+	if err != nil || !started {
+		return "", false, err
+	}
+
+	return token, true, nil
+}
+
+func (store *RedisCheckoutStorage) SetCheckoutStatus(ctx context.Context, userId int64, token string, status models.CheckoutStatus, orderId int64) error {
+	keys := []string{checkoutKey(userId)}
+
+	return setCheckoutStatusScript.Run(ctx, store.client, keys, token, checkoutValue(token, status, orderId)).Err()
+}
+
+func (store *RedisCheckoutStorage) FinishCheckout(ctx context.Context, userId int64, token string) error {
+	return finishCheckoutScript.Run(ctx, store.client, []string{checkoutKey(userId)}, token).Err()
+}
+
+func (store *RedisCheckoutStorage) GetCheckoutOrder(ctx context.Context, userId int64, key string) (int64, bool, error) {
+	orderId, err := store.client.Get(ctx, checkoutOrderKey(userId, key)).Int64()
+
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return orderId, true, nil
+}
+
+func (store *RedisCheckoutStorage) SaveCheckoutOrder(ctx context.Context, userId int64, key string, orderId int64, ttl time.Duration) error {
+	return store.client.Set(ctx, checkoutOrderKey(userId, key), orderId, ttl).Err()
+}
+
+func checkoutKey(userId int64) string {
+	return fmt.Sprintf("checkout:%d", userId)
+}
+
+func checkoutOrderKey(userId int64, key string) string {
+	return fmt.Sprintf("checkout:%d:order:%s", userId, key)
+}
+
+func checkoutValue(token string, status models.CheckoutStatus, orderId int64) string {
+	return fmt.Sprintf("%s:%d:%d", token, status, orderId)
+}
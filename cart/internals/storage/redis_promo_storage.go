@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"route256.ozon.ru/project/cart/models"
+	"slices"
+)
+
+// RedisPromoStorage keeps all the promo codes in one hash of code -> json of the promo without expiration.
+type RedisPromoStorage struct {
+	client *redis.Client
+}
+
+// updatePromoScript sets field ARGV[1] to ARGV[2] only if the field exists, it returns 0 for a missing field and 1 otherwise.
+var updatePromoScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+
+return 1
+`)
+
+const promosKey = "promos"
+
+func NewRedisPromoStorage(client *redis.Client) *RedisPromoStorage {
+	return &RedisPromoStorage{client: client}
+}
+
+func (store *RedisPromoStorage) CreatePromo(ctx context.Context, promo models.Promo) error {
+	data, err := json.Marshal(promo)
+
+	if err != nil {
+		return err
+	}
+
+	created, err := store.client.HSetNX(ctx, promosKey, promo.Code, data).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		return ErrPromoExists
+	}
+
+	return nil
+}
+
+func (store *RedisPromoStorage) UpdatePromo(ctx context.Context, promo models.Promo) error {
+	data, err := json.Marshal(promo)
+
+	if err != nil {
+		return err
+	}
+
+	updated, err := updatePromoScript.Run(ctx, store.client, []string{promosKey}, promo.Code, data).Int64()
+
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrPromoNotFound
+	}
+
+	return nil
+}
+
+func (store *RedisPromoStorage) DeletePromo(ctx context.Context, code string) error {
+	deleted, err := store.client.HDel(ctx, promosKey, code).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrPromoNotFound
+	}
+
+	return nil
+}
+
+func (store *RedisPromoStorage) GetPromo(ctx context.Context, code string) (models.Promo, error) {
+	data, err := store.client.HGet(ctx, promosKey, code).Bytes()
+
+	if errors.Is(err, redis.Nil) {
+		return models.Promo{}, ErrPromoNotFound
+	}
+
+	if err != nil {
+		return models.Promo{}, err
+	}
+
+	var promo models.Promo
+
+	if err = json.Unmarshal(data, &promo); err != nil {
+		return models.Promo{}, fmt.Errorf("broken promo code %q: %w", code, err)
+	}
+
+	return promo, nil
+}
+
+// ListPromos returns all the promo codes sorted by code.
+func (store *RedisPromoStorage) ListPromos(ctx context.Context) ([]models.Promo, error) {
+	values, err := store.client.HGetAll(ctx, promosKey).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	promos := make([]models.Promo, 0, len(values))
+
+	for code, data := range values {
+		var promo models.Promo
+
+		if err = json.Unmarshal([]byte(data), &promo); err != nil {
+			return nil, fmt.Errorf("broken promo code %q: %w", code, err)
+		}
+
+		promos = append(promos, promo)
+	}
+
+	slices.SortFunc(promos, func(a, b models.Promo) int {
+		return cmp.Compare(a.Code, b.Code)
+	})
+
+	return promos, nil
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"net/http"
+	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/internals/service"
+	"route256.ozon.ru/project/cart/internals/storage"
+)
+
+// errorResponse is the body of every error of the cart API.
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+}
+
+type outOfStockDetails struct {
+	Unavailable any `json:"unavailable"`
+}
+
+type priceChangedDetails struct {
+	Changed any `json:"changed"`
+}
+
+type promoNotApplicableDetails struct {
+	Reason string `json:"reason"`
+}
+
+type validationDetails struct {
+	Fields []fieldError `json:"fields"`
+}
+
+const (
+	codeBadRequest      = "bad_request"
+	codeBodyTooLarge    = "body_too_large"
+	codeTooManyRequests = "too_many_requests"
+	codeUnauthorized    = "unauthorized"
+	codeForbidden       = "forbidden"
+	codeInternal        = "internal"
+)
+
+// errorMappings are checked in order, so a wrapping error goes before the errors it may wrap.
+var errorMappings = []struct {
+	target error
+	status int
+	code   string
+}{
+	{storage.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{service.ErrGuestCartNotFound, http.StatusNotFound, "guest_cart_not_found"},
+	{storage.ErrUserCartEmpty, http.StatusNotFound, "cart_empty"},
+	{storage.ErrItemNotFound, http.StatusNotFound, "item_not_found"},
+	{storage.ErrItemCountOverflow, http.StatusBadRequest, "item_count_overflow"},
+	{clients.ErrProductNotFound, http.StatusNotFound, "product_not_found"},
+	{service.ErrProductOutOfStock, http.StatusPreconditionFailed, "out_of_stock"},
+	{service.ErrPriceChanged, http.StatusConflict, "price_changed"},
+	{storage.ErrPromoNotFound, http.StatusNotFound, "promo_not_found"},
+	{storage.ErrPromoExists, http.StatusConflict, "promo_exists"},
+	{service.ErrPromoNotApplicable, http.StatusUnprocessableEntity, "promo_not_applicable"},
+	{service.ErrCheckoutInProgress, http.StatusConflict, "checkout_in_progress"},
+	{service.ErrPricesStale, http.StatusServiceUnavailable, "prices_stale"},
+	{clients.ErrDependencyUnavailable, http.StatusServiceUnavailable, "dependency_unavailable"},
+	{service.ErrOrderNotCreated, http.StatusBadGateway, "order_not_created"},
+	{service.ErrCheckoutRolledBack, http.StatusServiceUnavailable, "checkout_rolled_back"},
+	{service.ErrCheckoutIncomplete, http.StatusInternalServerError, "checkout_incomplete"},
+}
+
+// grpcMappings map the status codes of LOMS errors that aren't covered by errorMappings.
+var grpcMappings = map[codes.Code]struct {
+	status int
+	code   string
+}{
+	codes.InvalidArgument:    {http.StatusBadRequest, "invalid_argument"},
+	codes.NotFound:           {http.StatusNotFound, "not_found"},
+	codes.FailedPrecondition: {http.StatusPreconditionFailed, "failed_precondition"},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, codeTooManyRequests},
+	codes.Unavailable:        {http.StatusServiceUnavailable, "dependency_unavailable"},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, "dependency_timeout"},
+}
+
+// mapError returns the status and the body of err. Only messages of the known errors reach the client,
+// the rest are logged and reported as internal errors.
+func mapError(err error) (int, errorResponse) {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.target) {
+			return mapping.status, errorResponse{
+				Code:    mapping.code,
+				Message: mapping.target.Error(),
+				Details: errorDetails(err),
+			}
+		}
+	}
+
+	// the status is taken from the error of LOMS itself, so the client doesn't see the wrapping context
+	var grpcErr interface{ GRPCStatus() *status.Status }
+
+	if errors.As(err, &grpcErr) {
+		grpcStatus := grpcErr.GRPCStatus()
+
+		if mapping, ok := grpcMappings[grpcStatus.Code()]; ok {
+			return mapping.status, errorResponse{
+				Code:    mapping.code,
+				Message: grpcStatus.Message(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, errorResponse{
+		Code:    codeInternal,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
+
+func errorDetails(err error) any {
+	var outOfStock *service.OutOfStockError
+	var priceChanged *service.PriceChangedError
+	var promoNotApplicable *service.PromoNotApplicableError
+
+	if errors.As(err, &outOfStock) {
+		return outOfStockDetails{outOfStock.Shortages}
+	}
+
+	if errors.As(err, &priceChanged) {
+		return priceChangedDetails{priceChanged.Changes}
+	}
+
+	if errors.As(err, &promoNotApplicable) {
+		return promoNotApplicableDetails{promoNotApplicable.Reason}
+	}
+
+	return nil
+}
+
+// writeError responds with the status and the envelope of err.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, response := mapError(err)
+
+	if statusCode == http.StatusInternalServerError {
+		log.Printf("[http] request %s: %s %s: %v", RequestIdFromContext(r.Context()), r.Method, r.URL.Path, err)
+	}
+
+	writeErrorResponse(w, r, statusCode, response)
+}
+
+// writeBadRequest responds 400 with the message of a request validation error and the wrong fields in details.
+// A body over the limit is answered with 413.
+func writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var reqErr *requestError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, errorResponse{
+			Code:    codeBodyTooLarge,
+			Message: fmt.Sprintf("body must not be larger than %d bytes", maxBytesErr.Limit),
+		})
+	case errors.As(err, &reqErr) && len(reqErr.Fields) != 0:
+		writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeBadRequest,
+			Message: reqErr.Message,
+			Details: validationDetails{reqErr.Fields},
+		})
+	default:
+		writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{
+			Code:    codeBadRequest,
+			Message: err.Error(),
+		})
+	}
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, response errorResponse) {
+	response.RequestId = RequestIdFromContext(r.Context())
+	data, err := json.Marshal(response)
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/internals/service"
+	"route256.ozon.ru/project/cart/internals/storage"
+	"route256.ozon.ru/project/cart/models"
+	"testing"
+)
+
+func TestMapError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "should map storage error",
+			err:         fmt.Errorf("get cart: %w", storage.ErrUserNotFound),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "user_not_found",
+			wantMessage: storage.ErrUserNotFound.Error(),
+		},
+		{
+			name:        "should prefer unavailable dependency to the order it failed",
+			err:         fmt.Errorf("%w: %w", service.ErrOrderNotCreated, clients.ErrDependencyUnavailable),
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCode:    "dependency_unavailable",
+			wantMessage: clients.ErrDependencyUnavailable.Error(),
+		},
+		{
+			name:        "should map order not created",
+			err:         fmt.Errorf("%w: %w", service.ErrOrderNotCreated, errors.New("connection reset")),
+			wantStatus:  http.StatusBadGateway,
+			wantCode:    "order_not_created",
+			wantMessage: service.ErrOrderNotCreated.Error(),
+		},
+		{
+			name:        "should map promo code that gives no discount",
+			err:         &service.PromoNotApplicableError{Reason: "the cart gets no discount"},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "promo_not_applicable",
+			wantMessage: service.ErrPromoNotApplicable.Error(),
+		},
+		{
+			name:        "should map stale prices",
+			err:         fmt.Errorf("%w: skus [1]", service.ErrPricesStale),
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCode:    "prices_stale",
+			wantMessage: service.ErrPricesStale.Error(),
+		},
+		{
+			name:        "should map grpc status of LOMS",
+			err:         fmt.Errorf("stocks: %w", status.Error(codes.NotFound, "sku is unknown")),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "not_found",
+			wantMessage: "sku is unknown",
+		},
+		{
+			name:        "should hide unknown errors",
+			err:         errors.New("pq: password authentication failed"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    codeInternal,
+			wantMessage: http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:        "should hide unmapped grpc status",
+			err:         status.Error(codes.Internal, "sql: connection refused"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    codeInternal,
+			wantMessage: http.StatusText(http.StatusInternalServerError),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotStatus, gotResponse := mapError(test.err)
+
+			require.Equal(t, test.wantStatus, gotStatus)
+			require.Equal(t, test.wantCode, gotResponse.Code)
+			require.Equal(t, test.wantMessage, gotResponse.Message)
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	shortages := []models.StockShortage{{SkuId: 1, Requested: 2, Available: 1}}
+	handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, &service.OutOfStockError{Shortages: shortages})
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/cart/checkout", nil)
+	request.Header.Set(RequestIdHeader, "request-1")
+	recorder := httptest.NewRecorder()
+
+	handler.ServeHTTP(recorder, request)
+
+	var body struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Details struct {
+			Unavailable []models.StockShortage `json:"unavailable"`
+		} `json:"details"`
+		RequestId string `json:"request_id"`
+	}
+
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "request-1", recorder.Header().Get(RequestIdHeader))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "out_of_stock", body.Code)
+	require.Equal(t, shortages, body.Details.Unavailable)
+	require.Equal(t, "request-1", body.RequestId)
+}
+
+func TestRequestIdMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		requestId string
+		wantKept  bool
+	}{
+		{"should keep the id of the client", "abc-123", true},
+		{"should generate id if there is none", "", false},
+		{"should replace id with control characters", "abc\n123", false},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotRequestId string
+
+			handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRequestId = RequestIdFromContext(r.Context())
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/user/1/cart", nil)
+			request.Header.Set(RequestIdHeader, test.requestId)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			require.NotEmpty(t, gotRequestId)
+			require.Equal(t, gotRequestId, recorder.Header().Get(RequestIdHeader))
+			require.Equal(t, test.wantKept, gotRequestId == test.requestId)
+		})
+	}
+}
@@ -2,168 +2,333 @@ package transport
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
 	"net/http"
-	"route256.ozon.ru/project/cart/internals/clients"
+	"route256.ozon.ru/project/cart/config"
 	"route256.ozon.ru/project/cart/internals/service"
-	"route256.ozon.ru/project/cart/internals/storage"
 	"route256.ozon.ru/project/cart/models"
 )
 
+// Numbers of the requests are decoded into *int64, so missing and out of range values are told apart
+// from zero and reported with the field instead of a decoding error.
+
 type addProductPostRequest struct {
-	Count uint16 `valid:"type(uint16)"`
+	Count *int64 `json:"count"`
+}
+
+type setItemCountPutRequest struct {
+	Count *int64 `json:"count"`
+}
+
+type changeItemCountPatchRequest struct {
+	Delta *int64 `json:"delta"`
+}
+
+type itemCountResponse struct {
+	SkuId int64  `json:"sku_id"`
+	Count uint16 `json:"count"`
 }
 
 type checkoutPostRequest struct {
-	User int64 `json:"user" valid:"type(int64)"`
+	User *int64 `json:"user"`
 }
 
 type checkoutResponse struct {
 	OrderId int64 `json:"orderID"`
 }
 
+type cartValidationResponse struct {
+	Valid     bool                   `json:"valid"`
+	Shortages []models.StockShortage `json:"shortages"`
+}
+
+// mergeCartResponse is the merged cart with the lines exceeding LOMS stocks.
+type mergeCartResponse struct {
+	cartResponse
+	Shortages []models.StockShortage `json:"shortages"`
+}
+
+type mergeCartPostRequest struct {
+	Session *string `json:"session"`
+	Policy  *string `json:"policy"`
+}
+
+type applyPromoPostRequest struct {
+	Code *string `json:"code"`
+}
+
+// cartResponse itemizes the cart, TotalPrice is Subtotal less Discounts.
 type cartResponse struct {
-	TotalPrice uint32           `json:"total_price"`
-	Items      []models.Product `json:"items"`
+	TotalPrice uint32            `json:"total_price"`
+	Items      []models.Product  `json:"items"`
+	Subtotal   uint32            `json:"subtotal"`
+	Discounts  []models.Discount `json:"discounts"`
+	PromoCode  string            `json:"promo_code,omitempty"`
 }
 
-func NewHandler(cartService *service.CartService) http.Handler {
+func newCartResponse(cart models.Cart) cartResponse {
+	return cartResponse{
+		TotalPrice: cart.Total,
+		Items:      cart.Items,
+		Subtotal:   cart.Subtotal,
+		Discounts:  cart.Discounts,
+		PromoCode:  cart.PromoCode,
+	}
+}
+
+// NewHandler returns the cart API. The promo codes API is for admins only, its requests must carry adminToken.
+func NewHandler(cartService *service.CartService, promoService *service.PromoService, rateLimits map[string]config.RateLimitConfig, adminToken string) http.Handler {
 	router := http.NewServeMux()
 
-	router.Handle("POST /user/{user_id}/cart/{sku_id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		saveProductHandler(w, r, cartService)
-	}))
+	limit := func(route string, userKey func(r *http.Request) string, handler http.HandlerFunc) http.Handler {
+		return RateLimitMiddleware(rateLimits[route], userKey)(handler)
+	}
 
-	router.Handle("DELETE /user/{user_id}/cart/{sku_id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		deleteProductHandler(w, r, cartService)
-	}))
+	// a guest cart has the same API as a user cart until the guest logs in and the cart is merged
+	for _, prefix := range []string{"/user/{user_id}", "/guest/{session}"} {
+		router.Handle("POST "+prefix+"/cart/{sku_id}", limit(config.RouteAddItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			saveProductHandler(w, r, cartService)
+		}))
 
-	router.Handle("DELETE /user/{user_id}/cart", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		deleteCartHandler(w, r, cartService)
-	}))
+		router.Handle("PUT "+prefix+"/cart/{sku_id}", limit(config.RouteSetItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			setItemCountHandler(w, r, cartService)
+		}))
+
+		router.Handle("PATCH "+prefix+"/cart/{sku_id}", limit(config.RouteChangeItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			changeItemCountHandler(w, r, cartService)
+		}))
+
+		router.Handle("DELETE "+prefix+"/cart/{sku_id}", limit(config.RouteDeleteItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			deleteProductHandler(w, r, cartService)
+		}))
+
+		router.Handle("DELETE "+prefix+"/cart", limit(config.RouteDeleteCart, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			deleteCartHandler(w, r, cartService)
+		}))
+
+		router.Handle("GET "+prefix+"/cart", limit(config.RouteGetCart, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			getCartHandler(w, r, cartService)
+		}))
+
+		router.Handle("GET "+prefix+"/cart/validate", limit(config.RouteValidateCart, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			validateCartHandler(w, r, cartService)
+		}))
+
+		router.Handle("POST "+prefix+"/cart/promo", limit(config.RouteApplyPromo, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			applyPromoHandler(w, r, cartService)
+		}))
+
+		router.Handle("DELETE "+prefix+"/cart/promo", limit(config.RouteRemovePromo, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			removePromoHandler(w, r, cartService)
+		}))
+
+		router.Handle("GET "+prefix+"/lists/{list}", limit(config.RouteGetList, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			getListHandler(w, r, cartService)
+		}))
 
-	router.Handle("GET /user/{user_id}/cart", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		getCartHandler(w, r, cartService)
+		router.Handle("POST "+prefix+"/lists/{list}/{sku_id}", limit(config.RouteMoveItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			moveToListHandler(w, r, cartService)
+		}))
+
+		router.Handle("POST "+prefix+"/lists/{list}/{sku_id}/cart", limit(config.RouteMoveItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			moveToCartHandler(w, r, cartService)
+		}))
+
+		router.Handle("DELETE "+prefix+"/lists/{list}/{sku_id}", limit(config.RouteDeleteListItem, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+			deleteListItemHandler(w, r, cartService)
+		}))
+	}
+
+	router.Handle("POST /user/{user_id}/cart/merge", limit(config.RouteMergeCart, pathOwnerKey, func(w http.ResponseWriter, r *http.Request) {
+		mergeCartHandler(w, r, cartService)
 	}))
 
-	router.Handle("POST /cart/checkout", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	router.Handle("POST /cart/checkout", limit(config.RouteCheckout, checkoutUserKey, func(w http.ResponseWriter, r *http.Request) {
 		checkoutHandler(w, r, cartService)
 	}))
 
+	// the promo codes API shares one global limit, the limit goes after auth so anonymous calls don't spend it
+	rateLimitPromos := RateLimitMiddleware(rateLimits[config.RoutePromos], noUserKey)
+	adminAuth := AdminAuthMiddleware(adminToken)
+
+	limitPromos := func(handler http.Handler) http.Handler {
+		return adminAuth(rateLimitPromos(handler))
+	}
+
+	router.Handle("POST /promos", limitPromos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		createPromoHandler(w, r, promoService)
+	})))
+
+	router.Handle("GET /promos", limitPromos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listPromosHandler(w, r, promoService)
+	})))
+
+	router.Handle("GET /promos/{code}", limitPromos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		getPromoHandler(w, r, promoService)
+	})))
+
+	router.Handle("PUT /promos/{code}", limitPromos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		updatePromoHandler(w, r, promoService)
+	})))
+
+	router.Handle("DELETE /promos/{code}", limitPromos(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deletePromoHandler(w, r, promoService)
+	})))
+
+	router.Handle("GET /metrics", promhttp.Handler())
+
 	return applyMiddlewares(router)
 }
 
 func applyMiddlewares(router *http.ServeMux) http.Handler {
-	return LoggingMiddleware(router)
+	return RequestIdMiddleware(LoggingMiddleware(router))
 }
 
+// IdempotencyKeyHeader lets clients retry checkout without producing a second order.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 func checkoutHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
-	postRequest, err := validateCheckoutPostRequest(r)
+	userId, err := validateCheckoutPostRequest(w, r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	_, productList, err := cartService.GetCart(r.Context(), postRequest.User)
+	idempotencyKey, err := validateIdempotencyKey(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	orderId, err := cartService.LomsProvider.CreateOrder(r.Context(), postRequest.User, productList)
+	orderId, err := cartService.Checkout(r.Context(), userId, idempotencyKey)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	err = cartService.DeleteCart(r.Context(), postRequest.User)
+	writeJsonResponse(w, r, http.StatusOK, checkoutResponse{orderId})
+}
+
+func saveProductHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
 
 	if err != nil {
-		http.Error(w, "Failed to delete cart: "+err.Error(), http.StatusInternalServerError)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	data, err := json.Marshal(checkoutResponse{orderId})
+	skuId, err := validateSkuId(r)
 
 	if err != nil {
-		http.Error(w, "Failed to encode json response: "+err.Error(), http.StatusInternalServerError)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	count, err := validateAddProductPostRequest(w, r)
 
-	if _, err := w.Write(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
 	}
+
+	err = cartService.SaveProductItem(r.Context(), owner, skuId, count)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func saveProductHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
-	userId, err := validateUserId(r)
+func setItemCountHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
 	skuId, err := validateSkuId(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	postRequest, err := validateAddProductPostRequest(r)
+	count, err := validateSetItemCountPutRequest(w, r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	if postRequest.Count == 0 {
-		http.Error(w, "product count must not be 0", http.StatusBadRequest)
+	err = cartService.SetItemCount(r.Context(), owner, skuId, count)
+
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	err = cartService.SaveProductItem(r.Context(), userId, skuId, postRequest.Count)
+	w.WriteHeader(http.StatusOK)
+}
+
+func changeItemCountHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, clients.ErrProductNotFound):
-			http.Error(w, err.Error(), http.StatusNotFound)
-		case errors.Is(err, service.ErrProductOutOfStock):
-			http.Error(w, err.Error(), http.StatusPreconditionFailed)
-		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	skuId, err := validateSkuId(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	delta, err := validateChangeItemCountPatchRequest(w, r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	count, err := cartService.ChangeItemCount(r.Context(), owner, skuId, delta)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, itemCountResponse{skuId, count})
 }
 
 func deleteProductHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
-	userId, err := validateUserId(r)
+	owner, err := validateCartOwner(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
 	skuId, err := validateSkuId(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	err = cartService.DeleteProductItem(r.Context(), userId, skuId)
+	err = cartService.DeleteProductItem(r.Context(), owner, skuId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -171,17 +336,17 @@ func deleteProductHandler(w http.ResponseWriter, r *http.Request, cartService *s
 }
 
 func deleteCartHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
-	userId, err := validateUserId(r)
+	owner, err := validateCartOwner(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	err = cartService.DeleteCart(r.Context(), userId)
+	err = cartService.DeleteCart(r.Context(), owner)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -189,39 +354,78 @@ func deleteCartHandler(w http.ResponseWriter, r *http.Request, cartService *serv
 }
 
 func getCartHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	cart, err := cartService.GetCart(r.Context(), owner)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, newCartResponse(cart))
+}
+
+func mergeCartHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
 	userId, err := validateUserId(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	total, productList, err := cartService.GetCart(r.Context(), userId)
+	session, policy, err := validateMergeCartPostRequest(w, r)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, storage.ErrUserNotFound):
-			http.Error(w, err.Error(), http.StatusNotFound)
-		case errors.Is(err, storage.ErrUserCartEmpty):
-			http.Error(w, err.Error(), http.StatusNotFound)
-		default:
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeBadRequest(w, r, err)
 		return
 	}
 
-	response := cartResponse{total, productList}
+	cart, shortages, err := cartService.MergeCart(r.Context(), userId, session, policy)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, mergeCartResponse{newCartResponse(cart), shortages})
+}
+
+func validateCartHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	shortages, err := cartService.ValidateCart(r.Context(), owner)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, cartValidationResponse{len(shortages) == 0, shortages})
+}
+
+func writeJsonResponse(w http.ResponseWriter, r *http.Request, statusCode int, response any) {
 	data, err := json.Marshal(response)
 
 	if err != nil {
-		http.Error(w, "Failed to encode json response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("encode json response: %w", err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 
 	if _, err := w.Write(data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Printf("[http] request %s: write response: %v", RequestIdFromContext(r.Context()), err)
 	}
 }
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"route256.ozon.ru/project/cart/config"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutHandler_IdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler(nil, nil, map[string]config.RateLimitConfig{}, "secret")
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"should reject too long key", strings.Repeat("k", maxIdempotencyKeyLength+1)},
+		{"should reject non-printable key", "checkout\x01key"},
+		{"should reject key with spaces", "checkout key"},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, "/cart/checkout", strings.NewReader(`{"user":1}`))
+			request.Header.Set(IdempotencyKeyHeader, test.key)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+			var response struct {
+				Code    string            `json:"code"`
+				Details validationDetails `json:"details"`
+			}
+
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			require.Equal(t, codeBadRequest, response.Code)
+			require.Equal(t, []fieldError{{IdempotencyKeyHeader, "must be up to 128 printable ascii characters without spaces"}}, response.Details.Fields)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"net/http"
+	"route256.ozon.ru/project/cart/internals/service"
+	"route256.ozon.ru/project/cart/models"
+)
+
+type listResponse struct {
+	Items []models.Product `json:"items"`
+}
+
+func getListHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	list, err := validateListName(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	items, err := cartService.GetList(r.Context(), owner, list)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, listResponse{items})
+}
+
+func moveToListHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, list, skuId, err := validateListItem(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = cartService.MoveToList(r.Context(), owner, list, skuId); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func moveToCartHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, list, skuId, err := validateListItem(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = cartService.MoveToCart(r.Context(), owner, list, skuId); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func deleteListItemHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, list, skuId, err := validateListItem(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = cartService.DeleteListItem(r.Context(), owner, list, skuId); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateListItem returns the owner, the list and the product of the path.
+func validateListItem(r *http.Request) (models.CartOwner, models.ListName, int64, error) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		return models.CartOwner{}, "", 0, err
+	}
+
+	list, err := validateListName(r)
+
+	if err != nil {
+		return models.CartOwner{}, "", 0, err
+	}
+
+	skuId, err := validateSkuId(r)
+
+	if err != nil {
+		return models.CartOwner{}, "", 0, err
+	}
+
+	return owner, list, skuId, nil
+}
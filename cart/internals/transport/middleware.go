@@ -1,13 +1,187 @@
 package transport
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"route256.ozon.ru/project/cart/config"
+	"route256.ozon.ru/project/cart/internals/infra/limiter"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// RequestIdHeader carries the id of the request, a valid id of the client is kept, otherwise a new one is generated.
+const RequestIdHeader = "X-Request-Id"
+
+const maxRequestIdLength = 128
+
+type requestIdKey struct{}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Method: %s Path: %s", r.Method, r.URL)
+		log.Printf("Method: %s Path: %s Request: %s", r.Method, r.URL, RequestIdFromContext(r.Context()))
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequestIdMiddleware puts the id of the request into the context and the response headers.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIdHeader)
+
+		if !validRequestId(requestId) {
+			requestId = newRequestId()
+		}
+
+		w.Header().Set(RequestIdHeader, requestId)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, requestId)))
+	})
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+
+	return requestId
+}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+
+	for _, c := range requestId {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RateLimitMiddleware rejects requests over the per-user or the global limit with 429 and Retry-After.
+// userKey returns the user of the request, requests without a user are limited only globally.
+func RateLimitMiddleware(conf config.RateLimitConfig, userKey func(r *http.Request) string) func(http.Handler) http.Handler {
+	var users *limiter.Keyed
+	var global *limiter.Limiter
+
+	if conf.UserRps > 0 {
+		users = limiter.NewKeyed(float64(conf.UserRps), max(conf.UserBurst, 1))
+	}
+
+	if conf.GlobalRps > 0 {
+		global = limiter.NewLimiter(float64(conf.GlobalRps), max(conf.GlobalBurst, 1))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the user limit goes first, so a user over the limit doesn't spend tokens of the others
+			if key := userKey(r); users != nil && key != "" {
+				if ok, retryAfter := users.Allow(key); !ok {
+					tooManyRequests(w, r, retryAfter)
+					return
+				}
+			}
+
+			if global != nil {
+				if ok, retryAfter := global.AllowOrDelay(); !ok {
+					tooManyRequests(w, r, retryAfter)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := max(int64(math.Ceil(retryAfter.Seconds())), 1)
+
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	writeErrorResponse(w, r, http.StatusTooManyRequests, errorResponse{
+		Code:    codeTooManyRequests,
+		Message: "too many requests",
+	})
+}
+
+// AdminAuthMiddleware lets through only requests with "Authorization: Bearer <token>".
+// Requests without credentials get 401, requests with a wrong token get 403. An empty token rejects every request.
+func AdminAuthMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+
+			if header == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeErrorResponse(w, r, http.StatusUnauthorized, errorResponse{
+					Code:    codeUnauthorized,
+					Message: "admin token is required",
+				})
+				return
+			}
+
+			given, ok := strings.CutPrefix(header, "Bearer ")
+
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				writeErrorResponse(w, r, http.StatusForbidden, errorResponse{
+					Code:    codeForbidden,
+					Message: "admin token is not valid",
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// pathOwnerKey returns the owner of the cart in the path, guests are limited by their session.
+func pathOwnerKey(r *http.Request) string {
+	if session := r.PathValue("session"); session != "" {
+		return "guest:" + session
+	}
+
+	return r.PathValue("user_id")
+}
+
+// noUserKey is for requests that aren't made on behalf of a user, they are limited only globally.
+func noUserKey(r *http.Request) string {
+	return ""
+}
+
+// checkoutUserKey takes the user from the checkout body and puts the body back for the handler.
+func checkoutUserKey(r *http.Request) string {
+	// a body over the limit is read only in part, the handler rejects it anyway
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	if err != nil {
+		return ""
+	}
+
+	var request checkoutPostRequest
+
+	if err = json.Unmarshal(body, &request); err != nil || request.User == nil || *request.User <= 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(*request.User, 10)
+}
@@ -0,0 +1,226 @@
+package transport
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"route256.ozon.ru/project/cart/config"
+	"strings"
+	"testing"
+)
+
+func TestPromosAdminAuth(t *testing.T) {
+	t.Parallel()
+
+	handler := NewHandler(nil, nil, map[string]config.RateLimitConfig{}, "secret")
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{"should reject anonymous create", http.MethodPost, "/promos", "", http.StatusUnauthorized},
+		{"should reject anonymous list", http.MethodGet, "/promos", "", http.StatusUnauthorized},
+		{"should reject anonymous update", http.MethodPut, "/promos/SALE10", "", http.StatusUnauthorized},
+		{"should reject anonymous delete", http.MethodDelete, "/promos/SALE10", "", http.StatusUnauthorized},
+		{"should reject a wrong token", http.MethodPost, "/promos", "Bearer guess", http.StatusForbidden},
+		{"should reject other schemes", http.MethodPost, "/promos", "Basic c2VjcmV0", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(`{"code":"FREE","type":"percent_off","percent":100}`))
+
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, test.wantStatus, recorder.Code)
+		})
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+	}{
+		{"should let the admin through", "secret", "Bearer secret", http.StatusNoContent},
+		{"should reject every request without a configured token", "", "Bearer ", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := AdminAuthMiddleware(test.token)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/promos", nil)
+			request.Header.Set("Authorization", test.authorization)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, test.wantStatus, recorder.Code)
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	userKey := func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}
+
+	tests := []struct {
+		name       string
+		conf       config.RateLimitConfig
+		userKey    func(r *http.Request) string
+		users      []string
+		wantStatus []int
+	}{
+		{
+			name:       "should reject the user over the limit",
+			conf:       config.RateLimitConfig{UserRps: 1, UserBurst: 1},
+			userKey:    userKey,
+			users:      []string{"1", "1"},
+			wantStatus: []int{http.StatusNoContent, http.StatusTooManyRequests},
+		},
+		{
+			name:       "should limit every user on its own",
+			conf:       config.RateLimitConfig{UserRps: 1, UserBurst: 1},
+			userKey:    userKey,
+			users:      []string{"1", "2", "1"},
+			wantStatus: []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests},
+		},
+		{
+			name:       "should reject all users over the global limit",
+			conf:       config.RateLimitConfig{UserRps: 10, UserBurst: 10, GlobalRps: 1, GlobalBurst: 2},
+			userKey:    userKey,
+			users:      []string{"1", "2", "3"},
+			wantStatus: []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests},
+		},
+		{
+			name:       "should limit requests without a user only globally",
+			conf:       config.RateLimitConfig{UserRps: 1, UserBurst: 1, GlobalRps: 1, GlobalBurst: 2},
+			userKey:    noUserKey,
+			users:      []string{"1", "1", "1"},
+			wantStatus: []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests},
+		},
+		{
+			name:       "should not limit without rps",
+			conf:       config.RateLimitConfig{},
+			userKey:    userKey,
+			users:      []string{"1", "1", "1"},
+			wantStatus: []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := RateLimitMiddleware(test.conf, test.userKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			for i, user := range test.users {
+				request := httptest.NewRequest(http.MethodGet, "/user/1/cart", nil)
+				request.Header.Set("X-User", user)
+				recorder := httptest.NewRecorder()
+
+				handler.ServeHTTP(recorder, request)
+
+				require.Equal(t, test.wantStatus[i], recorder.Code, "request %d", i)
+
+				if recorder.Code != http.StatusTooManyRequests {
+					require.Empty(t, recorder.Header().Get("Retry-After"))
+					continue
+				}
+
+				var response errorResponse
+
+				require.Equal(t, "1", recorder.Header().Get("Retry-After"))
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.Equal(t, codeTooManyRequests, response.Code)
+			}
+		})
+	}
+}
+
+func TestCheckoutUserKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		wantKey string
+	}{
+		{"should take the user from the body", `{"user":42}`, "42"},
+		{"should be empty without user", `{}`, ""},
+		{"should be empty for not positive user", `{"user":0}`, ""},
+		{"should be empty for invalid body", `{"user":`, ""},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, "/cart/checkout", strings.NewReader(test.body))
+
+			require.Equal(t, test.wantKey, checkoutUserKey(request))
+
+			body, err := io.ReadAll(request.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.body, string(body))
+		})
+	}
+
+	t.Run("should limit checkouts by the user of the body", func(t *testing.T) {
+		t.Parallel()
+
+		handler := RateLimitMiddleware(config.RateLimitConfig{UserRps: 1, UserBurst: 1}, checkoutUserKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		for i, test := range []struct {
+			body       string
+			wantStatus int
+		}{
+			{`{"user":1}`, http.StatusNoContent},
+			{`{"user":2}`, http.StatusNoContent},
+			{`{"user":1}`, http.StatusTooManyRequests},
+		} {
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/cart/checkout", strings.NewReader(test.body)))
+
+			require.Equal(t, test.wantStatus, recorder.Code, "request %d", i)
+		}
+	})
+}
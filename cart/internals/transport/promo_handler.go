@@ -0,0 +1,152 @@
+package transport
+
+import (
+	"net/http"
+	"route256.ozon.ru/project/cart/internals/service"
+	"route256.ozon.ru/project/cart/models"
+)
+
+// promoRequest is the rule of a promo code, only the numbers of its type may be set.
+type promoRequest struct {
+	Type      *string `json:"type"`
+	Percent   *int64  `json:"percent"`
+	Amount    *int64  `json:"amount"`
+	SkuId     *int64  `json:"sku_id"`
+	BuyCount  *int64  `json:"buy_count"`
+	FreeCount *int64  `json:"free_count"`
+	MinTotal  *int64  `json:"min_total"`
+}
+
+type createPromoPostRequest struct {
+	Code *string `json:"code"`
+	promoRequest
+}
+
+type promosResponse struct {
+	Promos []models.Promo `json:"promos"`
+}
+
+func applyPromoHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	code, err := validateApplyPromoPostRequest(w, r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	cart, err := cartService.ApplyPromo(r.Context(), owner, code)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, newCartResponse(cart))
+}
+
+func removePromoHandler(w http.ResponseWriter, r *http.Request, cartService *service.CartService) {
+	owner, err := validateCartOwner(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = cartService.RemovePromo(r.Context(), owner); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func createPromoHandler(w http.ResponseWriter, r *http.Request, promoService *service.PromoService) {
+	promo, err := validateCreatePromoPostRequest(w, r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = promoService.CreatePromo(r.Context(), promo); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusCreated, promo)
+}
+
+func listPromosHandler(w http.ResponseWriter, r *http.Request, promoService *service.PromoService) {
+	promos, err := promoService.ListPromos(r.Context())
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, promosResponse{promos})
+}
+
+func getPromoHandler(w http.ResponseWriter, r *http.Request, promoService *service.PromoService) {
+	code, err := validatePromoCode(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	promo, err := promoService.GetPromo(r.Context(), code)
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, promo)
+}
+
+func updatePromoHandler(w http.ResponseWriter, r *http.Request, promoService *service.PromoService) {
+	code, err := validatePromoCode(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	promo, err := validateUpdatePromoPutRequest(w, r, code)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = promoService.UpdatePromo(r.Context(), promo); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJsonResponse(w, r, http.StatusOK, promo)
+}
+
+func deletePromoHandler(w http.ResponseWriter, r *http.Request, promoService *service.PromoService) {
+	code, err := validatePromoCode(r)
+
+	if err != nil {
+		writeBadRequest(w, r, err)
+		return
+	}
+
+	if err = promoService.DeletePromo(r.Context(), code); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
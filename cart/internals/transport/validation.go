@@ -3,86 +3,454 @@ package transport
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/asaskevich/govalidator"
 	"io"
+	"math"
 	"net/http"
+	"reflect"
+	"route256.ozon.ru/project/cart/models"
+	"slices"
 	"strconv"
+	"strings"
 )
 
+// maxBodyBytes limits request bodies, every body of the cart API is a small json object.
+const maxBodyBytes = 1 << 16
+
+// fieldError is a constraint of the request field that the request breaks.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// requestError is a request that doesn't pass validation, Fields tell which fields are wrong if it's known.
+type requestError struct {
+	Message string
+	Fields  []fieldError
+}
+
+func (e *requestError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+
+	fields := make([]string, len(e.Fields))
+
+	for i, field := range e.Fields {
+		fields[i] = field.Field + " " + field.Message
+	}
+
+	return e.Message + ": " + strings.Join(fields, ", ")
+}
+
+func invalidFields(fields ...fieldError) error {
+	return &requestError{Message: "request doesn't correspond required schema", Fields: fields}
+}
+
 func validateUserId(r *http.Request) (int64, error) {
-	ok := govalidator.IsInt(r.PathValue("user_id"))
+	return validatePathId(r, "user_id", "user id is not valid")
+}
 
-	if !ok {
-		return 0, errors.New("user id is not valid")
+// validateCartOwner returns the user or the guest of the path.
+func validateCartOwner(r *http.Request) (models.CartOwner, error) {
+	if session := r.PathValue("session"); session != "" {
+		if fields := checkSession("session", &session); len(fields) != 0 {
+			return models.CartOwner{}, &requestError{Message: "guest session is not valid", Fields: fields}
+		}
+
+		return models.GuestCart(session), nil
 	}
 
-	userId, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+	userId, err := validateUserId(r)
 
 	if err != nil {
-		return 0, errors.New("user id is not valid")
+		return models.CartOwner{}, err
 	}
 
-	return userId, nil
+	return models.UserCart(userId), nil
+}
+
+// validateListName returns the secondary list of the path.
+func validateListName(r *http.Request) (models.ListName, error) {
+	list := models.ListName(r.PathValue("list"))
+
+	if !slices.Contains(models.Lists, list) {
+		return "", &requestError{
+			Message: "list is not valid",
+			Fields:  []fieldError{{"list", fmt.Sprintf("must be one of %v", models.Lists)}},
+		}
+	}
+
+	return list, nil
 }
 
 func validateSkuId(r *http.Request) (int64, error) {
-	ok := govalidator.IsInt(r.PathValue("sku_id"))
+	return validatePathId(r, "sku_id", "product item id is not valid")
+}
 
-	if !ok {
-		return 0, errors.New("product item id is not valid")
+func validatePathId(r *http.Request, name string, message string) (int64, error) {
+	value := r.PathValue(name)
+	id, err := strconv.ParseInt(value, 10, 64)
+
+	if !govalidator.IsInt(value) || err != nil || id <= 0 {
+		return 0, &requestError{
+			Message: message,
+			Fields:  []fieldError{{name, "must be a positive integer"}},
+		}
 	}
 
-	skuId, err := strconv.ParseInt(r.PathValue("sku_id"), 10, 64)
+	return id, nil
+}
 
-	if err != nil {
-		return 0, errors.New("product item id is not valid")
+// validateAddProductPostRequest returns the count to add, it must be positive.
+func validateAddProductPostRequest(w http.ResponseWriter, r *http.Request) (uint16, error) {
+	var postRequest addProductPostRequest
+
+	if err := decodeBody(w, r, &postRequest); err != nil {
+		return 0, err
+	}
+
+	if fields := checkRange("count", postRequest.Count, 1, math.MaxUint16); len(fields) != 0 {
+		return 0, invalidFields(fields...)
 	}
 
-	return skuId, nil
+	return uint16(*postRequest.Count), nil
 }
 
-func validateAddProductPostRequest(r *http.Request) (addProductPostRequest, error) {
-	body, err := io.ReadAll(r.Body)
-	postRequest := addProductPostRequest{}
+// validateSetItemCountPutRequest returns the count to set, 0 is valid and removes the product.
+func validateSetItemCountPutRequest(w http.ResponseWriter, r *http.Request) (uint16, error) {
+	var putRequest setItemCountPutRequest
 
-	if err != nil {
-		return postRequest, errors.New("body request is not valid")
+	if err := decodeBody(w, r, &putRequest); err != nil {
+		return 0, err
 	}
 
-	err = json.Unmarshal(body, &postRequest)
+	if fields := checkRange("count", putRequest.Count, 0, math.MaxUint16); len(fields) != 0 {
+		return 0, invalidFields(fields...)
+	}
 
-	if err != nil {
-		return postRequest, errors.New("body response isn't a valid json")
+	return uint16(*putRequest.Count), nil
+}
+
+// validateChangeItemCountPatchRequest returns the signed delta of the count, it must not be 0.
+func validateChangeItemCountPatchRequest(w http.ResponseWriter, r *http.Request) (int32, error) {
+	var patchRequest changeItemCountPatchRequest
+
+	if err := decodeBody(w, r, &patchRequest); err != nil {
+		return 0, err
 	}
 
-	ok, err := govalidator.ValidateStruct(addProductPostRequest{})
+	if fields := checkRange("delta", patchRequest.Delta, -math.MaxUint16, math.MaxUint16); len(fields) != 0 {
+		return 0, invalidFields(fields...)
+	}
 
-	if !ok || err != nil {
-		return postRequest, errors.New("body response doesn't correspond required schema")
+	if *patchRequest.Delta == 0 {
+		return 0, invalidFields(fieldError{"delta", "must not be 0"})
 	}
 
-	return postRequest, nil
+	return int32(*patchRequest.Delta), nil
 }
 
-func validateCheckoutPostRequest(r *http.Request) (checkoutPostRequest, error) {
-	body, err := io.ReadAll(r.Body)
-	postRequest := checkoutPostRequest{}
+// validateCheckoutPostRequest returns the user whose cart is checked out.
+func validateCheckoutPostRequest(w http.ResponseWriter, r *http.Request) (int64, error) {
+	var postRequest checkoutPostRequest
 
-	if err != nil {
-		return postRequest, errors.New("body request is not valid")
+	if err := decodeBody(w, r, &postRequest); err != nil {
+		return 0, err
 	}
 
-	err = json.Unmarshal(body, &postRequest)
+	if fields := checkRange("user", postRequest.User, 1, math.MaxInt64); len(fields) != 0 {
+		return 0, invalidFields(fields...)
+	}
 
-	if err != nil {
-		return postRequest, errors.New("body response isn't a valid json")
+	return *postRequest.User, nil
+}
+
+// validateIdempotencyKey returns the idempotency key of the checkout, it is optional.
+// The key goes into grpc metadata and storage keys, so it is a short token of printable ascii.
+func validateIdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+
+	if key == "" {
+		return "", nil
+	}
+
+	if len(key) > maxIdempotencyKeyLength || !govalidator.Matches(key, `^[!-~]+$`) {
+		return "", &requestError{
+			Message: "idempotency key is not valid",
+			Fields:  []fieldError{{IdempotencyKeyHeader, fmt.Sprintf("must be up to %d printable ascii characters without spaces", maxIdempotencyKeyLength)}},
+		}
+	}
+
+	return key, nil
+}
+
+// validateMergeCartPostRequest returns the session of the guest cart and the merge policy, sum by default.
+func validateMergeCartPostRequest(w http.ResponseWriter, r *http.Request) (string, models.MergePolicy, error) {
+	var postRequest mergeCartPostRequest
+
+	if err := decodeBody(w, r, &postRequest); err != nil {
+		return "", "", err
+	}
+
+	fields := checkSession("session", postRequest.Session)
+	policy := models.MergeSum
+
+	if postRequest.Policy != nil {
+		policy = models.MergePolicy(*postRequest.Policy)
+
+		if !slices.Contains(mergePolicies, policy) {
+			fields = append(fields, fieldError{"policy", fmt.Sprintf("must be one of %v", mergePolicies)})
+		}
+	}
+
+	if len(fields) != 0 {
+		return "", "", invalidFields(fields...)
+	}
+
+	return *postRequest.Session, policy, nil
+}
+
+// checkRange reports a missing value or a value out of [min, max].
+func checkRange(field string, value *int64, min int64, max int64) []fieldError {
+	if value == nil {
+		return []fieldError{{field, "is required"}}
+	}
+
+	if *value < min || *value > max {
+		return []fieldError{{field, fmt.Sprintf("must be between %d and %d", min, max)}}
+	}
+
+	return nil
+}
+
+// decodeBody decodes the body into dst. The body must be a single json object of at most maxBodyBytes
+// without fields unknown to dst.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return bodyError(err)
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			return maxBytesErr
+		}
+
+		return &requestError{Message: "body must contain a single json object"}
 	}
 
-	ok, err := govalidator.ValidateStruct(checkoutPostRequest{})
+	return nil
+}
+
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return maxBytesErr
+	case errors.Is(err, io.EOF):
+		return &requestError{Message: "body is empty"}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return &requestError{Message: "body isn't a valid json"}
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return &requestError{Message: "body must be a json object"}
+	case errors.As(err, &typeErr):
+		return invalidFields(fieldError{typeErr.Field, "must be " + jsonTypeName(typeErr)})
+	}
+
+	// encoding/json has no type for unknown fields, only the message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return invalidFields(fieldError{strings.Trim(field, `"`), "is unknown"})
+	}
+
+	return &requestError{Message: "body request is not valid"}
+}
+
+func jsonTypeName(typeErr *json.UnmarshalTypeError) string {
+	switch typeErr.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	default:
+		return "a " + typeErr.Type.String()
+	}
+}
+
+// maxPromoCodeLength limits promo codes, they are typed in by users.
+const maxPromoCodeLength = 32
+
+// maxIdempotencyKeyLength limits idempotency keys, clients send uuids or similar tokens.
+const maxIdempotencyKeyLength = 128
+
+// guest sessions are opaque tokens, long enough not to be guessed.
+const (
+	minSessionLength = 16
+	maxSessionLength = 128
+)
+
+var mergePolicies = []models.MergePolicy{models.MergeSum, models.MergeMax, models.MergeKeepUser}
+
+var promoTypes = []models.PromoType{models.PromoPercentOff, models.PromoFixedOff, models.PromoBuyNGetM}
+
+// validatePromoCode returns the promo code of the path.
+func validatePromoCode(r *http.Request) (string, error) {
+	code := r.PathValue("code")
+
+	if fields := checkPromoCode("code", &code); len(fields) != 0 {
+		return "", &requestError{Message: "promo code is not valid", Fields: fields}
+	}
+
+	return code, nil
+}
+
+// validateApplyPromoPostRequest returns the promo code to apply to the cart.
+func validateApplyPromoPostRequest(w http.ResponseWriter, r *http.Request) (string, error) {
+	var postRequest applyPromoPostRequest
+
+	if err := decodeBody(w, r, &postRequest); err != nil {
+		return "", err
+	}
+
+	if fields := checkPromoCode("code", postRequest.Code); len(fields) != 0 {
+		return "", invalidFields(fields...)
+	}
+
+	return *postRequest.Code, nil
+}
+
+// validateCreatePromoPostRequest returns the promo code with its rule.
+func validateCreatePromoPostRequest(w http.ResponseWriter, r *http.Request) (models.Promo, error) {
+	var postRequest createPromoPostRequest
+
+	if err := decodeBody(w, r, &postRequest); err != nil {
+		return models.Promo{}, err
+	}
+
+	fields := checkPromoCode("code", postRequest.Code)
+	promo, ruleFields := checkPromoRule(postRequest.promoRequest)
+
+	if fields = append(fields, ruleFields...); len(fields) != 0 {
+		return models.Promo{}, invalidFields(fields...)
+	}
+
+	promo.Code = *postRequest.Code
+
+	return promo, nil
+}
+
+// validateUpdatePromoPutRequest returns the promo code with the new rule, the code is taken from the path.
+func validateUpdatePromoPutRequest(w http.ResponseWriter, r *http.Request, code string) (models.Promo, error) {
+	var putRequest promoRequest
+
+	if err := decodeBody(w, r, &putRequest); err != nil {
+		return models.Promo{}, err
+	}
+
+	promo, fields := checkPromoRule(putRequest)
+
+	if len(fields) != 0 {
+		return models.Promo{}, invalidFields(fields...)
+	}
+
+	promo.Code = code
+
+	return promo, nil
+}
+
+// checkPromoCode reports a missing code or a code that isn't a word of latin letters, digits, '-' and '_'.
+func checkPromoCode(field string, code *string) []fieldError {
+	if code == nil || *code == "" {
+		return []fieldError{{field, "is required"}}
+	}
+
+	if len(*code) > maxPromoCodeLength || strings.Trim(*code, "-_") == "" || !govalidator.Matches(*code, `^[A-Za-z0-9_-]+$`) {
+		return []fieldError{{field, fmt.Sprintf("must be up to %d latin letters, digits, '-' and '_'", maxPromoCodeLength)}}
+	}
+
+	return nil
+}
+
+// checkSession reports a missing session or a session that isn't a url safe token.
+func checkSession(field string, session *string) []fieldError {
+	if session == nil || *session == "" {
+		return []fieldError{{field, "is required"}}
+	}
+
+	if len(*session) < minSessionLength || len(*session) > maxSessionLength || !govalidator.Matches(*session, `^[A-Za-z0-9_-]+$`) {
+		return []fieldError{{field, fmt.Sprintf("must be %d to %d latin letters, digits, '-' and '_'", minSessionLength, maxSessionLength)}}
+	}
+
+	return nil
+}
+
+// checkPromoRule returns the rule of the request. The numbers of the type are required,
+// min_total is optional for every type and the rest must not be set.
+func checkPromoRule(request promoRequest) (models.Promo, []fieldError) {
+	if request.Type == nil {
+		return models.Promo{}, []fieldError{{"type", "is required"}}
+	}
+
+	promo := models.Promo{Type: models.PromoType(*request.Type)}
+
+	if !slices.Contains(promoTypes, promo.Type) {
+		return models.Promo{}, []fieldError{{"type", fmt.Sprintf("must be one of %v", promoTypes)}}
+	}
+
+	params := []struct {
+		field string
+		value *int64
+		min   int64
+		max   int64
+		used  bool
+	}{
+		{"percent", request.Percent, 1, 100, promo.Type == models.PromoPercentOff},
+		{"amount", request.Amount, 1, math.MaxUint32, promo.Type == models.PromoFixedOff},
+		{"sku_id", request.SkuId, 1, math.MaxInt64, promo.Type == models.PromoBuyNGetM},
+		{"buy_count", request.BuyCount, 1, math.MaxUint16, promo.Type == models.PromoBuyNGetM},
+		{"free_count", request.FreeCount, 1, math.MaxUint16, promo.Type == models.PromoBuyNGetM},
+	}
+
+	fields := make([]fieldError, 0)
+
+	for _, param := range params {
+		switch {
+		case param.used:
+			fields = append(fields, checkRange(param.field, param.value, param.min, param.max)...)
+		case param.value != nil:
+			fields = append(fields, fieldError{param.field, fmt.Sprintf("is not used by %s", promo.Type)})
+		}
+	}
+
+	if request.MinTotal != nil {
+		fields = append(fields, checkRange("min_total", request.MinTotal, 0, math.MaxUint32)...)
+	}
+
+	if len(fields) != 0 {
+		return models.Promo{}, fields
+	}
+
+	promo.Percent = uint32(valueOrZero(request.Percent))
+	promo.Amount = uint32(valueOrZero(request.Amount))
+	promo.SkuId = valueOrZero(request.SkuId)
+	promo.BuyCount = uint16(valueOrZero(request.BuyCount))
+	promo.FreeCount = uint16(valueOrZero(request.FreeCount))
+	promo.MinTotal = uint32(valueOrZero(request.MinTotal))
+
+	return promo, nil
+}
 
-	if !ok || err != nil {
-		return postRequest, errors.New("body response doesn't correspond required schema")
+func valueOrZero(value *int64) int64 {
+	if value == nil {
+		return 0
 	}
 
-	return postRequest, nil
+	return *value
 }
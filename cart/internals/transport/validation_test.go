@@ -0,0 +1,358 @@
+package transport
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"route256.ozon.ru/project/cart/models"
+	"strings"
+	"testing"
+)
+
+func TestValidateAddProductPostRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCount  uint16
+		wantStatus int
+		wantFields []fieldError
+	}{
+		{
+			name:      "should accept count",
+			body:      `{"count": 5}`,
+			wantCount: 5,
+		},
+		{
+			name:       "should reject negative count",
+			body:       `{"count": -1}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"count", "must be between 1 and 65535"}},
+		},
+		{
+			name:       "should reject count over uint16",
+			body:       `{"count": 65536}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"count", "must be between 1 and 65535"}},
+		},
+		{
+			name:       "should reject zero count",
+			body:       `{"count": 0}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"count", "must be between 1 and 65535"}},
+		},
+		{
+			name:       "should reject missing count",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"count", "is required"}},
+		},
+		{
+			name:       "should reject fractional count",
+			body:       `{"count": 1.5}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"count", "must be an integer"}},
+		},
+		{
+			name:       "should reject unknown field",
+			body:       `{"count": 1, "price": 10}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []fieldError{{"price", "is unknown"}},
+		},
+		{
+			name:       "should reject invalid json",
+			body:       `{"count": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject trailing data",
+			body:       `{"count": 1} {"count": 2}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject empty body",
+			body:       ``,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject body over the limit",
+			body:       `{"count": 1` + strings.Repeat(" ", maxBodyBytes) + `}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/user/1/cart/1", strings.NewReader(test.body))
+
+			gotCount, err := validateAddProductPostRequest(recorder, request)
+
+			if test.wantStatus == 0 {
+				require.NoError(t, err)
+				require.Equal(t, test.wantCount, gotCount)
+				return
+			}
+
+			require.Error(t, err)
+			writeBadRequest(recorder, request, err)
+
+			var body struct {
+				Code    string            `json:"code"`
+				Details validationDetails `json:"details"`
+			}
+
+			require.Equal(t, test.wantStatus, recorder.Code)
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			require.Equal(t, test.wantFields, body.Details.Fields)
+		})
+	}
+}
+
+func TestValidateChangeItemCountPatchRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		body      string
+		wantDelta int32
+		wantErr   bool
+	}{
+		{"should accept negative delta", `{"delta": -65535}`, -65535, false},
+		{"should accept positive delta", `{"delta": 3}`, 3, false},
+		{"should reject zero delta", `{"delta": 0}`, 0, true},
+		{"should reject delta out of range", `{"delta": -65536}`, 0, true},
+		{"should reject delta as string", `{"delta": "1"}`, 0, true},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPatch, "/user/1/cart/1", strings.NewReader(test.body))
+
+			gotDelta, err := validateChangeItemCountPatchRequest(httptest.NewRecorder(), request)
+
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.wantDelta, gotDelta)
+		})
+	}
+}
+
+func TestValidateCreatePromoPostRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantPromo  models.Promo
+		wantFields []fieldError
+	}{
+		{
+			name:      "should accept percent off",
+			body:      `{"code": "SALE-10", "type": "percent_off", "percent": 10, "min_total": 1000}`,
+			wantPromo: models.Promo{Code: "SALE-10", Type: models.PromoPercentOff, Percent: 10, MinTotal: 1000},
+		},
+		{
+			name:      "should accept buy n get m",
+			body:      `{"code": "3FOR2", "type": "buy_n_get_m", "sku_id": 1, "buy_count": 2, "free_count": 1}`,
+			wantPromo: models.Promo{Code: "3FOR2", Type: models.PromoBuyNGetM, SkuId: 1, BuyCount: 2, FreeCount: 1},
+		},
+		{
+			name:       "should reject missing code and type",
+			body:       `{}`,
+			wantFields: []fieldError{{"code", "is required"}, {"type", "is required"}},
+		},
+		{
+			name:       "should reject code with spaces",
+			body:       `{"code": "sale 10", "type": "fixed_off", "amount": 100}`,
+			wantFields: []fieldError{{"code", "must be up to 32 latin letters, digits, '-' and '_'"}},
+		},
+		{
+			name:       "should reject unknown type",
+			body:       `{"code": "GIFT", "type": "gift"}`,
+			wantFields: []fieldError{{"type", "must be one of [percent_off fixed_off buy_n_get_m]"}},
+		},
+		{
+			name:       "should reject percent over 100",
+			body:       `{"code": "ALL", "type": "percent_off", "percent": 101}`,
+			wantFields: []fieldError{{"percent", "must be between 1 and 100"}},
+		},
+		{
+			name: "should reject numbers of another type",
+			body: `{"code": "SALE", "type": "fixed_off", "amount": 100, "percent": 10}`,
+			wantFields: []fieldError{
+				{"percent", "is not used by fixed_off"},
+			},
+		},
+		{
+			name: "should reject missing numbers of the type",
+			body: `{"code": "3FOR2", "type": "buy_n_get_m", "sku_id": 1}`,
+			wantFields: []fieldError{
+				{"buy_count", "is required"},
+				{"free_count", "is required"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, "/promos", strings.NewReader(test.body))
+
+			gotPromo, err := validateCreatePromoPostRequest(httptest.NewRecorder(), request)
+
+			if test.wantFields == nil {
+				require.NoError(t, err)
+				require.Equal(t, test.wantPromo, gotPromo)
+				return
+			}
+
+			var reqErr *requestError
+
+			require.ErrorAs(t, err, &reqErr)
+			require.Equal(t, test.wantFields, reqErr.Fields)
+		})
+	}
+}
+
+func TestValidateMergeCartPostRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		body        string
+		wantSession string
+		wantPolicy  models.MergePolicy
+		wantFields  []fieldError
+	}{
+		{
+			name:        "should sum counts by default",
+			body:        `{"session": "0123456789abcdef"}`,
+			wantSession: "0123456789abcdef",
+			wantPolicy:  models.MergeSum,
+		},
+		{
+			name:        "should accept policy",
+			body:        `{"session": "0123456789abcdef", "policy": "keep_user"}`,
+			wantSession: "0123456789abcdef",
+			wantPolicy:  models.MergeKeepUser,
+		},
+		{
+			name:       "should reject short session",
+			body:       `{"session": "abc"}`,
+			wantFields: []fieldError{{"session", "must be 16 to 128 latin letters, digits, '-' and '_'"}},
+		},
+		{
+			name: "should reject missing session and unknown policy",
+			body: `{"policy": "min"}`,
+			wantFields: []fieldError{
+				{"session", "is required"},
+				{"policy", "must be one of [sum max keep_user]"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, "/user/1/cart/merge", strings.NewReader(test.body))
+
+			gotSession, gotPolicy, err := validateMergeCartPostRequest(httptest.NewRecorder(), request)
+
+			if test.wantFields == nil {
+				require.NoError(t, err)
+				require.Equal(t, test.wantSession, gotSession)
+				require.Equal(t, test.wantPolicy, gotPolicy)
+				return
+			}
+
+			var reqErr *requestError
+
+			require.ErrorAs(t, err, &reqErr)
+			require.Equal(t, test.wantFields, reqErr.Fields)
+		})
+	}
+}
+
+func TestValidateCartOwner(t *testing.T) {
+	t.Parallel()
+
+	userRequest := httptest.NewRequest(http.MethodGet, "/user/7/cart", nil)
+	userRequest.SetPathValue("user_id", "7")
+
+	owner, err := validateCartOwner(userRequest)
+	require.NoError(t, err)
+	require.Equal(t, models.UserCart(7), owner)
+
+	guestRequest := httptest.NewRequest(http.MethodGet, "/guest/0123456789abcdef/cart", nil)
+	guestRequest.SetPathValue("session", "0123456789abcdef")
+
+	owner, err = validateCartOwner(guestRequest)
+	require.NoError(t, err)
+	require.Equal(t, models.GuestCart("0123456789abcdef"), owner)
+
+	badRequest := httptest.NewRequest(http.MethodGet, "/guest/abc/cart", nil)
+	badRequest.SetPathValue("session", "abc")
+
+	_, err = validateCartOwner(badRequest)
+	require.Error(t, err)
+}
+
+func TestValidateListItem(t *testing.T) {
+	t.Parallel()
+
+	request := httptest.NewRequest(http.MethodPost, "/user/7/lists/wishlist/3", nil)
+	request.SetPathValue("user_id", "7")
+	request.SetPathValue("list", "wishlist")
+	request.SetPathValue("sku_id", "3")
+
+	owner, list, skuId, err := validateListItem(request)
+	require.NoError(t, err)
+	require.Equal(t, models.UserCart(7), owner)
+	require.Equal(t, models.ListWishlist, list)
+	require.Equal(t, int64(3), skuId)
+
+	badRequest := httptest.NewRequest(http.MethodPost, "/user/7/lists/favorites/3", nil)
+	badRequest.SetPathValue("user_id", "7")
+	badRequest.SetPathValue("list", "favorites")
+	badRequest.SetPathValue("sku_id", "3")
+
+	_, _, _, err = validateListItem(badRequest)
+
+	var reqErr *requestError
+	require.ErrorAs(t, err, &reqErr)
+	require.Equal(t, "list", reqErr.Fields[0].Field)
+}
+
+func TestValidateIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{"", "0f8fad5b-d9cb-469f-a165-70867728950e", strings.Repeat("k", maxIdempotencyKeyLength)} {
+		request := httptest.NewRequest(http.MethodPost, "/cart/checkout", nil)
+		request.Header.Set(IdempotencyKeyHeader, key)
+
+		got, err := validateIdempotencyKey(request)
+		require.NoError(t, err)
+		require.Equal(t, key, got)
+	}
+}
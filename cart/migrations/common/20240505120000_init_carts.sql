@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists carts
+(
+    user_id    bigint    not null,
+    created_at timestamp not null,
+    primary key (user_id)
+);
+
+create table if not exists cart_items
+(
+    user_id bigint not null references carts (user_id) on delete cascade,
+    sku_id  bigint not null,
+    name    text   not null,
+    count   int    not null,
+    primary key (user_id, sku_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists cart_items cascade;
+drop table if exists carts cascade;
+-- +goose StatementEnd
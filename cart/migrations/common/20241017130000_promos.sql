@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists promos
+(
+    code       text   not null,
+    type       text   not null,
+    percent    int    not null default 0,
+    amount     bigint not null default 0,
+    sku_id     bigint not null default 0,
+    buy_count  int    not null default 0,
+    free_count int    not null default 0,
+    min_total  bigint not null default 0,
+    primary key (code)
+);
+
+alter table carts
+    add column if not exists promo_code text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table carts
+    drop column if exists promo_code;
+
+drop table if exists promos cascade;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table cart_items
+    drop constraint if exists cart_items_user_id_fkey;
+
+alter table carts
+    alter column user_id type text using user_id::text;
+alter table carts
+    rename column user_id to owner;
+
+alter table cart_items
+    alter column user_id type text using user_id::text;
+alter table cart_items
+    rename column user_id to owner;
+
+alter table cart_items
+    add constraint cart_items_owner_fkey foreign key (owner) references carts (owner) on delete cascade;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- guest carts and lists (owners '<id>:list:<name>') have no user id to keep
+delete from carts
+where owner like 'guest:%' or owner like '%:list:%';
+
+alter table cart_items
+    drop constraint if exists cart_items_owner_fkey;
+
+alter table cart_items
+    rename column owner to user_id;
+alter table cart_items
+    alter column user_id type bigint using user_id::bigint;
+
+alter table carts
+    rename column owner to user_id;
+alter table carts
+    alter column user_id type bigint using user_id::bigint;
+
+alter table cart_items
+    add constraint cart_items_user_id_fkey foreign key (user_id) references carts (user_id) on delete cascade;
+-- +goose StatementEnd
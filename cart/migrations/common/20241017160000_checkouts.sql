@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists checkouts
+(
+    user_id    bigint    not null,
+    status     int       not null,
+    order_id   bigint    not null default 0,
+    expires_at timestamp not null,
+    primary key (user_id)
+);
+
+create table if not exists checkout_orders
+(
+    user_id         bigint    not null,
+    idempotency_key text      not null,
+    order_id        bigint    not null,
+    expires_at      timestamp not null,
+    primary key (user_id, idempotency_key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists checkout_orders cascade;
+
+drop table if exists checkouts cascade;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the token tells the checkout holding the lock from an expired one that has been taken over
+alter table checkouts
+    add column if not exists token text not null default '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table checkouts
+    drop column if exists token;
+-- +goose StatementEnd
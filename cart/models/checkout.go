@@ -0,0 +1,28 @@
+package models
+
+type CheckoutStatus int
+
+const (
+	CheckoutStarted CheckoutStatus = iota + 1
+	CheckoutOrderCreated
+	CheckoutCompleted
+	CheckoutCompensated
+	CheckoutFailed
+)
+
+func (s CheckoutStatus) String() string {
+	switch s {
+	case CheckoutStarted:
+		return "started"
+	case CheckoutOrderCreated:
+		return "order created"
+	case CheckoutCompleted:
+		return "completed"
+	case CheckoutCompensated:
+		return "compensated"
+	case CheckoutFailed:
+		return "failed"
+	}
+
+	return "unknown"
+}
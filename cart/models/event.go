@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type CartEventType string
+
+const (
+	// EventItemAdded is a product added to the cart or its count grown
+	EventItemAdded CartEventType = "cart.item_added"
+	// EventItemRemoved is a product removed from the cart or its count reduced
+	EventItemRemoved CartEventType = "cart.item_removed"
+	// EventCleared is the cart deleted with all its products
+	EventCleared CartEventType = "cart.cleared"
+	// EventCheckedOut is a product of the cart ordered by checkout, there is an event for every product of the order
+	EventCheckedOut CartEventType = "cart.checked_out"
+)
+
+// CartEvent is a change of the cart of a user or a guest. Count is the count of the product
+// in the cart after the change, 0 when the product is removed, or the ordered count for checkout.
+type CartEvent struct {
+	Type    CartEventType `json:"type"`
+	UserId  int64         `json:"user_id,omitempty"`
+	Session string        `json:"session,omitempty"`
+	SkuId   int64         `json:"sku_id,omitempty"`
+	Count   uint16        `json:"count"`
+	OrderId int64         `json:"order_id,omitempty"`
+	Time    time.Time     `json:"time"`
+}
+
+// Key is the key of the owner of the cart, so events of a cart are kept in order.
+func (event CartEvent) Key() string {
+	return CartOwner{UserId: event.UserId, Session: event.Session}.Key()
+}
@@ -0,0 +1,83 @@
+package models
+
+import "strconv"
+
+// CartOwner is whom the cart belongs to: a user or a guest known only by an opaque session token before they log in.
+// An owner with List is a secondary list of the owner, it's stored like a cart but never checked out.
+type CartOwner struct {
+	UserId  int64
+	Session string
+	List    ListName
+}
+
+func UserCart(userId int64) CartOwner {
+	return CartOwner{UserId: userId}
+}
+
+func GuestCart(session string) CartOwner {
+	return CartOwner{Session: session}
+}
+
+// WithList returns the secondary list of the owner.
+func (owner CartOwner) WithList(list ListName) CartOwner {
+	owner.List = list
+	return owner
+}
+
+func (owner CartOwner) IsGuest() bool {
+	return owner.Session != ""
+}
+
+// Key is the owner as a string. Users are keyed by the bare id as before guest carts, guests by "guest:<session>".
+// Lists add ":list:<name>" to the key of the owner.
+func (owner CartOwner) Key() string {
+	key := strconv.FormatInt(owner.UserId, 10)
+
+	if owner.IsGuest() {
+		key = "guest:" + owner.Session
+	}
+
+	if owner.List != "" {
+		key += ":list:" + string(owner.List)
+	}
+
+	return key
+}
+
+func (owner CartOwner) String() string {
+	name := "user " + strconv.FormatInt(owner.UserId, 10)
+
+	if owner.IsGuest() {
+		name = "guest " + owner.Session
+	}
+
+	if owner.List != "" {
+		name += " list " + string(owner.List)
+	}
+
+	return name
+}
+
+// ListName is a secondary list of products kept alongside the cart.
+type ListName string
+
+const (
+	ListSavedForLater ListName = "saved_for_later"
+	ListWishlist      ListName = "wishlist"
+)
+
+// Lists are all the secondary lists every owner has.
+var Lists = []ListName{ListSavedForLater, ListWishlist}
+
+// MergePolicy decides the count of a product that is in both the guest cart and the user cart when they are merged.
+// Products only the guest has are always moved to the user cart.
+type MergePolicy string
+
+const (
+	// MergeSum adds the guest count to the user count
+	MergeSum MergePolicy = "sum"
+	// MergeMax keeps the larger of the two counts
+	MergeMax MergePolicy = "max"
+	// MergeKeepUser keeps the user count
+	MergeKeepUser MergePolicy = "keep_user"
+)
@@ -0,0 +1,8 @@
+package models
+
+// PriceChange is a cart line whose product price differs from the price the user saw.
+type PriceChange struct {
+	SkuId    int64  `json:"sku_id"`
+	OldPrice uint32 `json:"old_price"`
+	NewPrice uint32 `json:"new_price"`
+}
@@ -5,4 +5,8 @@ type Product struct {
 	Name  string `json:"name"`
 	Price uint32 `json:"price"`
 	Count uint16 `json:"count"`
+	// Stale is set when the product service is failing and the name and price may be outdated
+	Stale bool `json:"stale,omitempty"`
+	// PriceChanged is set when Price differs from the price the user saw when they put the product into the cart
+	PriceChanged bool `json:"price_changed"`
 }
@@ -0,0 +1,56 @@
+package models
+
+type PromoType string
+
+const (
+	// PromoPercentOff takes Percent off the subtotal of the cart
+	PromoPercentOff PromoType = "percent_off"
+	// PromoFixedOff takes Amount off the subtotal of the cart
+	PromoFixedOff PromoType = "fixed_off"
+	// PromoBuyNGetM makes FreeCount of every BuyCount+FreeCount products of SkuId free
+	PromoBuyNGetM PromoType = "buy_n_get_m"
+)
+
+// Promo is a promo code with the rule of its discount. The code gives no discount
+// while the subtotal of the cart is below MinTotal, whatever the type is.
+type Promo struct {
+	Code      string    `json:"code"`
+	Type      PromoType `json:"type"`
+	Percent   uint32    `json:"percent,omitempty"`
+	Amount    uint32    `json:"amount,omitempty"`
+	SkuId     int64     `json:"sku_id,omitempty"`
+	BuyCount  uint16    `json:"buy_count,omitempty"`
+	FreeCount uint16    `json:"free_count,omitempty"`
+	MinTotal  uint32    `json:"min_total,omitempty"`
+}
+
+// Discount is the amount taken off the cart by the promo code.
+type Discount struct {
+	Code   string    `json:"code"`
+	Type   PromoType `json:"type"`
+	Amount uint32    `json:"amount"`
+}
+
+// Cart is the content of the cart at current prices with the discounts of the applied promo code.
+// UnitDiscounts are the discounts spread over the units of Items by sku, so the unit prices
+// the user is charged add up to Total.
+type Cart struct {
+	Items         []Product
+	Subtotal      uint32
+	Discounts     []Discount
+	Total         uint32
+	PromoCode     string
+	UnitDiscounts map[int64]uint32
+}
+
+// ChargedItems returns Items at the unit prices the user is charged.
+func (cart Cart) ChargedItems() []Product {
+	items := make([]Product, len(cart.Items))
+
+	for i, item := range cart.Items {
+		item.Price -= cart.UnitDiscounts[item.SkuId]
+		items[i] = item
+	}
+
+	return items
+}
@@ -0,0 +1,8 @@
+package models
+
+// StockShortage is a cart line that LOMS can't reserve in full.
+type StockShortage struct {
+	SkuId     int64  `json:"sku_id"`
+	Requested uint16 `json:"requested"`
+	Available uint64 `json:"available"`
+}
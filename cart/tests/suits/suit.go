@@ -26,7 +26,7 @@ const address = "localhost:8080"
 
 func (suit *CartServiceSuit) SetupTest() {
 	conf := config.NewConfig()
-	server := &http.Server{Addr: address, Handler: app.NewCartServer(conf).Handler}
+	server := &http.Server{Addr: address, Handler: app.NewCartServer(context.Background(), conf).Handler}
 
 	suit.Server = server
 	suit.BaseUrl = prefix + address
@@ -62,7 +62,7 @@ func (suit *CartServiceSuit) TestSaveProductItemIntegration() {
 	response, err = client.Do(getCartRequest)
 	responseBody, err := io.ReadAll(response.Body)
 
-	wantResponse := `{"total_price":11010,"items":[{"sku_id":773297411,"name":"Кроссовки Nike JORDAN","price":2202,"count":5}]}`
+	wantResponse := `{"total_price":11010,"items":[{"sku_id":773297411,"name":"Кроссовки Nike JORDAN","price":2202,"count":5,"price_changed":false}],"subtotal":11010,"discounts":[]}`
 
 	suit.Require().NoError(err)
 	suit.Require().Equal(http.StatusOK, response.StatusCode)
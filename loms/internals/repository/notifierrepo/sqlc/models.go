@@ -16,6 +16,13 @@ type OrdersEvent struct {
 	SendAt      pgtype.Timestamp
 }
 
+type OrdersIdempotencyKey struct {
+	UserID         int64
+	IdempotencyKey string
+	OrderID        int64
+	CreatedAt      pgtype.Timestamp
+}
+
 type OrdersInfo struct {
 	OrderID int64
 	Status  int32
@@ -3,8 +3,8 @@ insert into orders_info (order_id, status, user_id)
 values ($1, $2, $3);
 
 -- name: InsertOrderItem :exec
-insert into orders_items (order_id, item_id, count)
-values ($1, $2, $3);
+insert into orders_items (order_id, item_id, count, price)
+values ($1, $2, $3, $4);
 
 -- name: UpdateOrderStatus :exec
 update orders_info
@@ -16,10 +16,24 @@ select order_id, status, user_id from orders_info
 where order_id=$1;
 
 -- name: GetOrderItem :many
-select order_id, item_id, count from orders_items
+select order_id, item_id, count, price from orders_items
 where order_id=$1;
 
 -- name: GetLastOrderItem :one
-select order_id, item_id, count from orders_items
+select order_id, item_id, count, price from orders_items
 order by order_id DESC
 limit 1;
+
+-- name: InsertIdempotencyKey :one
+insert into orders_idempotency_keys (user_id, idempotency_key, order_id, created_at)
+values ($1, $2, $3, $4)
+on conflict (user_id, idempotency_key) do nothing
+returning order_id;
+
+-- name: GetOrderIdByIdempotencyKey :one
+select order_id from orders_idempotency_keys
+where user_id = $1 and idempotency_key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+delete from orders_idempotency_keys
+where user_id = $1 and order_id = $2;
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"route256.ozon.ru/project/loms/internals/infra/db"
 	"route256.ozon.ru/project/loms/internals/infra/shardmanager"
 	ordersrepo "route256.ozon.ru/project/loms/internals/repository/ordersrepo/sqlc"
 	"route256.ozon.ru/project/loms/model/itemmodel"
 	"route256.ozon.ru/project/loms/model/ordermodel"
+	"time"
 )
 
 type OrdersRepo struct {
@@ -45,6 +47,7 @@ func (repo *OrdersRepo) Create(ctx context.Context, tx db.Tx, shardIndex shardma
 			OrderID: orderId,
 			ItemID:  int64(item.SkuId),
 			Count:   int32(item.Count),
+			Price:   int64(item.Price),
 		})
 
 		if err != nil {
@@ -99,12 +102,65 @@ func (repo *OrdersRepo) GetOrder(ctx context.Context, tx db.Tx, orderId int64) (
 		items = append(items, itemmodel.Item{
 			SkuId: uint32(item.ItemID),
 			Count: uint16(item.Count),
+			Price: uint32(item.Price),
 		})
 	}
 
 	return orderInfo.UserID, ordermodel.Status(orderInfo.Status), items, nil
 }
 
+func (repo *OrdersRepo) FindByIdempotencyKey(ctx context.Context, tx db.Tx, userId int64, key string) (int64, bool, error) {
+	q := ordersrepo.New(tx)
+
+	orderId, err := q.GetOrderIdByIdempotencyKey(ctx, ordersrepo.GetOrderIdByIdempotencyKeyParams{
+		UserID:         userId,
+		IdempotencyKey: key,
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	return orderId, true, nil
+}
+
+// SaveIdempotencyKey stores the key for the order and returns the order the key belongs to.
+// When a concurrent request has already stored the key, its order is returned instead of orderId.
+func (repo *OrdersRepo) SaveIdempotencyKey(ctx context.Context, tx db.Tx, userId int64, key string, orderId int64) (int64, error) {
+	q := ordersrepo.New(tx)
+
+	savedId, err := q.InsertIdempotencyKey(ctx, ordersrepo.InsertIdempotencyKeyParams{
+		UserID:         userId,
+		IdempotencyKey: key,
+		OrderID:        orderId,
+		CreatedAt:      pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+	})
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return savedId, err
+	}
+
+	// the insert waits for the concurrent transaction, so its key is visible here
+	return q.GetOrderIdByIdempotencyKey(ctx, ordersrepo.GetOrderIdByIdempotencyKeyParams{
+		UserID:         userId,
+		IdempotencyKey: key,
+	})
+}
+
+// DeleteIdempotencyKey releases the keys of the order, so they can be used for a new order.
+func (repo *OrdersRepo) DeleteIdempotencyKey(ctx context.Context, tx db.Tx, userId int64, orderId int64) error {
+	q := ordersrepo.New(tx)
+
+	return q.DeleteIdempotencyKey(ctx, ordersrepo.DeleteIdempotencyKeyParams{
+		UserID:  userId,
+		OrderID: orderId,
+	})
+}
+
 func handleSqlError(err error) error {
 	switch {
 	case errors.Is(err, pgx.ErrNoRows):
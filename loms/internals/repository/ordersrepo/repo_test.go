@@ -0,0 +1,58 @@
+package ordersrepo
+
+import (
+	"context"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOrdersRepo_SaveIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mock       func(conn pgxmock.PgxPoolIface)
+		wantResult int64
+	}{
+		{
+			name: "should save a new key",
+			mock: func(conn pgxmock.PgxPoolIface) {
+				conn.ExpectQuery("insert into orders_idempotency_keys").
+					WithArgs(int64(1), "checkout-1", int64(1000), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"order_id"}).AddRow(int64(1000)))
+			},
+			wantResult: 1000,
+		},
+		{
+			name: "should return the order of a key saved concurrently",
+			mock: func(conn pgxmock.PgxPoolIface) {
+				conn.ExpectQuery("insert into orders_idempotency_keys").
+					WithArgs(int64(1), "checkout-1", int64(1000), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"order_id"}))
+				conn.ExpectQuery("select order_id from orders_idempotency_keys").
+					WithArgs(int64(1), "checkout-1").
+					WillReturnRows(pgxmock.NewRows([]string{"order_id"}).AddRow(int64(999)))
+			},
+			wantResult: 999,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, err := pgxmock.NewPool()
+			require.NoError(t, err)
+
+			test.mock(conn)
+			gotResult, gotErr := NewRepo().SaveIdempotencyKey(context.Background(), conn, 1, "checkout-1", 1000)
+
+			require.NoError(t, gotErr)
+			require.Equal(t, test.wantResult, gotResult)
+			require.NoError(t, conn.ExpectationsWereMet())
+		})
+	}
+}
@@ -7,10 +7,27 @@ package ordersrepo
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+delete from orders_idempotency_keys
+where user_id = $1 and order_id = $2
+`
+
+type DeleteIdempotencyKeyParams struct {
+	UserID  int64
+	OrderID int64
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.Exec(ctx, deleteIdempotencyKey, arg.UserID, arg.OrderID)
+	return err
+}
+
 const getLastOrderItem = `-- name: GetLastOrderItem :one
-select order_id, item_id, count from orders_items
+select order_id, item_id, count, price from orders_items
 order by order_id DESC
 limit 1
 `
@@ -18,10 +35,32 @@ limit 1
 func (q *Queries) GetLastOrderItem(ctx context.Context) (OrdersItem, error) {
 	row := q.db.QueryRow(ctx, getLastOrderItem)
 	var i OrdersItem
-	err := row.Scan(&i.OrderID, &i.ItemID, &i.Count)
+	err := row.Scan(
+		&i.OrderID,
+		&i.ItemID,
+		&i.Count,
+		&i.Price,
+	)
 	return i, err
 }
 
+const getOrderIdByIdempotencyKey = `-- name: GetOrderIdByIdempotencyKey :one
+select order_id from orders_idempotency_keys
+where user_id = $1 and idempotency_key = $2
+`
+
+type GetOrderIdByIdempotencyKeyParams struct {
+	UserID         int64
+	IdempotencyKey string
+}
+
+func (q *Queries) GetOrderIdByIdempotencyKey(ctx context.Context, arg GetOrderIdByIdempotencyKeyParams) (int64, error) {
+	row := q.db.QueryRow(ctx, getOrderIdByIdempotencyKey, arg.UserID, arg.IdempotencyKey)
+	var order_id int64
+	err := row.Scan(&order_id)
+	return order_id, err
+}
+
 const getOrderInfo = `-- name: GetOrderInfo :one
 select order_id, status, user_id from orders_info
 where order_id=$1
@@ -35,7 +74,7 @@ func (q *Queries) GetOrderInfo(ctx context.Context, orderID int64) (OrdersInfo,
 }
 
 const getOrderItem = `-- name: GetOrderItem :many
-select order_id, item_id, count from orders_items
+select order_id, item_id, count, price from orders_items
 where order_id=$1
 `
 
@@ -48,7 +87,12 @@ func (q *Queries) GetOrderItem(ctx context.Context, orderID int64) ([]OrdersItem
 	var items []OrdersItem
 	for rows.Next() {
 		var i OrdersItem
-		if err := rows.Scan(&i.OrderID, &i.ItemID, &i.Count); err != nil {
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.ItemID,
+			&i.Count,
+			&i.Price,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -59,6 +103,32 @@ func (q *Queries) GetOrderItem(ctx context.Context, orderID int64) ([]OrdersItem
 	return items, nil
 }
 
+const insertIdempotencyKey = `-- name: InsertIdempotencyKey :one
+insert into orders_idempotency_keys (user_id, idempotency_key, order_id, created_at)
+values ($1, $2, $3, $4)
+on conflict (user_id, idempotency_key) do nothing
+returning order_id
+`
+
+type InsertIdempotencyKeyParams struct {
+	UserID         int64
+	IdempotencyKey string
+	OrderID        int64
+	CreatedAt      pgtype.Timestamp
+}
+
+func (q *Queries) InsertIdempotencyKey(ctx context.Context, arg InsertIdempotencyKeyParams) (int64, error) {
+	row := q.db.QueryRow(ctx, insertIdempotencyKey,
+		arg.UserID,
+		arg.IdempotencyKey,
+		arg.OrderID,
+		arg.CreatedAt,
+	)
+	var order_id int64
+	err := row.Scan(&order_id)
+	return order_id, err
+}
+
 const insertOrderInfo = `-- name: InsertOrderInfo :exec
 insert into orders_info (order_id, status, user_id)
 values ($1, $2, $3)
@@ -76,18 +146,24 @@ func (q *Queries) InsertOrderInfo(ctx context.Context, arg InsertOrderInfoParams
 }
 
 const insertOrderItem = `-- name: InsertOrderItem :exec
-insert into orders_items (order_id, item_id, count)
-values ($1, $2, $3)
+insert into orders_items (order_id, item_id, count, price)
+values ($1, $2, $3, $4)
 `
 
 type InsertOrderItemParams struct {
 	OrderID int64
 	ItemID  int64
 	Count   int32
+	Price   int64
 }
 
 func (q *Queries) InsertOrderItem(ctx context.Context, arg InsertOrderItemParams) error {
-	_, err := q.db.Exec(ctx, insertOrderItem, arg.OrderID, arg.ItemID, arg.Count)
+	_, err := q.db.Exec(ctx, insertOrderItem,
+		arg.OrderID,
+		arg.ItemID,
+		arg.Count,
+		arg.Price,
+	)
 	return err
 }
 
@@ -15,4 +15,9 @@ where sku_id = $3;
 -- name: GetStock :one
 select sku_id, available, reserved
 from stocks
-where sku_id = $1;
\ No newline at end of file
+where sku_id = $1;
+
+-- name: GetStocks :many
+select sku_id, available, reserved
+from stocks
+where sku_id = any(@sku_ids::bigint[]);
@@ -120,6 +120,24 @@ func (repo *StocksRepo) GetById(ctx context.Context, tx db.Tx, skuId int64) (uin
 	return uint64(stockData.Available), nil
 }
 
+// GetByIds returns available stocks of the known skus in one query, unknown skus are missing in the result.
+func (repo *StocksRepo) GetByIds(ctx context.Context, tx db.Tx, skuIds []int64) (map[int64]uint64, error) {
+	q := stocksrepo.New(tx)
+	stocksData, err := q.GetStocks(ctx, skuIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stocks := make(map[int64]uint64, len(stocksData))
+
+	for _, stockData := range stocksData {
+		stocks[stockData.SkuID] = uint64(stockData.Available)
+	}
+
+	return stocks, nil
+}
+
 func (repo *StocksRepo) available(ctx context.Context, q *stocksrepo.Queries, items []itemmodel.Item) error {
 	for _, item := range items {
 		stock, err := q.GetStock(ctx, int64(item.SkuId))
@@ -38,6 +38,32 @@ func (q *Queries) GetStock(ctx context.Context, skuID int64) (Stock, error) {
 	return i, err
 }
 
+const getStocks = `-- name: GetStocks :many
+select sku_id, available, reserved
+from stocks
+where sku_id = any($1::bigint[])
+`
+
+func (q *Queries) GetStocks(ctx context.Context, skuIds []int64) ([]Stock, error) {
+	rows, err := q.db.Query(ctx, getStocks, skuIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Stock
+	for rows.Next() {
+		var i Stock
+		if err := rows.Scan(&i.SkuID, &i.Available, &i.Reserved); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const removeStock = `-- name: RemoveStock :exec
 update stocks
 set reserved=$1
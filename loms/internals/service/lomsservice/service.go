@@ -8,6 +8,7 @@ import (
 	"route256.ozon.ru/project/loms/internals/infra/shardmanager"
 	"route256.ozon.ru/project/loms/model/itemmodel"
 	"route256.ozon.ru/project/loms/model/ordermodel"
+	"slices"
 	"strconv"
 )
 
@@ -16,6 +17,7 @@ type StocksProvider interface {
 	Remove(ctx context.Context, trx db.Tx, items []itemmodel.Item) error
 	Cancel(ctx context.Context, trx db.Tx, items []itemmodel.Item) error
 	GetById(ctx context.Context, trx db.Tx, skuId int64) (uint64, error)
+	GetByIds(ctx context.Context, trx db.Tx, skuIds []int64) (map[int64]uint64, error)
 }
 
 type ShardManagerProvider interface {
@@ -27,6 +29,9 @@ type OrdersProvider interface {
 	Create(ctx context.Context, trx db.Tx, shardIndex shardmanager.ShardIndex, userId int64, items []itemmodel.Item) (int64, error)
 	GetOrder(ctx context.Context, trx db.Tx, orderId int64) (int64, ordermodel.Status, []itemmodel.Item, error)
 	SetStatus(ctx context.Context, trx db.Tx, orderId int64, status ordermodel.Status) error
+	FindByIdempotencyKey(ctx context.Context, trx db.Tx, userId int64, key string) (int64, bool, error)
+	SaveIdempotencyKey(ctx context.Context, trx db.Tx, userId int64, key string, orderId int64) (int64, error)
+	DeleteIdempotencyKey(ctx context.Context, trx db.Tx, userId int64, orderId int64) error
 }
 
 type NotifierProvider interface {
@@ -44,6 +49,9 @@ type LomsService struct {
 var (
 	ErrIncorrectStatus = errors.New("couldn't process the order due to the incorrect status")
 	ErrGetOrders       = errors.New("couldn't get all orders")
+
+	// errIdempotencyKeyTaken rolls back an order created concurrently with another one for the same key.
+	errIdempotencyKeyTaken = errors.New("idempotency key is taken by another order")
 )
 
 func NewLomsService(
@@ -62,7 +70,10 @@ func NewLomsService(
 	}
 }
 
-func (service LomsService) CreateOrder(ctx context.Context, userId int64, items []itemmodel.Item) (int64, error) {
+// CreateOrder reserves stocks for a new order. A non-empty idempotencyKey is stored next to the order
+// on the user's shard, and a repeated call with the same key returns the original order without reserving stocks again.
+// The key is released when the order is cancelled.
+func (service LomsService) CreateOrder(ctx context.Context, userId int64, items []itemmodel.Item, idempotencyKey string) (int64, error) {
 	var orderId int64
 
 	shard, shardIndex, err := service.shardManager.Get(
@@ -77,6 +88,19 @@ func (service LomsService) CreateOrder(ctx context.Context, userId int64, items
 		shardTx := tx[0]
 		stocksTx := tx[1]
 
+		if idempotencyKey != "" {
+			id, found, err := service.orders.FindByIdempotencyKey(ctx, shardTx, userId, idempotencyKey)
+
+			if err != nil {
+				return err
+			}
+
+			if found {
+				orderId = id
+				return nil
+			}
+		}
+
 		id, err := service.orders.Create(ctx, shardTx, shardIndex, userId, items)
 		orderId = id
 
@@ -84,6 +108,19 @@ func (service LomsService) CreateOrder(ctx context.Context, userId int64, items
 			return err
 		}
 
+		if idempotencyKey != "" {
+			savedId, err := service.orders.SaveIdempotencyKey(ctx, shardTx, userId, idempotencyKey, orderId)
+
+			if err != nil {
+				return err
+			}
+
+			if savedId != orderId {
+				orderId = savedId
+				return errIdempotencyKeyTaken
+			}
+		}
+
 		err = service.notifier.Publish(ctx, shardTx, orderId, ordermodel.StatusNew)
 
 		if err != nil {
@@ -123,6 +160,10 @@ func (service LomsService) CreateOrder(ctx context.Context, userId int64, items
 		return nil
 	})
 
+	if errors.Is(err, errIdempotencyKeyTaken) {
+		return orderId, nil
+	}
+
 	return orderId, err
 }
 
@@ -218,6 +259,12 @@ func (service LomsService) CancelOrder(ctx context.Context, orderId int64) error
 			return err
 		}
 
+		err = service.orders.DeleteIdempotencyKey(ctx, shardTx, order.User, orderId)
+
+		if err != nil {
+			return err
+		}
+
 		err = service.notifier.Publish(ctx, shardTx, orderId, ordermodel.StatusCanceled)
 
 		if err != nil {
@@ -269,6 +316,32 @@ func (service LomsService) GetAvailableStocks(ctx context.Context, skuId int64)
 	return availableStocks, err
 }
 
+// GetAvailableStocksBatch returns available stocks of the skus in one read transaction
+// and the requested skus that are unknown, in the order of the request.
+func (service LomsService) GetAvailableStocksBatch(ctx context.Context, skuIds []int64) (map[int64]uint64, []int64, error) {
+	var availableStocks map[int64]uint64
+
+	err := db.WithTransaction(ctx, service.stocksPool, db.ReadOnly, func(ctx context.Context, tx db.Tx) error {
+		stocks, err := service.stocks.GetByIds(ctx, tx, skuIds)
+		availableStocks = stocks
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unknownSkuIds := make([]int64, 0)
+
+	for _, skuId := range skuIds {
+		if _, ok := availableStocks[skuId]; !ok && !slices.Contains(unknownSkuIds, skuId) {
+			unknownSkuIds = append(unknownSkuIds, skuId)
+		}
+	}
+
+	return availableStocks, unknownSkuIds, nil
+}
+
 func (service LomsService) getOrder(ctx context.Context, tx db.Tx, orderId int64) (*ordermodel.Info, error) {
 	userId, status, items, err := service.orders.GetOrder(ctx, tx, orderId)
 
@@ -16,10 +16,11 @@ import (
 )
 
 type inputData struct {
-	userId  int64
-	orderId int64
-	skuId   int64
-	items   []itemmodel.Item
+	userId         int64
+	orderId        int64
+	skuId          int64
+	items          []itemmodel.Item
+	idempotencyKey string
 }
 
 func getTxMock(ctx context.Context, client db.Pool, p pgxmock.PgxPoolIface) db.Tx {
@@ -237,6 +238,74 @@ func TestLomsService_CreateOrder(t *testing.T) {
 			wantErr:    nil,
 			wantResult: 999,
 		},
+		{
+			name: "should return the original order for a repeated idempotency key",
+			inputData: inputData{
+				userId: 1,
+				items: []itemmodel.Item{
+					{SkuId: 1, Count: 1},
+				},
+				idempotencyKey: "checkout-1",
+			},
+			mock: func(ctx context.Context, sh *ShardManagerProviderMock, pool db.Pool, conn pgxmock.PgxPoolIface, s *StocksProviderMock, o *OrdersProviderMock, n *NotifierProviderMock, i inputData, wantResult int64, wantErr error) {
+				tx := getTxMock(ctx, pool, conn)
+				conn.ExpectBegin()
+				conn.ExpectBegin()
+				conn.ExpectCommit()
+				conn.ExpectCommit()
+				sh.GetMock.Expect(shardmanager.ShardKey(strconv.FormatInt(i.userId, 10))).Return(pool, 0, nil)
+				o.FindByIdempotencyKeyMock.Expect(minimock.AnyContext, tx, i.userId, i.idempotencyKey).Return(wantResult, true, nil)
+			},
+			wantResult: 999,
+		},
+		{
+			name: "should save a new idempotency key",
+			inputData: inputData{
+				userId: 1,
+				items: []itemmodel.Item{
+					{SkuId: 1, Count: 1},
+				},
+				idempotencyKey: "checkout-1",
+			},
+			mock: func(ctx context.Context, sh *ShardManagerProviderMock, pool db.Pool, conn pgxmock.PgxPoolIface, s *StocksProviderMock, o *OrdersProviderMock, n *NotifierProviderMock, i inputData, wantResult int64, wantErr error) {
+				tx := getTxMock(ctx, pool, conn)
+				conn.ExpectBegin()
+				conn.ExpectBegin()
+				conn.ExpectCommit()
+				conn.ExpectCommit()
+				sh.GetMock.Expect(shardmanager.ShardKey(strconv.FormatInt(i.userId, 10))).Return(pool, 0, nil)
+				o.FindByIdempotencyKeyMock.Expect(minimock.AnyContext, tx, i.userId, i.idempotencyKey).Return(0, false, nil)
+				o.CreateMock.When(minimock.AnyContext, tx, 0, i.userId, i.items).Then(wantResult, nil)
+				o.SaveIdempotencyKeyMock.Expect(minimock.AnyContext, tx, i.userId, i.idempotencyKey, wantResult).Return(wantResult, nil)
+				n.PublishMock.When(minimock.AnyContext, tx, wantResult, ordermodel.StatusNew).Then(nil)
+				s.ReserveMock.When(minimock.AnyContext, tx, i.items).Then(nil)
+				n.PublishMock.When(minimock.AnyContext, tx, wantResult, ordermodel.StatusAwaiting).Then(nil)
+				o.SetStatusMock.When(minimock.AnyContext, tx, wantResult, ordermodel.StatusAwaiting).Then(nil)
+			},
+			wantResult: 999,
+		},
+		{
+			name: "should return the concurrent order for the same idempotency key without reserving stocks",
+			inputData: inputData{
+				userId: 1,
+				items: []itemmodel.Item{
+					{SkuId: 1, Count: 1},
+				},
+				idempotencyKey: "checkout-1",
+			},
+			mock: func(ctx context.Context, sh *ShardManagerProviderMock, pool db.Pool, conn pgxmock.PgxPoolIface, s *StocksProviderMock, o *OrdersProviderMock, n *NotifierProviderMock, i inputData, wantResult int64, wantErr error) {
+				tx := getTxMock(ctx, pool, conn)
+				conn.ExpectBegin()
+				conn.ExpectBegin()
+				conn.ExpectRollback()
+				conn.ExpectRollback()
+				sh.GetMock.Expect(shardmanager.ShardKey(strconv.FormatInt(i.userId, 10))).Return(pool, 0, nil)
+				o.FindByIdempotencyKeyMock.Expect(minimock.AnyContext, tx, i.userId, i.idempotencyKey).Return(0, false, nil)
+				o.CreateMock.When(minimock.AnyContext, tx, 0, i.userId, i.items).Then(1000, nil)
+				o.SaveIdempotencyKeyMock.Expect(minimock.AnyContext, tx, i.userId, i.idempotencyKey, 1000).Return(wantResult, nil)
+			},
+			wantResult: 999,
+		},
 	}
 
 	for _, test := range tests {
@@ -272,7 +341,7 @@ func TestLomsService_CreateOrder(t *testing.T) {
 			)
 
 			test.mock(ctx, shardManager, pool, conn, stocksProviderMock, ordersProviderMock, notifierProviderMock, test.inputData, test.wantResult, test.wantErr)
-			gotResult, gotErr := lomsService.CreateOrder(ctx, test.inputData.userId, test.inputData.items)
+			gotResult, gotErr := lomsService.CreateOrder(ctx, test.inputData.userId, test.inputData.items, test.inputData.idempotencyKey)
 
 			require.ErrorIs(t, test.wantErr, gotErr)
 			require.Equal(t, test.wantResult, gotResult)
@@ -392,7 +461,31 @@ func TestLomsService_CancelOrder(t *testing.T) {
 				n.PublishMock.When(ctx, tx, i.orderId, ordermodel.StatusCanceled).Then(nil)
 				s.CancelMock.When(ctx, tx, i.items).Then(nil)
 				o.SetStatusMock.When(ctx, tx, i.orderId, ordermodel.StatusCanceled).Then(nil)
+				o.DeleteIdempotencyKeyMock.Expect(ctx, tx, i.userId, i.orderId).Return(nil)
+			},
+		},
+		{
+			name: "should be error if failed to release the idempotency key",
+			inputData: inputData{
+				orderId: 1,
+				userId:  2,
+				items: []itemmodel.Item{
+					{SkuId: 1, Count: 1},
+				},
+			},
+			mock: func(ctx context.Context, sh *ShardManagerProviderMock, pool db.Pool, conn pgxmock.PgxPoolIface, s *StocksProviderMock, o *OrdersProviderMock, n *NotifierProviderMock, i inputData, wantResult int64, wantErr error) {
+				tx := getTxMock(ctx, pool, conn)
+				sh.GetByOrderIdMock.Expect(i.orderId).Return(pool, nil)
+				conn.ExpectBegin()
+				conn.ExpectBegin()
+				conn.ExpectRollback()
+				conn.ExpectRollback()
+				o.GetOrderMock.Expect(ctx, tx, i.orderId).Return(i.userId, ordermodel.StatusAwaiting, i.items, nil)
+				s.CancelMock.Expect(ctx, tx, i.items).Return(nil)
+				o.SetStatusMock.Expect(ctx, tx, i.orderId, ordermodel.StatusCanceled).Return(nil)
+				o.DeleteIdempotencyKeyMock.Expect(ctx, tx, i.userId, i.orderId).Return(wantErr)
 			},
+			wantErr: errors.New("failed to delete the idempotency key"),
 		},
 	}
 
@@ -680,3 +773,76 @@ func TestLomsService_GetAvailableStocks(t *testing.T) {
 		})
 	}
 }
+
+func TestLomsService_GetAvailableStocksBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		skuIds      []int64
+		stocks      map[int64]uint64
+		stocksErr   error
+		wantStocks  map[int64]uint64
+		wantUnknown []int64
+	}{
+		{
+			name:        "should return stocks of all skus",
+			skuIds:      []int64{1, 2},
+			stocks:      map[int64]uint64{1: 10, 2: 0},
+			wantStocks:  map[int64]uint64{1: 10, 2: 0},
+			wantUnknown: []int64{},
+		},
+		{
+			name:        "should report unknown skus once in the order of the request",
+			skuIds:      []int64{4, 1, 3, 4},
+			stocks:      map[int64]uint64{1: 10},
+			wantStocks:  map[int64]uint64{1: 10},
+			wantUnknown: []int64{4, 3},
+		},
+		{
+			name:      "should be error if failed to find stocks",
+			skuIds:    []int64{1},
+			stocksErr: errors.New("failed to find stocks"),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			conn, err := pgxmock.NewPool()
+			require.NoError(t, err)
+
+			pool, err := db.NewDbClientFromConnection([]db.Tx{conn}, []db.Tx{})
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			stocksProviderMock := NewStocksProviderMock(mc)
+			lomsService := NewLomsService(
+				NewShardManagerProviderMock(mc),
+				pool,
+				stocksProviderMock,
+				NewOrdersProviderMock(mc),
+				NewNotifierProviderMock(mc),
+			)
+
+			tx := getTxMock(ctx, pool, conn)
+			conn.ExpectBegin()
+
+			if test.stocksErr == nil {
+				conn.ExpectCommit()
+			} else {
+				conn.ExpectRollback()
+			}
+
+			stocksProviderMock.GetByIdsMock.Expect(ctx, tx, test.skuIds).Return(test.stocks, test.stocksErr)
+
+			gotStocks, gotUnknown, gotErr := lomsService.GetAvailableStocksBatch(ctx, test.skuIds)
+
+			require.ErrorIs(t, gotErr, test.stocksErr)
+			require.Equal(t, test.wantStocks, gotStocks)
+			require.Equal(t, test.wantUnknown, gotUnknown)
+		})
+	}
+}
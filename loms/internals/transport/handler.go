@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"route256.ozon.ru/project/loms/internals/repository/stocksrepo"
 	"route256.ozon.ru/project/loms/model/itemmodel"
@@ -19,12 +20,13 @@ type LomsHandler struct {
 }
 
 type LomsProvider interface {
-	CreateOrder(ctx context.Context, userId int64, items []itemmodel.Item) (int64, error)
+	CreateOrder(ctx context.Context, userId int64, items []itemmodel.Item, idempotencyKey string) (int64, error)
 	GetOrder(ctx context.Context, orderId int64) (*ordermodel.Info, error)
 	PayOrder(ctx context.Context, orderId int64) error
 	CancelOrder(ctx context.Context, orderId int64) error
 	GetOrders(ctx context.Context, orderIds []int64) ([]*ordermodel.Info, error)
 	GetAvailableStocks(ctx context.Context, skuId int64) (uint64, error)
+	GetAvailableStocksBatch(ctx context.Context, skuIds []int64) (map[int64]uint64, []int64, error)
 }
 
 func NewLomsHandler(service LomsProvider) *LomsHandler {
@@ -38,6 +40,7 @@ func (h LomsHandler) OrderCreate(context context.Context, req *servicepb.OrderCr
 		context,
 		req.User,
 		prepareModelItems(req.Items),
+		idempotencyKey(context),
 	)
 
 	if err = handleError(err); err != nil {
@@ -91,6 +94,25 @@ func (h LomsHandler) StocksInfo(context context.Context, req *servicepb.StocksIn
 	return &servicepb.StocksInfoResponse{Count: availableStocks}, nil
 }
 
+func (h LomsHandler) StocksInfoBatch(context context.Context, req *servicepb.StocksInfoBatchRequest) (*servicepb.StocksInfoBatchResponse, error) {
+	skuIds := make([]int64, len(req.Skus))
+
+	for i, sku := range req.Skus {
+		skuIds[i] = int64(sku)
+	}
+
+	availableStocks, unknownSkuIds, err := h.service.GetAvailableStocksBatch(context, skuIds)
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return &servicepb.StocksInfoBatchResponse{
+		Stocks:      preparePbStocks(skuIds, availableStocks),
+		UnknownSkus: preparePbSkus(unknownSkuIds),
+	}, nil
+}
+
 func (h LomsHandler) OrdersList(context context.Context, req *servicepb.OrdersListRequest) (*servicepb.OrdersListResponse, error) {
 	orders, err := h.service.GetOrders(context, req.OrderIds)
 
@@ -101,6 +123,17 @@ func (h LomsHandler) OrdersList(context context.Context, req *servicepb.OrdersLi
 	return &servicepb.OrdersListResponse{Orders: preparePbOrders(orders)}, nil
 }
 
+// IdempotencyKeyHeader is the gRPC metadata key of the client generated idempotency key of OrderCreate.
+const IdempotencyKeyHeader = "idempotency-key"
+
+func idempotencyKey(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, IdempotencyKeyHeader); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
 func handleError(err error) error {
 	switch {
 	case errors.Is(err, stocksrepo.ErrProductsOutOfStock):
@@ -120,6 +153,7 @@ func prepareModelItems(items []*servicepb.OrderItem) []itemmodel.Item {
 		modelItems = append(modelItems, itemmodel.Item{
 			Count: uint16(item.Count),
 			SkuId: item.Sku,
+			Price: item.Price,
 		})
 	}
 
@@ -133,6 +167,7 @@ func preparePbItems(items []itemmodel.Item) []*servicepb.OrderItem {
 		pbItems = append(pbItems, &servicepb.OrderItem{
 			Count: uint32(item.Count),
 			Sku:   item.SkuId,
+			Price: item.Price,
 		})
 	}
 
@@ -153,6 +188,38 @@ func preparePbOrders(items []*ordermodel.Info) []*servicepb.OrderInfo {
 	return pbItems
 }
 
+// preparePbStocks keeps the order of the request and skips unknown and repeated skus.
+func preparePbStocks(skuIds []int64, stocks map[int64]uint64) []*servicepb.StockInfo {
+	pbStocks := make([]*servicepb.StockInfo, 0, len(stocks))
+	seen := make(map[int64]struct{}, len(stocks))
+
+	for _, skuId := range skuIds {
+		count, ok := stocks[skuId]
+
+		if _, repeated := seen[skuId]; !ok || repeated {
+			continue
+		}
+
+		seen[skuId] = struct{}{}
+		pbStocks = append(pbStocks, &servicepb.StockInfo{
+			Sku:   uint32(skuId),
+			Count: count,
+		})
+	}
+
+	return pbStocks
+}
+
+func preparePbSkus(skuIds []int64) []uint32 {
+	pbSkus := make([]uint32, len(skuIds))
+
+	for i, skuId := range skuIds {
+		pbSkus[i] = uint32(skuId)
+	}
+
+	return pbSkus
+}
+
 func preparePbProductStatus(status ordermodel.Status) servicepb.OrderStatus {
 	newStatus := servicepb.OrderStatus_UNSPECIFIED
 
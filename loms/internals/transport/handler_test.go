@@ -1,10 +1,12 @@
 package transport
 
 import (
+	"context"
 	"errors"
 	"github.com/gojuno/minimock/v3"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"route256.ozon.ru/project/loms/model/itemmodel"
 	"route256.ozon.ru/project/loms/model/ordermodel"
@@ -27,7 +29,7 @@ func TestLomsHandler_OrderCreate(t *testing.T) {
 				Items: []*order.OrderItem{{Sku: 1, Count: 1}},
 			},
 			mock: func(l *LomsProviderMock, i *order.OrderCreateRequest, wantResult *order.OrderCreateResponse, wantErr codes.Code) {
-				l.CreateOrderMock.Expect(minimock.AnyContext, i.User, []itemmodel.Item{{SkuId: 1, Count: 1}}).Return(0, errors.New("failed to create order"))
+				l.CreateOrderMock.Expect(minimock.AnyContext, i.User, []itemmodel.Item{{SkuId: 1, Count: 1}}, "").Return(0, errors.New("failed to create order"))
 			},
 			wantErr: codes.Internal,
 		},
@@ -38,7 +40,7 @@ func TestLomsHandler_OrderCreate(t *testing.T) {
 				Items: []*order.OrderItem{},
 			},
 			mock: func(l *LomsProviderMock, i *order.OrderCreateRequest, wantResult *order.OrderCreateResponse, wantErr codes.Code) {
-				l.CreateOrderMock.Expect(minimock.AnyContext, i.User, []itemmodel.Item{}).Return(wantResult.OrderID, nil)
+				l.CreateOrderMock.Expect(minimock.AnyContext, i.User, []itemmodel.Item{}, "").Return(wantResult.OrderID, nil)
 			},
 			wantResult: &order.OrderCreateResponse{
 				OrderID: 2,
@@ -57,12 +59,27 @@ func TestLomsHandler_OrderCreate(t *testing.T) {
 			lomsService := NewLomsHandler(lomsProviderMock)
 
 			test.mock(lomsProviderMock, test.inputData, test.wantResult, test.wantErr)
-			gotResult, gotErr := lomsService.OrderCreate(minimock.AnyContext, test.inputData)
+			gotResult, gotErr := lomsService.OrderCreate(context.Background(), test.inputData)
 
 			require.Equal(t, test.wantErr, status.Code(gotErr))
 			require.Equal(t, test.wantResult, gotResult)
 		})
 	}
+
+	t.Run("should pass idempotency key from metadata", func(t *testing.T) {
+		t.Parallel()
+
+		mc := minimock.NewController(t)
+		lomsProviderMock := NewLomsProviderMock(mc)
+		lomsService := NewLomsHandler(lomsProviderMock)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, "checkout-1"))
+
+		lomsProviderMock.CreateOrderMock.Expect(minimock.AnyContext, 1, []itemmodel.Item{}, "checkout-1").Return(2, nil)
+		gotResult, gotErr := lomsService.OrderCreate(ctx, &order.OrderCreateRequest{User: 1, Items: []*order.OrderItem{}})
+
+		require.NoError(t, gotErr)
+		require.Equal(t, &order.OrderCreateResponse{OrderID: 2}, gotResult)
+	})
 }
 
 func TestLomsHandler_OrderCancel(t *testing.T) {
@@ -274,3 +291,58 @@ func TestLomsHandler_StocksInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestLomsHandler_StocksInfoBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputData  *order.StocksInfoBatchRequest
+		mock       func(l *LomsProviderMock)
+		wantResult *order.StocksInfoBatchResponse
+		wantErr    codes.Code
+	}{
+		{
+			name:      "should keep the order of the request and report unknown skus",
+			inputData: &order.StocksInfoBatchRequest{Skus: []uint32{3, 1, 2, 3}},
+			mock: func(l *LomsProviderMock) {
+				l.GetAvailableStocksBatchMock.
+					Expect(minimock.AnyContext, []int64{3, 1, 2, 3}).
+					Return(map[int64]uint64{1: 10, 3: 0}, []int64{2}, nil)
+			},
+			wantResult: &order.StocksInfoBatchResponse{
+				Stocks: []*order.StockInfo{
+					{Sku: 3, Count: 0},
+					{Sku: 1, Count: 10},
+				},
+				UnknownSkus: []uint32{2},
+			},
+		},
+		{
+			name:      "should be error if failed to get stocks info",
+			inputData: &order.StocksInfoBatchRequest{Skus: []uint32{1}},
+			mock: func(l *LomsProviderMock) {
+				l.GetAvailableStocksBatchMock.
+					Expect(minimock.AnyContext, []int64{1}).
+					Return(nil, nil, errors.New("failed to get stocks"))
+			},
+			wantErr: codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mc := minimock.NewController(t)
+			lomsProviderMock := NewLomsProviderMock(mc)
+			lomsService := NewLomsHandler(lomsProviderMock)
+
+			test.mock(lomsProviderMock)
+			gotResult, gotErr := lomsService.StocksInfoBatch(minimock.AnyContext, test.inputData)
+
+			require.Equal(t, test.wantErr, status.Code(gotErr))
+			require.Equal(t, test.wantResult, gotResult)
+		})
+	}
+}
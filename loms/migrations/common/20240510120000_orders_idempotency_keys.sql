@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists orders_idempotency_keys
+(
+    user_id         bigint    not null,
+    idempotency_key text      not null,
+    order_id        bigint    not null,
+    created_at      timestamp not null,
+    primary key (user_id, idempotency_key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists orders_idempotency_keys cascade;
+-- +goose StatementEnd
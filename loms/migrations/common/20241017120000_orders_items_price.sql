@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table orders_items
+    add column if not exists price bigint not null default 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table orders_items
+    drop column if exists price;
+-- +goose StatementEnd
@@ -13,6 +13,7 @@ create table if not exists orders_items
     order_id bigint not null,
     item_id  bigint not null,
     count    int    not null,
+    price    bigint not null default 0,
     primary key (order_id, item_id)
 );
 
@@ -43,6 +44,15 @@ create table if not exists orders_events
 );
 
 create index ids_created_at on orders_events (created_at desc);
+
+create table if not exists orders_idempotency_keys
+(
+    user_id         bigint    not null,
+    idempotency_key text      not null,
+    order_id        bigint    not null,
+    created_at      timestamp not null,
+    primary key (user_id, idempotency_key)
+);
 -- +goose StatementEnd
 
 -- +goose Down
@@ -51,4 +61,5 @@ drop table if exists orders_info cascade;
 drop table if exists orders_items cascade;
 drop table if exists stocks cascade;
 drop table if exists orders_events cascade;
+drop table if exists orders_idempotency_keys cascade;
 -- +goose StatementEnd
@@ -3,4 +3,6 @@ package itemmodel
 type Item struct {
 	SkuId uint32
 	Count uint16
+	// Price is the unit price the user is charged, 0 for orders created without prices
+	Price uint32
 }
@@ -73,7 +73,7 @@ func (suite *LomsServiceSuite) TestCreateOrderFlowIntegration() {
 	userId := int64(1)
 	items := []itemmodel.Item{{SkuId: 1002, Count: 1}}
 
-	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items)
+	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items, "")
 	suite.Require().NoError(err)
 	suite.Require().NotEmpty(orderId)
 
@@ -88,11 +88,27 @@ func (suite *LomsServiceSuite) TestCreateOrderFlowIntegration() {
 	suite.Require().Equal(ordermodel.StatusAwaiting, info.Status)
 }
 
+func (suite *LomsServiceSuite) TestCreateOrderIdempotencyIntegration() {
+	userId := int64(1)
+	items := []itemmodel.Item{{SkuId: 1002, Count: 1}}
+
+	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items, "checkout-1")
+	suite.Require().NoError(err)
+
+	repeatedOrderId, err := suite.service.CreateOrder(suite.ctx, userId, items, "checkout-1")
+	suite.Require().NoError(err)
+	suite.Require().Equal(orderId, repeatedOrderId)
+
+	stocks, err := suite.service.GetAvailableStocks(suite.ctx, int64(items[0].SkuId))
+	suite.Require().NoError(err)
+	suite.Require().Equal(uint64(179), stocks)
+}
+
 func (suite *LomsServiceSuite) TestPayOrderFlowIntegration() {
 	userId := int64(1)
 	items := []itemmodel.Item{{SkuId: 1002, Count: 1}}
 
-	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items)
+	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items, "")
 	suite.Require().NoError(err)
 	suite.Require().NotEmpty(orderId)
 
@@ -108,7 +124,7 @@ func (suite *LomsServiceSuite) TestCancelOrderFlowIntegration() {
 	userId := int64(1)
 	items := []itemmodel.Item{{SkuId: 1002, Count: 1}}
 
-	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items)
+	orderId, err := suite.service.CreateOrder(suite.ctx, userId, items, "")
 	suite.Require().NoError(err)
 	suite.Require().NotEmpty(orderId)
 